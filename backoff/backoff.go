@@ -0,0 +1,50 @@
+package backoff
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"pkg/errors"
+)
+
+// Delay возвращает задержку перед повтором номер attempt: случайное значение от половины до полной
+// экспоненциальной задержки, ограниченной maxDelay. Если maxDelay не больше нуля, задержка не ограничена
+func Delay(minDelay, maxDelay time.Duration, attempt int) time.Duration {
+
+	if minDelay <= 0 {
+		return 0
+	}
+
+	delay := minDelay
+	for i := 0; i < attempt && (maxDelay <= 0 || delay < maxDelay); i++ {
+
+		// Без ограничения удвоение быстро переполнит time.Duration
+		if delay > math.MaxInt64/2 {
+			delay = math.MaxInt64
+			break
+		}
+		delay *= 2
+	}
+	if maxDelay > 0 && delay > maxDelay {
+		delay = maxDelay
+	}
+
+	half := delay / 2
+	return half + rand.N(delay-half+1) //nolint:gosec // Криптостойкость для разброса не нужна
+}
+
+// Sleep ждет задержку перед повтором номер attempt. Возвращает ошибку, если контекст отменили раньше
+func Sleep(ctx context.Context, minDelay, maxDelay time.Duration, attempt int) error {
+
+	timer := time.NewTimer(Delay(minDelay, maxDelay, attempt))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return errors.Default.Wrap(ctx.Err())
+	case <-timer.C:
+		return nil
+	}
+}
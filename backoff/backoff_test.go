@@ -0,0 +1,47 @@
+package backoff
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDelay(t *testing.T) {
+
+	minDelay, maxDelay := 10*time.Millisecond, 50*time.Millisecond
+
+	for attempt, want := range []time.Duration{10, 20, 40, 50, 50} {
+		want *= time.Millisecond
+		for range 100 {
+			if got := Delay(minDelay, maxDelay, attempt); got < want/2 || got > want {
+				t.Fatalf("Delay(%d) = %s, want [%s, %s]", attempt, got, want/2, want)
+			}
+		}
+	}
+
+	assert.Zero(t, Delay(0, maxDelay, 3))
+
+	// Без ограничения задержка продолжает расти и не переполняется
+	for range 100 {
+		if got := Delay(minDelay, 0, 3); got < 40*time.Millisecond || got > 80*time.Millisecond {
+			t.Fatalf("Delay(3) без ограничения = %s, want [40ms, 80ms]", got)
+		}
+	}
+	assert.GreaterOrEqual(t, Delay(time.Hour, 0, 100), time.Duration(math.MaxInt64/2))
+}
+
+func TestSleep(t *testing.T) {
+
+	t.Run("1. Задержка истекла", func(t *testing.T) {
+		assert.NoError(t, Sleep(context.Background(), time.Millisecond, time.Millisecond, 0))
+	})
+
+	t.Run("2. Контекст отменен раньше", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.Error(t, Sleep(ctx, time.Hour, time.Hour, 0))
+	})
+}
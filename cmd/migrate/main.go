@@ -0,0 +1,299 @@
+// Command migrate применяет и откатывает миграции goose из директории для деплойных джобов.
+//
+// Использование:
+//
+//	migrate [флаги] <команда> [версия]
+//
+// Команды: status, version, up, up-to <версия>, down, down-to <версия>, redo, reset, replicas, drift.
+// Для ClickHouse флаг -cluster включает ON CLUSTER в шаблонах миграций и реплицируемую таблицу версий,
+// а команда replicas печатает расхождения схемы между репликами кластера.
+// Команда drift применяет миграции к пустой базе из -scratch-dsn и печатает расхождения живой схемы с ожидаемой.
+// С флагом -dry-run команды up, up-to, down, down-to и reset печатают SQL, который будет выполнен, не меняя базу.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+
+	_ "github.com/ClickHouse/clickhouse-go/v2"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/pressly/goose/v3"
+
+	"pkg/errors"
+	"pkg/log"
+	"pkg/log/model"
+	"pkg/migrator"
+)
+
+// drivers - драйвер database/sql для каждого диалекта
+var drivers = map[migrator.Dialect]string{
+	migrator.DialectPostgres:   "pgx",
+	migrator.DialectClickHouse: "clickhouse",
+}
+
+func main() {
+
+	dialect := flag.String("dialect", string(migrator.DialectPostgres), "диалект базы: postgres или clickhouse")
+	dsn := flag.String("dsn", os.Getenv("MIGRATE_DSN"), "строка подключения, по умолчанию из MIGRATE_DSN")
+	dir := flag.String("dir", "migrations", "директория с миграциями")
+	dryRun := flag.Bool("dry-run", false, "напечатать SQL без применения")
+	cluster := flag.String("cluster", "", "кластер ClickHouse для ON CLUSTER")
+	scratchDSN := flag.String("scratch-dsn", os.Getenv("MIGRATE_SCRATCH_DSN"), "строка подключения к пустой базе для drift, по умолчанию из MIGRATE_SCRATCH_DSN")
+	flag.Usage = func() {
+		_, _ = fmt.Fprintf(flag.CommandLine.Output(), "Usage: migrate [flags] status|version|up|up-to V|down|down-to V|redo|reset|replicas|drift\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	hostname, _ := os.Hostname()
+	_ = log.Init(model.SystemInfo{
+		BuildDate:   "",
+		Hostname:    hostname,
+		Version:     "",
+		ServiceName: "migrate",
+		Build:       "",
+		Env:         "",
+	}, log.NewTextHandler(os.Stderr, log.LevelInfo))
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if err := run(ctx, migrator.Dialect(*dialect), *dsn, *dir, *cluster, *scratchDSN, *dryRun, flag.Args()); err != nil {
+		log.Error(err)
+		cancel()
+		os.Exit(1) //nolint:gocritic // cancel вызван явно
+	}
+}
+
+func run(ctx context.Context, dialect migrator.Dialect, dsn, dir, cluster, scratchDSN string, dryRun bool, args []string) error {
+
+	if len(args) == 0 {
+		flag.Usage()
+		return errors.Default.New("command is required")
+	}
+	command := args[0]
+
+	driver, ok := drivers[dialect]
+	if !ok {
+		return errors.Default.New("unsupported dialect").WithParams("dialect", dialect)
+	}
+	if dsn == "" {
+		return errors.Default.New("dsn is required")
+	}
+
+	conn, err := sql.Open(driver, dsn)
+	if err != nil {
+		return errors.Default.Wrap(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	if command == "replicas" {
+		return printReplicaDrift(ctx, conn, cluster)
+	}
+
+	// Без кластера используется стандартная таблица версий goose, чтобы не ломать существующие базы
+	var clickhouseConfig *migrator.ClickhouseConfig
+	if dialect == migrator.DialectClickHouse && cluster != "" {
+		clickhouseConfig = &migrator.ClickhouseConfig{
+			Cluster:       cluster,
+			Database:      "",
+			VersionTable:  "",
+			ZooKeeperPath: "",
+		}
+	}
+
+	m, err := migrator.NewMigrator(migrator.MigratorConfig{
+		Conn:            conn,
+		EmbedMigrations: os.DirFS(dir),
+		Dialect:         goose.Dialect(dialect),
+		Dir:             dir,
+		Migrations:      nil,
+		Clickhouse:      clickhouseConfig,
+		Locker:          nil,
+		LockTimeout:     0,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Версия для команд up-to и down-to
+	var version int64
+	if command == "up-to" || command == "down-to" {
+		if len(args) < 2 {
+			return errors.Default.New("version is required").WithParams("command", command)
+		}
+		if version, err = strconv.ParseInt(args[1], 10, 64); err != nil {
+			return errors.Default.Wrap(err).WithParams("version", args[1])
+		}
+	}
+
+	if dryRun {
+		return plan(ctx, m, command, version)
+	}
+
+	switch command {
+	case "status":
+		return printStatus(ctx, m)
+	case "version":
+		current, err := m.Version(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Println(current)
+		return nil
+	case "up":
+		return m.Up(ctx)
+	case "up-to":
+		return m.UpTo(ctx, version)
+	case "down":
+		return m.Down(ctx)
+	case "down-to":
+		return m.DownTo(ctx, version)
+	case "redo":
+		return m.Redo(ctx)
+	case "reset":
+		return m.Reset(ctx)
+	case "drift":
+		return printDrift(ctx, m, driver, scratchDSN)
+	default:
+		return errors.Default.New("unknown command").WithParams("command", command)
+	}
+}
+
+// plan печатает миграции и SQL, которые выполнит команда
+func plan(ctx context.Context, m migrator.Migrator, command string, version int64) error {
+
+	var (
+		planned []migrator.PlannedMigration
+		err     error
+	)
+
+	switch command {
+	case "up":
+		planned, err = m.PlanUp(ctx, math.MaxInt64)
+	case "up-to":
+		planned, err = m.PlanUp(ctx, version)
+	case "down":
+		planned, err = m.PlanDown(ctx, 0)
+		if len(planned) > 1 {
+			planned = planned[:1]
+		}
+	case "down-to":
+		planned, err = m.PlanDown(ctx, version)
+	case "reset":
+		planned, err = m.PlanDown(ctx, 0)
+	default:
+		return errors.Default.New("dry-run is not supported for command").WithParams("command", command)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(planned) == 0 {
+		fmt.Println("-- nothing to do")
+		return nil
+	}
+
+	for _, migration := range planned {
+		fmt.Printf("-- %s %d %s\n", migration.Direction, migration.Version, migration.Path)
+		if migration.SQL == "" {
+			fmt.Println("-- (no sql)")
+		} else {
+			fmt.Println(migration.SQL)
+		}
+		fmt.Println()
+	}
+
+	return nil
+}
+
+// printStatus печатает таблицу состояния миграций
+func printStatus(ctx context.Context, m migrator.Migrator) error {
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "VERSION\tSTATE\tAPPLIED AT\tPATH")
+	for _, status := range statuses {
+		state, appliedAt := "pending", ""
+		if status.Applied {
+			state, appliedAt = "applied", status.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		_, _ = fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", status.Version, state, appliedAt, status.Path)
+	}
+
+	return w.Flush()
+}
+
+// printReplicaDrift печатает расхождения схемы между репликами кластера ClickHouse
+func printReplicaDrift(ctx context.Context, conn *sql.DB, cluster string) error {
+
+	drift, err := migrator.CheckReplicaDrift(ctx, conn, cluster, "")
+	if err != nil {
+		return err
+	}
+
+	if len(drift) == 0 {
+		fmt.Println("replicas are in sync")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "HOST\tTABLE\tCOLUMN\tTYPE\tEXPECTED")
+	for _, d := range drift {
+		column, typ := d.Column, d.Type
+		if column == "" {
+			column = "(table missing)"
+		}
+		if typ == "" {
+			typ = "-"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", d.Host, d.Table, column, typ, d.Expected)
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+
+	return errors.Default.New("replica schema drift detected").WithParams("count", len(drift))
+}
+
+// printDrift печатает расхождения живой схемы со схемой, которую дают миграции
+func printDrift(ctx context.Context, m migrator.Migrator, driver, scratchDSN string) error {
+
+	if scratchDSN == "" {
+		return errors.Default.New("scratch dsn is required")
+	}
+
+	scratch, err := sql.Open(driver, scratchDSN)
+	if err != nil {
+		return errors.Default.Wrap(err)
+	}
+	defer func() { _ = scratch.Close() }()
+
+	diffs, err := m.CheckDrift(ctx, scratch)
+	if err != nil {
+		return err
+	}
+
+	if len(diffs) == 0 {
+		fmt.Println("schema is in sync")
+		return nil
+	}
+
+	for _, diff := range diffs {
+		fmt.Println(diff.String())
+	}
+
+	return errors.Default.Wrap(migrator.ErrSchemaDrift).WithParams("count", len(diffs))
+}
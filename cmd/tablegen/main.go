@@ -0,0 +1,276 @@
+// Command tablegen генерирует константы колонок и метаданные sql.Table по тегам db структуры.
+//
+// Использование в файле модели:
+//
+//	//go:generate go run pkg/cmd/tablegen -type User -table users -alias u
+//
+// Для типа User создается файл user_table.go с константами UserID, UserName и т.д. типа sql.Column
+// и переменной UserTable. Встроенные структуры без тега раскрываются по тем же правилам, что в sql.NewTable,
+// в том числе из других пакетов.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"pkg/errors"
+)
+
+func main() {
+
+	typeName := flag.String("type", "", "имя структуры модели")
+	table := flag.String("table", "", "имя таблицы")
+	alias := flag.String("alias", "", "алиас таблицы")
+	output := flag.String("output", "", "файл результата, по умолчанию <type>_table.go")
+	flag.Parse()
+
+	if err := run(".", *typeName, *table, *alias, *output); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "tablegen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(dir, typeName, table, alias, output string) error {
+
+	if typeName == "" || table == "" {
+		return errors.Default.New("-type and -table are required")
+	}
+
+	pkg, err := loadPackage(dir)
+	if err != nil {
+		return err
+	}
+
+	code, err := generate(pkg, typeName, table, alias)
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		output = toSnakeCase(typeName) + "_table.go"
+	}
+
+	if err = os.WriteFile(filepath.Join(dir, output), code, 0o644); err != nil { //nolint:gosec // сгенерированный код
+		return errors.Default.Wrap(err)
+	}
+
+	return nil
+}
+
+// loadPackage разбирает пакет в директории и проверяет типы. Зависимости загружаются из export data, которую
+// собирает go list, поэтому встроенные структуры из других пакетов раскрываются так же, как в sql.NewTable.
+// Ошибки типов игнорируются: пакет может ссылаться на еще не сгенерированные константы
+func loadPackage(dir string) (*types.Package, error) {
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, errors.Default.Wrap(err)
+	}
+
+	fset := token.NewFileSet()
+	parsed := make([]*ast.File, 0, len(files))
+	for _, path := range files {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+
+		file, err := parser.ParseFile(fset, path, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, errors.Default.Wrap(err).WithParams("path", path)
+		}
+		parsed = append(parsed, file)
+	}
+	if len(parsed) == 0 {
+		return nil, errors.Default.New("no go files").WithParams("dir", dir)
+	}
+
+	exports, err := listExports(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	imp := importer.ForCompiler(fset, "gc", func(path string) (io.ReadCloser, error) {
+		export, ok := exports[path]
+		if !ok || export == "" {
+			return nil, errors.Default.New("export data not found").WithParams("package", path)
+		}
+		return os.Open(export) //nolint:gosec // путь из go list
+	})
+
+	return checkPackage(fset, parsed, imp), nil
+}
+
+// checkPackage проверяет типы пакета, игнорируя ошибки
+func checkPackage(fset *token.FileSet, files []*ast.File, imp types.Importer) *types.Package {
+	conf := types.Config{
+		Context:                  nil,
+		GoVersion:                "",
+		IgnoreFuncBodies:         true,
+		FakeImportC:              true,
+		Error:                    func(error) {},
+		Importer:                 imp,
+		Sizes:                    nil,
+		DisableUnusedImportCheck: true,
+	}
+	pkg, _ := conf.Check(files[0].Name.Name, fset, files, nil)
+	return pkg
+}
+
+// listExports возвращает пути к export data зависимостей пакета
+func listExports(dir string) (map[string]string, error) {
+
+	cmd := exec.Command("go", "list", "-e", "-export", "-deps", "-f", "{{.ImportPath}}={{.Export}}", ".")
+	cmd.Dir = dir
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Default.Wrap(err).WithParams("dir", dir)
+	}
+
+	exports := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if path, export, ok := strings.Cut(line, "="); ok {
+			exports[path] = export
+		}
+	}
+
+	return exports, nil
+}
+
+// column - колонка и поле структуры, из которого она взята
+type column struct {
+	field string
+	name  string
+}
+
+// generate возвращает отформатированный код констант колонок и переменной таблицы
+func generate(pkg *types.Package, typeName, table, alias string) ([]byte, error) {
+
+	obj, ok := pkg.Scope().Lookup(typeName).(*types.TypeName)
+	if !ok {
+		return nil, errors.Default.New("struct not found").WithParams("type", typeName)
+	}
+	st, ok := obj.Type().Underlying().(*types.Struct)
+	if !ok {
+		return nil, errors.Default.New("struct not found").WithParams("type", typeName)
+	}
+
+	columns := collectColumns(st, make(map[string]struct{}))
+	if len(columns) == 0 {
+		return nil, errors.Default.New("struct has no db tags").WithParams("type", typeName)
+	}
+
+	var buf bytes.Buffer
+	_, _ = fmt.Fprintf(&buf, "// Code generated by tablegen. DO NOT EDIT.\n\npackage %s\n\nimport \"pkg/sql\"\n\n", pkg.Name())
+	_, _ = fmt.Fprintf(&buf, "// Колонки таблицы %s\nconst (\n", table)
+	for _, c := range columns {
+		_, _ = fmt.Fprintf(&buf, "\t%s%s sql.Column = %q\n", typeName, c.field, c.name)
+	}
+	_, _ = fmt.Fprintf(&buf, ")\n\n")
+
+	_, _ = fmt.Fprintf(&buf, "// %sTable - метаданные таблицы %s\n", typeName, table)
+	if alias != "" {
+		_, _ = fmt.Fprintf(&buf, "var %sTable = sql.NewTable[%s](%q).As(%q)\n", typeName, typeName, table, alias)
+	} else {
+		_, _ = fmt.Fprintf(&buf, "var %sTable = sql.NewTable[%s](%q)\n", typeName, typeName, table)
+	}
+
+	code, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, errors.Default.Wrap(err)
+	}
+
+	return code, nil
+}
+
+// collectColumns собирает колонки по тегам db в порядке полей по тем же правилам, что sql.NewTable
+func collectColumns(st *types.Struct, seen map[string]struct{}) []column {
+
+	var columns []column
+
+	for i := range st.NumFields() {
+		field := st.Field(i)
+		tag := dbTag(st.Tag(i))
+
+		// Встроенная структура без тега раскрывается, указатель на структуру - нет
+		if field.Embedded() && tag == "" {
+			if embedded, ok := field.Type().Underlying().(*types.Struct); ok && !isScannable(field.Type(), embedded) {
+				columns = append(columns, collectColumns(embedded, seen)...)
+				continue
+			}
+		}
+
+		if tag == "" || tag == "-" || !field.Exported() {
+			continue
+		}
+		if _, ok := seen[tag]; ok {
+			continue
+		}
+
+		seen[tag] = struct{}{}
+		columns = append(columns, column{field: field.Name(), name: tag})
+	}
+
+	return columns
+}
+
+// isScannable повторяет проверку sql.NewTable: структура сканируется целиком, если реализует sql.Scanner
+// или у нее нет экспортируемых полей, как у time.Time
+func isScannable(typ types.Type, st *types.Struct) bool {
+
+	obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(typ), true, nil, "Scan")
+	if method, ok := obj.(*types.Func); ok {
+		if sig, ok := method.Type().(*types.Signature); ok && sig.Params().Len() == 1 && sig.Results().Len() == 1 {
+			return true
+		}
+	}
+
+	for i := range st.NumFields() {
+		if st.Field(i).Exported() {
+			return false
+		}
+	}
+
+	return true
+}
+
+func dbTag(rawTag string) string {
+	tag, _, _ := strings.Cut(reflect.StructTag(rawTag).Get("db"), ",")
+	return tag
+}
+
+// toSnakeCase переводит имя в snake_case, аббревиатуры остаются одним словом: UserID -> user_id, HTTPServer -> http_server
+func toSnakeCase(s string) string {
+
+	runes := []rune(s)
+
+	var res strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			prevLower := i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]))
+			acronymEnd := i > 0 && unicode.IsUpper(runes[i-1]) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || acronymEnd {
+				res.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		res.WriteRune(r)
+	}
+
+	return res.String()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) { return f(path) }
+
+// checkSources проверяет типы пакетов из исходников. Пакеты импортируют друг друга по имени
+func checkSources(t *testing.T, fset *token.FileSet, sources map[string]string, name string) *types.Package {
+
+	checked := make(map[string]*types.Package)
+	std := importer.Default()
+
+	var imp importerFunc
+	imp = func(path string) (*types.Package, error) {
+		if pkg, ok := checked[path]; ok {
+			return pkg, nil
+		}
+		src, ok := sources[path]
+		if !ok {
+			return std.Import(path)
+		}
+		file, err := parser.ParseFile(fset, path+".go", src, 0)
+		require.NoError(t, err)
+		checked[path] = checkPackage(fset, []*ast.File{file}, imp)
+		return checked[path], nil
+	}
+
+	pkg, err := imp(name)
+	require.NoError(t, err)
+	return pkg
+}
+
+func TestGenerate(t *testing.T) {
+
+	sources := map[string]string{
+		"base": `package base
+
+type Audit struct {
+	CreatedBy string ` + "`db:\"created_by\"`" + `
+}
+`,
+		"models": `package models
+
+import (
+	"database/sql"
+	"time"
+
+	"base"
+)
+
+type Base struct {
+	ID int ` + "`db:\"id\"`" + `
+}
+
+type Meta struct {
+	Note string ` + "`db:\"note\"`" + `
+}
+
+type User struct {
+	Base
+	base.Audit
+	*Meta
+	time.Time
+	sql.NullString
+	Name    string ` + "`db:\"name\"`" + `
+	Skipped string ` + "`db:\"-\"`" + `
+	NoTag   string
+	Broken  UndefinedType ` + "`db:\"broken\"`" + `
+}
+`,
+	}
+
+	pkg := checkSources(t, token.NewFileSet(), sources, "models")
+
+	code, err := generate(pkg, "User", "users", "u")
+	require.NoError(t, err)
+
+	// Встроенная структура из другого пакета раскрывается, указатель на структуру и сканируемые типы - нет
+	assert.Equal(t, `// Code generated by tablegen. DO NOT EDIT.
+
+package models
+
+import "pkg/sql"
+
+// Колонки таблицы users
+const (
+	UserID        sql.Column = "id"
+	UserCreatedBy sql.Column = "created_by"
+	UserName      sql.Column = "name"
+	UserBroken    sql.Column = "broken"
+)
+
+// UserTable - метаданные таблицы users
+var UserTable = sql.NewTable[User]("users").As("u")
+`, string(code))
+}
+
+func TestToSnakeCase(t *testing.T) {
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "1. Одно слово", in: "User", want: "user"},
+		{name: "2. Несколько слов", in: "UserOrder", want: "user_order"},
+		{name: "3. Аббревиатура в конце", in: "UserID", want: "user_id"},
+		{name: "4. Аббревиатура в начале", in: "HTTPServer", want: "http_server"},
+		{name: "5. Только аббревиатура", in: "ID", want: "id"},
+		{name: "6. Цифры", in: "Order2Item", want: "order2_item"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, toSnakeCase(tt.in))
+		})
+	}
+}
@@ -0,0 +1,330 @@
+package clickhouse
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pkg/backoff"
+	"pkg/errors"
+	"pkg/log"
+	"pkg/sql"
+)
+
+// Ошибки для проверки через errors.Is(err, clickhouse.ErrBufferFull)
+var (
+	ErrBufferFull   = errors.New("batch writer buffer is full")
+	ErrWriterClosed = errors.New("batch writer is closed")
+	ErrRowsDropped  = errors.New("batch writer dropped rows")
+)
+
+// BatchWriterConfig - настройки BatchWriter
+type BatchWriterConfig struct {
+
+	// Сколько строк отправлять одной вставкой, по умолчанию 10000
+	BatchSize int
+
+	// Как часто отправлять неполную пачку, по умолчанию 1 секунда
+	FlushInterval time.Duration
+
+	// Сколько строк можно держать в памяти, после этого Write возвращает ErrBufferFull.
+	// По умолчанию 10 пачек
+	BufferSize int
+
+	// Количество повторов неудачной вставки, по умолчанию 3, отрицательное значение - без повторов.
+	// Задержка перед повтором растет экспоненциально от MinBackoff до MaxBackoff, по умолчанию 100 миллисекунд и 5 секунд
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Директория для строк, которые не удалось вставить после всех повторов. Файлы дозаписываются в ClickHouse
+	// после следующей успешной вставки, в том числе после рестарта. Если пусто, такие строки теряются
+	SpillDir string
+
+	// Сколько раз ClickHouse может отклонить строки файла с диска, например из-за несовпадения типов,
+	// прежде чем файл откладывается в <файл>.failed, а его строки считаются потерянными. По умолчанию 5
+	MaxReplayFailures int
+
+	// Сколько ждать отправку оставшихся строк при остановке, по умолчанию 30 секунд.
+	// Что не успело отправиться, сбрасывается в SpillDir
+	DrainTimeout time.Duration
+
+	// Namespace метрик и реестр, в котором они регистрируются. Если реестр nil, используется глобальный
+	MetricsNamespace string
+	Registerer       prometheus.Registerer
+}
+
+// BatchWriter копит строки типа T в памяти и отправляет их в таблицу нативной пакетной вставкой
+// по размеру пачки или по таймеру. Колонки берутся из тегов db структуры T.
+// Для сброса на диск T должна сериализоваться в JSON без потерь
+type BatchWriter[T any] struct {
+	table   sql.Table[T]
+	cfg     BatchWriterConfig
+	metrics *metrics
+
+	insert func(ctx context.Context, rows []T) error
+
+	mu      sync.Mutex
+	buf     []T
+	closed  bool
+	flushCh chan struct{}
+
+	// Количество файлов в SpillDir, меняется только в горутине Run
+	spillFiles int
+
+	// Файл, который ClickHouse отклонил при дозаписи, и сколько раз подряд, меняются только в горутине Run
+	replayFile     string
+	replayFailures int
+}
+
+// NewBatchWriter создает BatchWriter для таблицы. Строки отправляются только после запуска Run
+func NewBatchWriter[T any](conn driver.Conn, table sql.Table[T], cfg BatchWriterConfig) (*BatchWriter[T], error) {
+
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 10000
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 10 * cfg.BatchSize
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	} else if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = 3
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = 100 * time.Millisecond
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 5 * time.Second
+	}
+	if cfg.DrainTimeout <= 0 {
+		cfg.DrainTimeout = 30 * time.Second
+	}
+	if cfg.MaxReplayFailures <= 0 {
+		cfg.MaxReplayFailures = 5
+	}
+
+	m, err := newMetrics(cfg.MetricsNamespace, cfg.Registerer)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &BatchWriter[T]{
+		table:          table,
+		cfg:            cfg,
+		metrics:        m,
+		insert:         nil,
+		mu:             sync.Mutex{},
+		buf:            make([]T, 0, cfg.BatchSize),
+		closed:         false,
+		flushCh:        make(chan struct{}, 1),
+		spillFiles:     0,
+		replayFile:     "",
+		replayFailures: 0,
+	}
+	w.insert = w.nativeInsert(conn)
+
+	return w, nil
+}
+
+// Write добавляет строки в буфер. Не блокируется на вставке: если буфер заполнен, возвращает ErrBufferFull,
+// после остановки Run - ErrWriterClosed
+func (w *BatchWriter[T]) Write(rows ...T) error {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return errors.Default.Wrap(ErrWriterClosed).WithParams("table", w.table.Name())
+	}
+	if len(w.buf)+len(rows) > w.cfg.BufferSize {
+		w.metrics.rows.WithLabelValues(w.table.Name(), statusDropped).Add(float64(len(rows)))
+		return errors.Default.Wrap(ErrBufferFull).WithParams("table", w.table.Name(), "buffered", len(w.buf))
+	}
+
+	w.buf = append(w.buf, rows...)
+	w.metrics.buffered.WithLabelValues(w.table.Name()).Set(float64(len(w.buf)))
+
+	// Будим Run, не дожидаясь таймера
+	if len(w.buf) >= w.cfg.BatchSize {
+		select {
+		case w.flushCh <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// Run отправляет строки, пока не отменен контекст. После отмены Write перестает принимать строки,
+// а оставшиеся отправляются в течение DrainTimeout. Возвращает ErrRowsDropped, если при остановке строки потерялись
+func (w *BatchWriter[T]) Run(ctx context.Context) error {
+
+	if err := w.countSpillFiles(); err != nil {
+		log.LogError(err)
+	}
+
+	ticker := time.NewTicker(w.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return w.drain(ctx)
+		case <-ticker.C:
+		case <-w.flushCh:
+		}
+		if err := w.flush(ctx); err != nil {
+			log.LogError(err)
+		}
+	}
+}
+
+// drain закрывает буфер и отправляет оставшиеся строки, а что не успело отправиться, сбрасывает на диск
+func (w *BatchWriter[T]) drain(ctx context.Context) error {
+
+	w.mu.Lock()
+	w.closed = true
+	w.mu.Unlock()
+
+	drainCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), w.cfg.DrainTimeout)
+	defer cancel()
+
+	flushErr := w.flush(drainCtx)
+
+	rows := w.take(math.MaxInt)
+	if len(rows) == 0 {
+		return flushErr
+	}
+
+	return w.spill(rows, drainCtx.Err())
+}
+
+// flush отправляет буфер пачками. Если вставка не удалась, пачка сбрасывается на диск,
+// а при отмене контекста возвращается в буфер для drain. После успешной отправки дозаписывает один файл с диска.
+// Возвращает ErrRowsDropped, если строки не удалось ни отправить, ни сбросить на диск
+func (w *BatchWriter[T]) flush(ctx context.Context) error {
+
+	for {
+		rows := w.take(w.cfg.BatchSize)
+		if len(rows) == 0 {
+			break
+		}
+
+		if err := w.send(ctx, rows); err != nil {
+			if ctx.Err() != nil {
+				w.requeue(rows)
+				return nil
+			}
+			return w.spill(rows, err)
+		}
+	}
+
+	if w.spillFiles > 0 {
+		if err := w.replay(ctx); err != nil && ctx.Err() == nil {
+			log.LogError(err)
+		}
+	}
+
+	return nil
+}
+
+// send вставляет пачку с повторами
+func (w *BatchWriter[T]) send(ctx context.Context, rows []T) error {
+
+	for attempt := 0; ; attempt++ {
+
+		started := time.Now()
+		err := w.insert(ctx, rows)
+		w.metrics.flushDuration.WithLabelValues(w.table.Name()).Observe(time.Since(started).Seconds())
+
+		if err == nil {
+			w.metrics.flushes.WithLabelValues(w.table.Name(), statusSuccess).Inc()
+			return nil
+		}
+
+		if attempt >= w.cfg.MaxRetries || ctx.Err() != nil {
+			w.metrics.flushes.WithLabelValues(w.table.Name(), statusFailed).Inc()
+			return errors.Default.Wrap(err).WithParams("table", w.table.Name(), "rows", len(rows), "attempts", attempt+1)
+		}
+		w.metrics.flushes.WithLabelValues(w.table.Name(), statusRetry).Inc()
+
+		if backoff.Sleep(ctx, w.cfg.MinBackoff, w.cfg.MaxBackoff, attempt) != nil {
+			w.metrics.flushes.WithLabelValues(w.table.Name(), statusFailed).Inc()
+			return errors.Default.Wrap(err).WithParams("table", w.table.Name(), "rows", len(rows), "attempts", attempt+1)
+		}
+	}
+}
+
+// take забирает из начала буфера не больше n строк
+func (w *BatchWriter[T]) take(n int) []T {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n = min(n, len(w.buf))
+	if n == 0 {
+		return nil
+	}
+
+	rows := make([]T, n)
+	copy(rows, w.buf)
+	w.buf = append(w.buf[:0], w.buf[n:]...)
+	w.metrics.buffered.WithLabelValues(w.table.Name()).Set(float64(len(w.buf)))
+
+	return rows
+}
+
+// requeue возвращает строки в начало буфера. Лимит BufferSize не проверяется, чтобы не терять уже принятые строки
+func (w *BatchWriter[T]) requeue(rows []T) {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(rows, w.buf...)
+	w.metrics.buffered.WithLabelValues(w.table.Name()).Set(float64(len(w.buf)))
+}
+
+// nativeInsert возвращает функцию вставки через нативный протокол
+func (w *BatchWriter[T]) nativeInsert(conn driver.Conn) func(ctx context.Context, rows []T) error {
+
+	columns := w.table.Columns()
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.String()
+	}
+	query := "INSERT INTO " + w.table.Name() + " (" + strings.Join(names, ", ") + ")"
+
+	return func(ctx context.Context, rows []T) error {
+
+		batch, err := conn.PrepareBatch(ctx, query)
+		if err != nil {
+			return errors.Default.Wrap(err)
+		}
+
+		values := make([]any, len(columns))
+		for _, row := range rows {
+			for i, column := range columns {
+				values[i], _ = w.table.Value(row, column)
+			}
+			if err = batch.Append(values...); err != nil {
+				_ = batch.Abort()
+				return errors.Default.Wrap(err)
+			}
+		}
+
+		if err = batch.Send(); err != nil {
+			return errors.Default.Wrap(err)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,193 @@
+package clickhouse
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pkg/errors"
+	"pkg/sql"
+)
+
+type event struct {
+	ID   int    `db:"id"   json:"id"`
+	Name string `db:"name" json:"name"`
+}
+
+var events = sql.NewTable[event]("events")
+
+// fakeInsert запоминает вставленные строки и возвращает ошибку, пока failing = true.
+// Если err не задана, возвращается сетевая ошибка
+type fakeInsert struct {
+	mu      sync.Mutex
+	failing bool
+	err     error
+	calls   int
+	rows    []event
+}
+
+func (f *fakeInsert) insert(_ context.Context, rows []event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls++
+	if f.failing {
+		if f.err != nil {
+			return f.err
+		}
+		return errors.New("connection refused")
+	}
+	f.rows = append(f.rows, rows...)
+	return nil
+}
+
+func (f *fakeInsert) inserted() []event {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]event(nil), f.rows...)
+}
+
+func newTestWriter(t *testing.T, cfg BatchWriterConfig) (*BatchWriter[event], *fakeInsert) {
+	t.Helper()
+
+	cfg.Registerer = prometheus.NewRegistry()
+	cfg.MinBackoff = time.Millisecond
+	cfg.MaxBackoff = time.Millisecond
+
+	w, err := NewBatchWriter[event](nil, events, cfg)
+	require.NoError(t, err)
+
+	fake := &fakeInsert{}
+	w.insert = fake.insert
+
+	return w, fake
+}
+
+func TestBatchWriter(t *testing.T) {
+
+	ctx := context.Background()
+
+	t.Run("1. Отправка по размеру пачки", func(t *testing.T) {
+		w, fake := newTestWriter(t, BatchWriterConfig{BatchSize: 2, FlushInterval: time.Hour})
+
+		require.NoError(t, w.Write(event{ID: 1}, event{ID: 2}, event{ID: 3}))
+		require.NoError(t, w.flush(ctx))
+
+		assert.Len(t, fake.inserted(), 3)
+		assert.Equal(t, 2, fake.calls)
+	})
+
+	t.Run("2. Переполнение буфера", func(t *testing.T) {
+		w, _ := newTestWriter(t, BatchWriterConfig{BatchSize: 1, BufferSize: 2})
+
+		require.NoError(t, w.Write(event{ID: 1}, event{ID: 2}))
+		assert.True(t, errors.Is(w.Write(event{ID: 3}), ErrBufferFull))
+	})
+
+	t.Run("3. Сброс на диск и дозапись", func(t *testing.T) {
+		dir := t.TempDir()
+		w, fake := newTestWriter(t, BatchWriterConfig{BatchSize: 10, MaxRetries: 2, SpillDir: dir})
+
+		fake.failing = true
+		require.NoError(t, w.Write(event{ID: 1, Name: "a"}, event{ID: 2, Name: "b"}))
+		require.NoError(t, w.flush(ctx))
+
+		assert.Equal(t, 3, fake.calls)
+		assert.Equal(t, 1, w.spillFiles)
+		files, _ := filepath.Glob(filepath.Join(dir, "events-*.jsonl"))
+		require.Len(t, files, 1)
+
+		// После восстановления сначала отправляются новые строки, затем файл с диска
+		fake.failing = false
+		require.NoError(t, w.Write(event{ID: 3, Name: "c"}))
+		require.NoError(t, w.flush(ctx))
+
+		assert.Equal(t, []event{{ID: 3, Name: "c"}, {ID: 1, Name: "a"}, {ID: 2, Name: "b"}}, fake.inserted())
+		assert.Equal(t, 0, w.spillFiles)
+		files, _ = filepath.Glob(filepath.Join(dir, "events-*.jsonl"))
+		assert.Empty(t, files)
+	})
+
+	t.Run("4. Файлы с прошлого запуска и битый файл", func(t *testing.T) {
+		dir := t.TempDir()
+		w, fake := newTestWriter(t, BatchWriterConfig{BatchSize: 10, SpillDir: dir})
+
+		_, err := w.writeSpillFile(filepath.Join(dir, "events-1.jsonl"), []event{{ID: 1}})
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "events-0.jsonl"), []byte("{broken"), 0o600))
+		require.NoError(t, w.countSpillFiles())
+		assert.Equal(t, 2, w.spillFiles)
+
+		require.NoError(t, w.flush(ctx))
+		assert.FileExists(t, filepath.Join(dir, "events-0.jsonl"+spillCorruptExt))
+
+		require.NoError(t, w.flush(ctx))
+		assert.Equal(t, []event{{ID: 1}}, fake.inserted())
+		assert.Equal(t, 0, w.spillFiles)
+	})
+
+	t.Run("5. Остановка отправляет оставшиеся строки", func(t *testing.T) {
+		w, fake := newTestWriter(t, BatchWriterConfig{BatchSize: 100, FlushInterval: time.Hour})
+
+		runCtx, cancel := context.WithCancel(ctx)
+		done := make(chan error)
+		go func() { done <- w.Run(runCtx) }()
+
+		require.NoError(t, w.Write(event{ID: 1}, event{ID: 2}))
+		cancel()
+		require.NoError(t, <-done)
+
+		assert.Len(t, fake.inserted(), 2)
+		assert.True(t, errors.Is(w.Write(event{ID: 3}), ErrWriterClosed))
+	})
+
+	t.Run("6. Потеря строк при остановке без директории", func(t *testing.T) {
+		w, fake := newTestWriter(t, BatchWriterConfig{BatchSize: 100, MaxRetries: -1, DrainTimeout: time.Second})
+		fake.failing = true
+
+		require.NoError(t, w.Write(event{ID: 1}))
+
+		runCtx, cancel := context.WithCancel(ctx)
+		cancel()
+		assert.True(t, errors.Is(w.Run(runCtx), ErrRowsDropped))
+	})
+
+	t.Run("7. Отклоненный файл откладывается и не блокирует более новые", func(t *testing.T) {
+		dir := t.TempDir()
+		w, fake := newTestWriter(t, BatchWriterConfig{BatchSize: 10, MaxRetries: -1, SpillDir: dir, MaxReplayFailures: 2})
+
+		_, err := w.writeSpillFile(filepath.Join(dir, "events-0.jsonl"), []event{{ID: 1}, {ID: 2}})
+		require.NoError(t, err)
+		_, err = w.writeSpillFile(filepath.Join(dir, "events-1.jsonl"), []event{{ID: 3}})
+		require.NoError(t, err)
+		require.NoError(t, w.countSpillFiles())
+
+		// Недоступность ClickHouse не считается отказом файла
+		fake.failing = true
+		for range 3 {
+			require.NoError(t, w.flush(ctx))
+		}
+		assert.FileExists(t, filepath.Join(dir, "events-0.jsonl"))
+
+		fake.err = &proto.Exception{Code: 53, Name: "DB::Exception", Message: "Type mismatch", StackTrace: "", Nested: nil}
+		require.NoError(t, w.flush(ctx))
+		assert.FileExists(t, filepath.Join(dir, "events-0.jsonl"))
+
+		require.NoError(t, w.flush(ctx))
+		assert.FileExists(t, filepath.Join(dir, "events-0.jsonl"+spillFailedExt))
+		assert.Equal(t, 1, w.spillFiles)
+
+		fake.failing = false
+		require.NoError(t, w.flush(ctx))
+		assert.Equal(t, []event{{ID: 3}}, fake.inserted())
+		assert.Equal(t, 0, w.spillFiles)
+	})
+}
@@ -2,18 +2,23 @@ package clickhouse
 
 import (
 	"context"
-	"fmt"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 
 	"pkg/database"
+	"pkg/errors"
 	"pkg/sql"
-
-	_ "github.com/ClickHouse/clickhouse-go/v2"
 )
 
+// Значения по умолчанию для пула соединений и запросов
 const (
-	maxOpenConns = 10
-	maxIdleConns = 5
-	maxBlockSize = 10
+	defaultMaxOpenConns    = 10
+	defaultMaxIdleConns    = 5
+	defaultMaxBlockSize    = 10
+	defaultDialTimeout     = time.Second
+	defaultConnMaxLifetime = time.Hour
 )
 
 type ClickhouseConfig struct {
@@ -21,38 +26,120 @@ type ClickhouseConfig struct {
 	User         string `env:"CLICKHOUSE_USER"`
 	Password     string `env:"CLICKHOUSE_PASSWORD"`
 	DatabaseName string `env:"CLICKHOUSE_DATABASE"`
+
+	// Размеры пула, по умолчанию 10 открытых и 5 простаивающих соединений
+	MaxOpenConns int `env:"CLICKHOUSE_MAX_OPEN_CONNS" envDefault:""`
+	MaxIdleConns int `env:"CLICKHOUSE_MAX_IDLE_CONNS" envDefault:""`
+
+	// Время жизни соединения, по умолчанию 1 час
+	ConnMaxLifetime time.Duration `env:"CLICKHOUSE_CONN_MAX_LIFETIME" envDefault:""`
+
+	// Таймаут установки соединения, по умолчанию 1 секунда
+	DialTimeout time.Duration `env:"CLICKHOUSE_DIAL_TIMEOUT" envDefault:""`
+
+	// Максимальное время выполнения запроса на стороне сервера (max_execution_time), 0 - без ограничений
+	StatementTimeout time.Duration `env:"CLICKHOUSE_STATEMENT_TIMEOUT" envDefault:""`
+
+	// Размер блока при чтении (max_block_size), по умолчанию 10
+	MaxBlockSize int `env:"CLICKHOUSE_MAX_BLOCK_SIZE" envDefault:""`
+
+	// Подключение по TLS
+	Secure bool `env:"CLICKHOUSE_SECURE" envDefault:""`
+
+	// Путь к сертификату центра сертификации, пути к клиентскому сертификату и ключу
+	CACert string `env:"CLICKHOUSE_CA_CERT" envDefault:""`
+	Cert   string `env:"CLICKHOUSE_CERT" envDefault:""`
+	Key    string `env:"CLICKHOUSE_KEY" envDefault:""`
+
+	// Отключение проверки сертификата сервера
+	InsecureSkipVerify bool `env:"CLICKHOUSE_INSECURE_SKIP_VERIFY" envDefault:""`
 }
 
 func NewClientClickhouse(config ClickhouseConfig) (*sql.DB, error) {
 
-	db, err := sql.Open("clickhouse", config.getConnectionURI())
-
+	options, err := config.getOptions()
 	if err != nil {
 		return nil, err
 	}
 
+	db := sql.NewDB(clickhouse.OpenDB(options), "clickhouse")
+
 	ctx, cancel := context.WithTimeout(context.Background(), database.ConnectionTimeout)
 	defer cancel()
 
 	if err = db.Ping(ctx); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
 
+	// Экспортируем статистику пула в Prometheus
+	if err = db.RegisterPoolMetrics(nil, "clickhouse_"+config.DatabaseName+"@"+config.Host); err != nil {
+		_ = db.Close()
 		return nil, err
 	}
 
 	return db, err
 }
 
-func (c *ClickhouseConfig) getConnectionURI() string {
-	return fmt.Sprintf("clickhouse://%s:%s@%s/%s?dial_timeout=%v&max_open_conns=%v&max_idle_conns=%v&conn_max_lifetime=%v&max_block_size=%v",
-		c.User,
-		c.Password,
-		c.Host,
-		c.DatabaseName,
-		"1s",         // dial_timeout
-		maxOpenConns, // max_open_conns
-		maxIdleConns, // max_idle_conns
-		"1h",         // conn_max_lifetime
-		maxBlockSize, // max_block_size
-	)
+// NewConnClickhouse создает нативное соединение для пакетной вставки через BatchWriter
+func NewConnClickhouse(config ClickhouseConfig) (driver.Conn, error) {
+
+	options, err := config.getOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := clickhouse.Open(options)
+	if err != nil {
+		return nil, errors.Default.Wrap(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), database.ConnectionTimeout)
+	defer cancel()
+
+	if err = conn.Ping(ctx); err != nil {
+		_ = conn.Close()
+		return nil, errors.Default.Wrap(err)
+	}
+
+	return conn, nil
+}
+
+// getOptions формирует настройки драйвера. Учетные данные передаются отдельно от адреса, поэтому не требуют экранирования
+func (c *ClickhouseConfig) getOptions() (*clickhouse.Options, error) {
 
+	options := new(clickhouse.Options)
+	options.Addr = []string{c.Host}
+	options.Auth = clickhouse.Auth{
+		Database: c.DatabaseName,
+		Username: c.User,
+		Password: c.Password,
+	}
+	options.MaxOpenConns = valueOrDefault(c.MaxOpenConns, defaultMaxOpenConns)
+	options.MaxIdleConns = valueOrDefault(c.MaxIdleConns, defaultMaxIdleConns)
+	options.ConnMaxLifetime = valueOrDefault(c.ConnMaxLifetime, defaultConnMaxLifetime)
+	options.DialTimeout = valueOrDefault(c.DialTimeout, defaultDialTimeout)
+	options.Settings = clickhouse.Settings{
+		"max_block_size": valueOrDefault(c.MaxBlockSize, defaultMaxBlockSize),
+	}
+	if c.StatementTimeout > 0 {
+		options.Settings["max_execution_time"] = max(1, int(c.StatementTimeout.Seconds()))
+	}
+
+	if c.Secure {
+		tlsConfig, err := database.NewTLSConfig(c.CACert, c.Cert, c.Key, c.InsecureSkipVerify)
+		if err != nil {
+			return nil, err
+		}
+		options.TLS = tlsConfig
+	}
+
+	return options, nil
+}
+
+func valueOrDefault[T int | time.Duration](value, defaultValue T) T {
+	if value <= 0 {
+		return defaultValue
+	}
+	return value
 }
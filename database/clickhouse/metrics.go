@@ -0,0 +1,97 @@
+package clickhouse
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pkg/promUtils"
+)
+
+// Что произошло со строками в метриках BatchWriter
+const (
+	statusWritten  = "written"
+	statusSpilled  = "spilled"
+	statusReplayed = "replayed"
+	statusDropped  = "dropped"
+)
+
+// Результат попытки отправки пачки в метриках BatchWriter
+const (
+	statusSuccess = "success"
+	statusRetry   = "retry"
+	statusFailed  = "failed"
+)
+
+// metrics - метрики BatchWriter
+type metrics struct {
+	rows          *prometheus.CounterVec
+	flushes       *prometheus.CounterVec
+	flushDuration *prometheus.HistogramVec
+	buffered      *prometheus.GaugeVec
+	spillFiles    *prometheus.GaugeVec
+}
+
+func newMetrics(namespace string, registerer prometheus.Registerer) (*metrics, error) {
+
+	m := &metrics{
+		rows: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   "clickhouse_batch",
+			Name:        "rows_total",
+			Help:        "Total number of rows passed through clickhouse batch writers by result.",
+			ConstLabels: nil,
+		}, []string{"table", "status"}),
+		flushes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   "clickhouse_batch",
+			Name:        "flushes_total",
+			Help:        "Total number of clickhouse batch insert attempts by result.",
+			ConstLabels: nil,
+		}, []string{"table", "status"}),
+		flushDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:                       namespace,
+			Subsystem:                       "clickhouse_batch",
+			Name:                            "flush_duration_seconds",
+			Help:                            "A histogram of the duration (seconds) of clickhouse batch inserts.",
+			ConstLabels:                     nil,
+			Buckets:                         prometheus.DefBuckets,
+			NativeHistogramBucketFactor:     0,
+			NativeHistogramZeroThreshold:    0,
+			NativeHistogramMaxBucketNumber:  0,
+			NativeHistogramMinResetDuration: 0,
+			NativeHistogramMaxZeroThreshold: 0,
+		}, []string{"table"}),
+		buffered: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   "clickhouse_batch",
+			Name:        "buffered_rows",
+			Help:        "Number of rows buffered in memory and waiting for flush.",
+			ConstLabels: nil,
+		}, []string{"table"}),
+		spillFiles: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   "clickhouse_batch",
+			Name:        "spill_files",
+			Help:        "Number of spill files on local disk waiting for replay.",
+			ConstLabels: nil,
+		}, []string{"table"}),
+	}
+
+	var err error
+	if m.rows, err = promUtils.Register(registerer, m.rows); err != nil {
+		return nil, err
+	}
+	if m.flushes, err = promUtils.Register(registerer, m.flushes); err != nil {
+		return nil, err
+	}
+	if m.flushDuration, err = promUtils.Register(registerer, m.flushDuration); err != nil {
+		return nil, err
+	}
+	if m.buffered, err = promUtils.Register(registerer, m.buffered); err != nil {
+		return nil, err
+	}
+	if m.spillFiles, err = promUtils.Register(registerer, m.spillFiles); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
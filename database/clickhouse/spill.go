@@ -0,0 +1,258 @@
+package clickhouse
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
+
+	"pkg/errors"
+	"pkg/log"
+	"pkg/sql"
+)
+
+// Файлы сброса на диск: <таблица>-<время>-<номер>.jsonl, одна строка JSON на строку таблицы
+// Нечитаемые файлы переименовываются в <файл>.corrupt, а файлы, которые ClickHouse отклоняет, - в <файл>.failed.
+// Такие файлы больше не дозаписываются
+const (
+	spillExt        = ".jsonl"
+	spillCorruptExt = ".corrupt"
+	spillFailedExt  = ".failed"
+)
+
+var (
+	spillUnsafeChars = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+	spillSeq         atomic.Uint64
+)
+
+// spill сбрасывает строки на диск, а если SpillDir не задан или запись не удалась - считает их потерянными
+func (w *BatchWriter[T]) spill(rows []T, cause error) error {
+
+	if w.cfg.SpillDir == "" {
+		return w.drop(rows, cause)
+	}
+
+	path, err := w.writeSpillFile("", rows)
+	if err != nil {
+		return w.drop(rows, err)
+	}
+
+	w.spillFiles++
+	w.metrics.spillFiles.WithLabelValues(w.table.Name()).Set(float64(w.spillFiles))
+	w.metrics.rows.WithLabelValues(w.table.Name(), statusSpilled).Add(float64(len(rows)))
+
+	params := []any{"table", w.table.Name(), "rows", len(rows), "file", path}
+	if cause != nil {
+		params = append(params, "reason", cause.Error())
+	}
+	log.WithParams(params...).Warning("clickhouse batch spilled to disk")
+
+	return nil
+}
+
+// drop учитывает потерянные строки
+func (w *BatchWriter[T]) drop(rows []T, cause error) error {
+
+	w.metrics.rows.WithLabelValues(w.table.Name(), statusDropped).Add(float64(len(rows)))
+
+	params := []any{"table", w.table.Name(), "rows", len(rows)}
+	if cause != nil {
+		params = append(params, "reason", cause.Error())
+	}
+	return errors.Default.Wrap(ErrRowsDropped).WithParams(params...)
+}
+
+// replay дозаписывает самый старый файл с диска. Если вставка не удалась на середине файла,
+// в файле остаются только неотправленные строки, чтобы не вставить их дважды
+func (w *BatchWriter[T]) replay(ctx context.Context) error {
+
+	files, err := w.listSpillFiles()
+	if err != nil {
+		return err
+	}
+	w.spillFiles = len(files)
+	w.metrics.spillFiles.WithLabelValues(w.table.Name()).Set(float64(w.spillFiles))
+	if len(files) == 0 {
+		return nil
+	}
+
+	path := files[0]
+	rows, err := readSpillFile[T](path)
+	if err != nil {
+
+		// Битый файл откладываем в сторону, иначе он заблокирует дозапись остальных
+		if renameErr := os.Rename(path, path+spillCorruptExt); renameErr != nil {
+			return errors.Default.Wrap(err).WithParams("renameError", renameErr.Error())
+		}
+		w.spillFiles--
+		w.metrics.spillFiles.WithLabelValues(w.table.Name()).Set(float64(w.spillFiles))
+		return err
+	}
+
+	for sent := 0; sent < len(rows); sent += w.cfg.BatchSize {
+		batch := rows[sent:min(sent+w.cfg.BatchSize, len(rows))]
+
+		if err = w.send(ctx, batch); err != nil {
+			if sent > 0 {
+				if _, rewriteErr := w.writeSpillFile(path, rows[sent:]); rewriteErr != nil {
+					return errors.Default.Wrap(err).WithParams("rewriteError", rewriteErr.Error())
+				}
+			}
+			return w.replayFailed(path, sent > 0, rows[sent:], err)
+		}
+		w.metrics.rows.WithLabelValues(w.table.Name(), statusReplayed).Add(float64(len(batch)))
+	}
+
+	if err = os.Remove(path); err != nil {
+		return errors.Default.Wrap(err).WithParams("file", path)
+	}
+	w.replayFile, w.replayFailures = "", 0
+	w.spillFiles--
+	w.metrics.spillFiles.WithLabelValues(w.table.Name()).Set(float64(w.spillFiles))
+
+	log.WithParams("table", w.table.Name(), "rows", len(rows), "file", path).Info("clickhouse spill file replayed")
+
+	return nil
+}
+
+// replayFailed считает, сколько раз подряд ClickHouse отклонил строки файла, и после MaxReplayFailures откладывает файл,
+// иначе он навсегда заблокирует дозапись более новых файлов. Сетевые и временные ошибки не учитываются,
+// чтобы недоступность ClickHouse не приводила к потере файлов
+func (w *BatchWriter[T]) replayFailed(path string, progressed bool, rows []T, err error) error {
+
+	if path != w.replayFile || progressed {
+		w.replayFile, w.replayFailures = path, 0
+	}
+
+	var chErr *proto.Exception
+	if !errors.As(err, &chErr) || sql.IsRetryable(err) {
+		return err
+	}
+
+	w.replayFailures++
+	if w.replayFailures < w.cfg.MaxReplayFailures {
+		return err
+	}
+
+	if renameErr := os.Rename(path, path+spillFailedExt); renameErr != nil {
+		return errors.Default.Wrap(err).WithParams("renameError", renameErr.Error())
+	}
+	w.replayFile, w.replayFailures = "", 0
+	w.spillFiles--
+	w.metrics.spillFiles.WithLabelValues(w.table.Name()).Set(float64(w.spillFiles))
+
+	log.WithParams("table", w.table.Name(), "rows", len(rows), "file", path+spillFailedExt).
+		Warning("clickhouse spill file rejected, moved aside")
+
+	return w.drop(rows, err)
+}
+
+// countSpillFiles считает файлы, оставшиеся с прошлого запуска
+func (w *BatchWriter[T]) countSpillFiles() error {
+
+	if w.cfg.SpillDir == "" {
+		return nil
+	}
+
+	files, err := w.listSpillFiles()
+	if err != nil {
+		return err
+	}
+	w.spillFiles = len(files)
+	w.metrics.spillFiles.WithLabelValues(w.table.Name()).Set(float64(w.spillFiles))
+
+	return nil
+}
+
+// listSpillFiles возвращает файлы таблицы от старых к новым
+func (w *BatchWriter[T]) listSpillFiles() ([]string, error) {
+
+	files, err := filepath.Glob(filepath.Join(w.cfg.SpillDir, w.spillPrefix()+"-*"+spillExt))
+	if err != nil {
+		return nil, errors.Default.Wrap(err)
+	}
+	slices.Sort(files)
+
+	return files, nil
+}
+
+// writeSpillFile записывает строки во временный файл и переименовывает его, чтобы replay не прочитал
+// недописанный файл. Если path пустой, создается новый файл
+func (w *BatchWriter[T]) writeSpillFile(path string, rows []T) (string, error) {
+
+	if err := os.MkdirAll(w.cfg.SpillDir, 0o750); err != nil {
+		return "", errors.Default.Wrap(err).WithParams("dir", w.cfg.SpillDir)
+	}
+
+	if path == "" {
+		// Время с нулями слева, чтобы сортировка по имени совпадала с порядком записи
+		name := fmt.Sprintf("%s-%020d-%06d%s", w.spillPrefix(), time.Now().UnixNano(), spillSeq.Add(1)%1000000, spillExt)
+		path = filepath.Join(w.cfg.SpillDir, name)
+	}
+
+	tmp, err := os.CreateTemp(w.cfg.SpillDir, ".spill-*")
+	if err != nil {
+		return "", errors.Default.Wrap(err).WithParams("dir", w.cfg.SpillDir)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	buf := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(buf)
+	for _, row := range rows {
+		if err = encoder.Encode(row); err != nil {
+			_ = tmp.Close()
+			return "", errors.Default.Wrap(err).WithParams("file", path)
+		}
+	}
+	if err = buf.Flush(); err != nil {
+		_ = tmp.Close()
+		return "", errors.Default.Wrap(err).WithParams("file", path)
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return "", errors.Default.Wrap(err).WithParams("file", path)
+	}
+	if err = tmp.Close(); err != nil {
+		return "", errors.Default.Wrap(err).WithParams("file", path)
+	}
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return "", errors.Default.Wrap(err).WithParams("file", path)
+	}
+
+	return path, nil
+}
+
+// spillPrefix - префикс файлов таблицы, безопасный для имени файла
+func (w *BatchWriter[T]) spillPrefix() string {
+	return spillUnsafeChars.ReplaceAllString(w.table.Name(), "_")
+}
+
+func readSpillFile[T any](path string) ([]T, error) {
+
+	file, err := os.Open(path) //nolint:gosec // Путь строится из SpillDir и имени таблицы
+	if err != nil {
+		return nil, errors.Default.Wrap(err).WithParams("file", path)
+	}
+	defer func() { _ = file.Close() }()
+
+	var rows []T
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for decoder.More() {
+		var row T
+		if err = decoder.Decode(&row); err != nil {
+			return nil, errors.Default.Wrap(err).WithParams("file", path)
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
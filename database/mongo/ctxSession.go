@@ -0,0 +1,93 @@
+package mongo
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"pkg/errors"
+)
+
+// InjectSession кладет сессию в контекст. Драйвер сам использует сессию из контекста во всех операциях
+func InjectSession(ctx context.Context, sess mongo.Session) context.Context {
+	return mongo.NewSessionContext(ctx, sess)
+}
+
+// ExtractSession возвращает сессию из контекста или nil
+func ExtractSession(ctx context.Context) mongo.Session {
+	return mongo.SessionFromContext(ctx)
+}
+
+// InTx выполняет fn в транзакции, сессия которой передается в fn через контекст.
+// Если fn вернула ошибку, транзакция откатывается, иначе коммитится.
+// Если в контексте уже есть сессия, fn выполняется в ней без новой транзакции.
+// Драйвер повторяет транзакцию целиком при временных ошибках, поэтому fn должна быть идемпотентной
+// вне базы данных. opts может быть nil, тогда используются настройки клиента
+func InTx(ctx context.Context, client *mongo.Client, opts *options.TransactionOptions, fn func(ctx context.Context) error) error {
+
+	// Mongo не поддерживает вложенные транзакции, поэтому присоединяемся к внешней
+	if ExtractSession(ctx) != nil {
+		return fn(ctx)
+	}
+
+	sess, err := client.StartSession()
+	if err != nil {
+		return wrapMongoError(err)
+	}
+	defer sess.EndSession(context.WithoutCancel(ctx))
+
+	_, err = sess.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (any, error) {
+		return nil, labeledTxError(fn(sessCtx))
+	}, opts)
+	if err != nil {
+
+		// Ошибки fn возвращаем как есть, чтобы не терять их тип
+		var txErr txError
+		if errors.As(err, &txErr) {
+			return txErr.err
+		}
+		var pkgErr errors.Error
+		if errors.As(err, &pkgErr) {
+			return err
+		}
+		return wrapMongoError(err)
+	}
+
+	return nil
+}
+
+// txError отдает драйверу метки ошибки Mongo, завернутой в errors.Error.
+// Драйвер ищет метку TransientTransactionError только через Unwrap() error, которого у errors.Error нет,
+// и без этой обертки не повторял бы транзакцию при конфликтах записи в методах Repository
+type txError struct {
+	err     error
+	labeled mongo.LabeledError
+}
+
+func (e txError) Error() string {
+	return e.err.Error()
+}
+
+func (e txError) HasErrorLabel(label string) bool {
+	return e.labeled.HasErrorLabel(label)
+}
+
+func (e txError) Unwrap() error {
+	return e.err
+}
+
+// labeledTxError оборачивает ошибку в txError, если внутри нее есть ошибка драйвера с метками
+func labeledTxError(err error) error {
+
+	if err == nil {
+		return nil
+	}
+
+	var labeled mongo.LabeledError
+	if !errors.As(err, &labeled) {
+		return err
+	}
+
+	return txError{err: err, labeled: labeled}
+}
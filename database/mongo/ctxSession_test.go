@@ -0,0 +1,70 @@
+package mongo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"pkg/errors"
+)
+
+func TestInTx(t *testing.T) {
+
+	ctx := context.Background()
+
+	// Подключение ленивое, а транзакция без операций не обращается к серверу
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://127.0.0.1:1"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Disconnect(ctx) })
+
+	writeConflict := mongo.CommandError{
+		Code:    112,
+		Message: "WriteConflict",
+		Labels:  []string{"TransientTransactionError"},
+		Name:    "WriteConflict",
+		Wrapped: nil,
+		Raw:     nil,
+	}
+
+	t.Run("1. Временная ошибка из Repository повторяется", func(t *testing.T) {
+		calls := 0
+		err := InTx(ctx, client, nil, func(ctx context.Context) error {
+			calls++
+			assert.NotNil(t, ExtractSession(ctx))
+			if calls == 1 {
+				return wrapMongoError(writeConflict)
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("2. Ошибка fn возвращается как есть", func(t *testing.T) {
+		calls := 0
+		err := InTx(ctx, client, nil, func(context.Context) error {
+			calls++
+			return wrapMongoError(mongo.ErrNoDocuments)
+		})
+		assert.Equal(t, 1, calls)
+		assert.True(t, errors.Is(err, ErrNotFound))
+
+		var pkgErr errors.Error
+		require.True(t, errors.As(err, &pkgErr))
+		assert.Equal(t, NotFound.HTTPCode, pkgErr.ErrorType.HTTPCode)
+	})
+
+	t.Run("3. Вложенный вызов использует внешнюю сессию", func(t *testing.T) {
+		err := InTx(ctx, client, nil, func(outer context.Context) error {
+			return InTx(outer, client, nil, func(inner context.Context) error {
+				assert.Same(t, ExtractSession(outer), ExtractSession(inner))
+				return nil
+			})
+		})
+		require.NoError(t, err)
+	})
+}
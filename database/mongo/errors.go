@@ -0,0 +1,46 @@
+package mongo
+
+import (
+	"context"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"pkg/errors"
+)
+
+// Типы ошибок, в которые wrapMongoError оборачивает ошибки драйвера
+var (
+	NotFound = errors.ErrorType{
+		Name:      "NotFound",
+		HTTPCode:  http.StatusNotFound,
+		LogAs:     errors.LogAsWarning,
+		HumanText: "",
+	}
+	Conflict = errors.ErrorType{
+		Name:      "Conflict",
+		HTTPCode:  http.StatusConflict,
+		LogAs:     errors.LogAsWarning,
+		HumanText: "",
+	}
+)
+
+// Ошибки для проверки через errors.Is(err, mongo.ErrNotFound)
+var (
+	ErrNotFound     = mongo.ErrNoDocuments
+	ErrDuplicateKey = errors.New("duplicate key")
+)
+
+func wrapMongoError(err error) error {
+
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return errors.Default.Wrap(err).SkipPreviousCaller()
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return NotFound.Wrap(err).SkipPreviousCaller()
+	case mongo.IsDuplicateKeyError(err):
+		return Conflict.Wrap(err).SkipPreviousCaller().WithAdditionalError(ErrDuplicateKey)
+	}
+
+	return errors.Default.Wrap(err).SkipPreviousCaller()
+}
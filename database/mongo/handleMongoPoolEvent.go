@@ -6,36 +6,43 @@ import (
 	"pkg/log"
 )
 
+// HandlePoolEvent пишет событие пула в метрики последнего созданного через NewMetric или NewClientMongo клиента.
+//
+// Deprecated: используйте PoolMonitor или метод HandlePoolEvent метрик, созданных через NewMetric
 func HandlePoolEvent(evt *event.PoolEvent) {
-	if globalMetric.mongoPoolEventsMetric == nil {
+	metric := globalMetric.Load()
+	if metric == nil {
 		log.Error("mongoPoolEventsMetric prometheus metric not initialized")
 		return
 	}
+	metric.HandlePoolEvent(evt)
+}
 
+func (m *Metric) HandlePoolEvent(evt *event.PoolEvent) {
 	switch evt.Type {
 	case event.PoolCreated:
-		poolEvent("connection_pool_created")
+		m.poolEvent("connection_pool_created")
 	case event.PoolCleared:
-		poolEvent("connection_pool_cleared")
+		m.poolEvent("connection_pool_cleared")
 	case event.PoolClosedEvent:
-		poolEvent("connection_pool_closed")
+		m.poolEvent("connection_pool_closed")
 	case event.ConnectionCreated:
-		poolEvent("connection_created")
+		m.poolEvent("connection_created")
 	case event.ConnectionReady:
-		poolEvent("connection_ready")
+		m.poolEvent("connection_ready")
 	case event.ConnectionClosed:
-		poolEvent("connection_closed")
+		m.poolEvent("connection_closed")
 	case event.GetStarted:
-		poolEvent("connection_started")
+		m.poolEvent("connection_started")
 	case event.GetFailed:
-		poolEvent("connection_failed")
+		m.poolEvent("connection_failed")
 	case event.GetSucceeded:
-		poolEvent("connection_succeeded")
+		m.poolEvent("connection_succeeded")
 	case event.ConnectionReturned:
-		poolEvent("connection_returned")
+		m.poolEvent("connection_returned")
 	}
 }
 
-func poolEvent(event string) {
-	globalMetric.mongoPoolEventsMetric.WithLabelValues(globalMetric.namespace, event).Inc()
+func (m *Metric) poolEvent(event string) {
+	m.mongoPoolEventsMetric.WithLabelValues(m.namespace, event).Inc()
 }
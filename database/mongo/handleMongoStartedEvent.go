@@ -2,20 +2,58 @@ package mongo
 
 import (
 	"context"
+	"time"
 
 	"go.mongodb.org/mongo-driver/event"
 )
 
+const (
+	// staleCommandTTL - через сколько команда без события завершения удаляется из монитора
+	staleCommandTTL = 10 * time.Minute
+
+	// sweepInterval - как часто искать такие команды
+	sweepInterval = time.Minute
+)
+
 func (m *Monitor) HandleStartedEvent(_ context.Context, evt *event.CommandStartedEvent) {
 	collectionRaw := evt.Command.Lookup(evt.CommandName)
 	collection, _ := collectionRaw.StringValueOK()
 
+	now := time.Now()
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	// Сохраняем только то, что нужно для меток, без самой команды, которая может быть большой
 	m.commands[evt.RequestID] = command{
 		database:   evt.DatabaseName,
 		collection: collection,
-		raw:        evt.Command,
+		startedAt:  now,
 	}
+
+	// Драйвер не гарантирует событие завершения для каждой команды, поэтому периодически чистим зависшие
+	if now.Sub(m.lastSweep) >= sweepInterval {
+		m.sweep(now)
+	}
+}
+
+// sweep удаляет команды, для которых не пришло событие завершения. Вызывается под m.mu
+func (m *Monitor) sweep(now time.Time) {
+	for requestID, cmd := range m.commands {
+		if now.Sub(cmd.startedAt) > staleCommandTTL {
+			delete(m.commands, requestID)
+		}
+	}
+	m.lastSweep = now
+}
+
+// pop возвращает и удаляет команду
+func (m *Monitor) pop(requestID int64) command {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cmd := m.commands[requestID]
+	delete(m.commands, requestID)
+
+	return cmd
 }
@@ -3,8 +3,9 @@ package mongo
 import (
 	"context"
 	"sync"
+	"sync/atomic"
+	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 
@@ -15,6 +16,7 @@ import (
 
 	"pkg/database"
 	"pkg/errors"
+	"pkg/promUtils"
 )
 
 const (
@@ -43,21 +45,30 @@ type (
 
 	Monitor struct {
 		namespace string
+		metric    *Metric
 
-		mu       sync.Mutex
-		commands map[int64]command
+		mu        sync.Mutex
+		commands  map[int64]command
+		lastSweep time.Time
 	}
 
 	command struct {
 		database   string
 		collection string
-		raw        bson.Raw
+		startedAt  time.Time
 	}
 )
 
-var globalMetric *Metric
+// globalMetric - метрики последнего созданного клиента для пакетной функции HandlePoolEvent
+var globalMetric atomic.Pointer[Metric]
 
 func NewClientMongo(conf SettingsMongoConfig, namespace string) (*mongo.Database, error) {
+	return NewClientMongoWithRegisterer(conf, namespace, nil)
+}
+
+// NewClientMongoWithRegisterer создает клиент и регистрирует метрики в registerer, если nil - в глобальном реестре.
+// Повторный вызов переиспользует уже зарегистрированные метрики
+func NewClientMongoWithRegisterer(conf SettingsMongoConfig, namespace string, registerer prometheus.Registerer) (*mongo.Database, error) {
 
 	opt := options.Client().ApplyURI(conf.ConnectionURI)
 	if opt.Timeout == nil {
@@ -77,15 +88,16 @@ func NewClientMongo(conf SettingsMongoConfig, namespace string) (*mongo.Database
 		opt.SetReadPreference(read)
 	}
 
-	if err := initMetric(namespace); err != nil {
+	metric, err := NewMetric(namespace, registerer)
+	if err != nil {
 		return nil, err
 	}
 
 	if opt.Monitor == nil {
-		opt.SetMonitor(globalMetric.Monitor)
+		opt.SetMonitor(metric.Monitor)
 	}
 	if opt.PoolMonitor == nil {
-		opt.SetPoolMonitor(globalMetric.PoolMonitor)
+		opt.SetPoolMonitor(metric.PoolMonitor)
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), database.ConnectionTimeout)
@@ -105,24 +117,15 @@ func NewClientMongo(conf SettingsMongoConfig, namespace string) (*mongo.Database
 	return db, nil
 }
 
-func initMetric(namespace string) error {
-	monitor := &Monitor{
-		namespace: namespace,
-		mu:        sync.Mutex{},
-		commands:  make(map[int64]command),
-	}
+// NewMetric создает метрики и мониторы команд и пула для клиента
+func NewMetric(namespace string, registerer prometheus.Registerer) (*Metric, error) {
 
-	globalMetric = &Metric{
+	metric := &Metric{
 		namespace: namespace,
 
-		Monitor: &event.CommandMonitor{
-			Started:   monitor.HandleStartedEvent,
-			Succeeded: monitor.IncSucceededEvent,
-			Failed:    monitor.IncFailedEvent,
-		},
-		PoolMonitor: &event.PoolMonitor{
-			Event: HandlePoolEvent,
-		},
+		Monitor:     nil,
+		PoolMonitor: nil,
+
 		// Метрика времени выполнения успешных запросов
 		mongoCommandSucceededMetric: prometheus.NewHistogramVec(
 			prometheus.HistogramOpts{
@@ -163,17 +166,35 @@ func initMetric(namespace string) error {
 		),
 	}
 
-	if err := prometheus.Register(globalMetric.mongoCommandSucceededMetric); err != nil {
-		return errors.Default.Wrap(err)
+	var err error
+	if metric.mongoCommandSucceededMetric, err = promUtils.Register(registerer, metric.mongoCommandSucceededMetric); err != nil {
+		return nil, err
+	}
+	if metric.mongoCommandFailedMetric, err = promUtils.Register(registerer, metric.mongoCommandFailedMetric); err != nil {
+		return nil, err
+	}
+	if metric.mongoPoolEventsMetric, err = promUtils.Register(registerer, metric.mongoPoolEventsMetric); err != nil {
+		return nil, err
 	}
 
-	if err := prometheus.Register(globalMetric.mongoCommandFailedMetric); err != nil {
-		return errors.Default.Wrap(err)
+	monitor := &Monitor{
+		namespace: namespace,
+		metric:    metric,
+		mu:        sync.Mutex{},
+		commands:  make(map[int64]command),
+		lastSweep: time.Now(),
 	}
 
-	if err := prometheus.Register(globalMetric.mongoPoolEventsMetric); err != nil {
-		return errors.Default.Wrap(err)
+	metric.Monitor = &event.CommandMonitor{
+		Started:   monitor.HandleStartedEvent,
+		Succeeded: monitor.IncSucceededEvent,
+		Failed:    monitor.IncFailedEvent,
 	}
+	metric.PoolMonitor = &event.PoolMonitor{
+		Event: metric.HandlePoolEvent,
+	}
+
+	globalMetric.Store(metric)
 
-	return nil
+	return metric, nil
 }
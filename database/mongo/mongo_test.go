@@ -0,0 +1,167 @@
+package mongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"pkg/errors"
+)
+
+func TestNewMetric(t *testing.T) {
+
+	registry := prometheus.NewRegistry()
+
+	metric, err := NewMetric("test", registry)
+	require.NoError(t, err)
+
+	// Повторная регистрация переиспользует метрики
+	again, err := NewMetric("test", registry)
+	require.NoError(t, err)
+	assert.Same(t, metric.mongoCommandFailedMetric, again.mongoCommandFailedMetric)
+
+	metric.PoolMonitor.Event(&event.PoolEvent{Type: event.ConnectionCreated})
+	again.PoolMonitor.Event(&event.PoolEvent{Type: event.ConnectionCreated})
+	assert.InDelta(t, 2, testutil.ToFloat64(metric.mongoPoolEventsMetric.WithLabelValues("test", "connection_created")), 0)
+
+	// Пакетная функция пишет в метрики последнего созданного клиента
+	HandlePoolEvent(&event.PoolEvent{Type: event.ConnectionCreated})
+	assert.InDelta(t, 3, testutil.ToFloat64(metric.mongoPoolEventsMetric.WithLabelValues("test", "connection_created")), 0)
+}
+
+func TestMonitor(t *testing.T) {
+
+	metric, err := NewMetric("test", prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	monitor := &Monitor{namespace: "test", metric: metric, commands: make(map[int64]command), lastSweep: time.Now()}
+	ctx := context.Background()
+
+	started := func(requestID int64) {
+		monitor.HandleStartedEvent(ctx, &event.CommandStartedEvent{
+			Command:      bson.Raw(bsonDoc(t, bson.D{{Key: "find", Value: "users"}})),
+			DatabaseName: "db",
+			CommandName:  "find",
+			RequestID:    requestID,
+		})
+	}
+
+	t.Run("1. Завершенные команды удаляются из монитора", func(t *testing.T) {
+		started(1)
+		started(2)
+
+		monitor.IncSucceededEvent(ctx, &event.CommandSucceededEvent{
+			CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", RequestID: 1, Duration: time.Millisecond},
+		})
+		monitor.IncFailedEvent(ctx, &event.CommandFailedEvent{
+			CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", RequestID: 2},
+		})
+
+		assert.Empty(t, monitor.commands)
+		assert.InDelta(t, 1, testutil.ToFloat64(metric.mongoCommandFailedMetric.WithLabelValues("test", "db", "users", "find")), 0)
+	})
+
+	t.Run("2. Зависшие команды удаляются при очистке", func(t *testing.T) {
+		monitor.commands[3] = command{database: "db", collection: "users", startedAt: time.Now().Add(-2 * staleCommandTTL)}
+		monitor.lastSweep = time.Now().Add(-2 * sweepInterval)
+
+		started(4)
+
+		assert.NotContains(t, monitor.commands, int64(3))
+		assert.Contains(t, monitor.commands, int64(4))
+	})
+}
+
+func TestWrapMongoError(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		err      error
+		target   error
+		httpCode int
+	}{
+		{
+			name:     "1. Документ не найден",
+			err:      mongo.ErrNoDocuments,
+			target:   ErrNotFound,
+			httpCode: NotFound.HTTPCode,
+		},
+		{
+			name:     "2. Дубликат ключа",
+			err:      mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000, Message: "E11000 duplicate key"}}},
+			target:   ErrDuplicateKey,
+			httpCode: Conflict.HTTPCode,
+		},
+		{
+			name:     "3. Отмена контекста",
+			err:      context.Canceled,
+			target:   context.Canceled,
+			httpCode: errors.Default.HTTPCode,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := wrapMongoError(tt.err)
+
+			assert.True(t, errors.Is(err, tt.target))
+
+			var pkgErr errors.Error
+			require.ErrorAs(t, err, &pkgErr)
+			assert.Equal(t, tt.httpCode, pkgErr.ErrorType.HTTPCode)
+		})
+	}
+}
+
+func TestCursorSeq(t *testing.T) {
+
+	type user struct {
+		Name string `bson:"name"`
+	}
+
+	ctx := context.Background()
+
+	newCursor := func() *mongo.Cursor {
+		cursor, err := mongo.NewCursorFromDocuments([]any{
+			bson.D{{Key: "name", Value: "a"}},
+			bson.D{{Key: "name", Value: "b"}},
+			bson.D{{Key: "name", Value: "c"}},
+		}, nil, nil)
+		require.NoError(t, err)
+		return cursor
+	}
+
+	t.Run("1. Все документы", func(t *testing.T) {
+		var names []string
+		for item, err := range CursorSeq[user](ctx, newCursor()) {
+			require.NoError(t, err)
+			names = append(names, item.Name)
+		}
+		assert.Equal(t, []string{"a", "b", "c"}, names)
+	})
+
+	t.Run("2. Выход из цикла", func(t *testing.T) {
+		var names []string
+		for item, err := range CursorSeq[user](ctx, newCursor()) {
+			require.NoError(t, err)
+			names = append(names, item.Name)
+			break
+		}
+		assert.Equal(t, []string{"a"}, names)
+	})
+}
+
+func bsonDoc(t *testing.T, doc bson.D) []byte {
+	t.Helper()
+	raw, err := bson.Marshal(doc)
+	require.NoError(t, err)
+	return raw
+}
@@ -0,0 +1,241 @@
+package mongo
+
+import (
+	"context"
+	"iter"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Repository - типизированная обертка над коллекцией с документами типа T.
+// Все методы используют сессию из контекста, если она есть, поэтому работают внутри InTx
+type Repository[T any] struct {
+	collection *mongo.Collection
+}
+
+func NewRepository[T any](db *mongo.Database, collection string, opts ...*options.CollectionOptions) Repository[T] {
+	return Repository[T]{
+		collection: db.Collection(collection, opts...),
+	}
+}
+
+// Collection возвращает коллекцию для запросов, которые не покрывает репозиторий
+func (r Repository[T]) Collection() *mongo.Collection {
+	return r.collection
+}
+
+// InTx выполняет fn в транзакции клиента коллекции
+func (r Repository[T]) InTx(ctx context.Context, opts *options.TransactionOptions, fn func(ctx context.Context) error) error {
+	return InTx(ctx, r.collection.Database().Client(), opts, fn)
+}
+
+// FindOne возвращает один документ. Если документа нет, возвращается ошибка NotFound
+func (r Repository[T]) FindOne(ctx context.Context, filter any, opts ...*options.FindOneOptions) (T, error) {
+	var res T
+	if err := r.collection.FindOne(ctx, nonNilFilter(filter), opts...).Decode(&res); err != nil {
+		return res, wrapMongoError(err)
+	}
+	return res, nil
+}
+
+// Find возвращает все документы по фильтру
+func (r Repository[T]) Find(ctx context.Context, filter any, opts ...*options.FindOptions) ([]T, error) {
+
+	cursor, err := r.collection.Find(ctx, nonNilFilter(filter), opts...)
+	if err != nil {
+		return nil, wrapMongoError(err)
+	}
+
+	res := make([]T, 0)
+	if err = cursor.All(ctx, &res); err != nil {
+		return nil, wrapMongoError(err)
+	}
+
+	return res, nil
+}
+
+// Iterate возвращает итератор по документам без загрузки всей выборки в память.
+// Ошибка выполнения запроса возвращается первым элементом итератора
+func (r Repository[T]) Iterate(ctx context.Context, filter any, opts ...*options.FindOptions) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+
+		cursor, err := r.collection.Find(ctx, nonNilFilter(filter), opts...)
+		if err != nil {
+			var zero T
+			yield(zero, wrapMongoError(err))
+			return
+		}
+
+		for item, err := range CursorSeq[T](ctx, cursor) {
+			if !yield(item, err) {
+				return
+			}
+		}
+	}
+}
+
+// CursorSeq возвращает итератор по курсору, декодируя каждый документ в T.
+// Курсор закрывается после окончания итерации, в том числе при выходе из цикла через break.
+// После первой ошибки итерация прекращается
+func CursorSeq[T any](ctx context.Context, cursor *mongo.Cursor) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		defer func() { _ = cursor.Close(context.WithoutCancel(ctx)) }()
+
+		for cursor.Next(ctx) {
+			var item T
+			if err := cursor.Decode(&item); err != nil {
+				yield(item, wrapMongoError(err))
+				return
+			}
+			if !yield(item, nil) {
+				return
+			}
+		}
+
+		if err := cursor.Err(); err != nil {
+			var zero T
+			yield(zero, wrapMongoError(err))
+		}
+	}
+}
+
+// Count возвращает количество документов по фильтру
+func (r Repository[T]) Count(ctx context.Context, filter any, opts ...*options.CountOptions) (int64, error) {
+	count, err := r.collection.CountDocuments(ctx, nonNilFilter(filter), opts...)
+	if err != nil {
+		return 0, wrapMongoError(err)
+	}
+	return count, nil
+}
+
+// Insert вставляет документ и возвращает его _id
+func (r Repository[T]) Insert(ctx context.Context, doc T, opts ...*options.InsertOneOptions) (any, error) {
+	res, err := r.collection.InsertOne(ctx, doc, opts...)
+	if err != nil {
+		return nil, wrapMongoError(err)
+	}
+	return res.InsertedID, nil
+}
+
+// InsertMany вставляет документы и возвращает их _id в том же порядке
+func (r Repository[T]) InsertMany(ctx context.Context, docs []T, opts ...*options.InsertManyOptions) ([]any, error) {
+
+	if len(docs) == 0 {
+		return nil, nil
+	}
+
+	items := make([]any, len(docs))
+	for i, doc := range docs {
+		items[i] = doc
+	}
+
+	res, err := r.collection.InsertMany(ctx, items, opts...)
+	if err != nil {
+		return nil, wrapMongoError(err)
+	}
+
+	return res.InsertedIDs, nil
+}
+
+// Upsert заменяет документ по фильтру или вставляет его, если документа нет.
+// Возвращает true, если документ был вставлен
+func (r Repository[T]) Upsert(ctx context.Context, filter any, doc T) (bool, error) {
+	res, err := r.collection.ReplaceOne(ctx, nonNilFilter(filter), doc, options.Replace().SetUpsert(true))
+	if err != nil {
+		return false, wrapMongoError(err)
+	}
+	return res.UpsertedCount > 0, nil
+}
+
+// Update применяет update к одному документу. Если документа нет, возвращается ошибка NotFound
+func (r Repository[T]) Update(ctx context.Context, filter, update any, opts ...*options.UpdateOptions) error {
+
+	res, err := r.collection.UpdateOne(ctx, nonNilFilter(filter), update, opts...)
+	if err != nil {
+		return wrapMongoError(err)
+	}
+
+	if res.MatchedCount == 0 && res.UpsertedCount == 0 {
+		return NotFound.Wrap(ErrNotFound).WithParams("collection", r.collection.Name())
+	}
+
+	return nil
+}
+
+// UpdateMany применяет update ко всем документам по фильтру и возвращает количество найденных документов
+func (r Repository[T]) UpdateMany(ctx context.Context, filter, update any, opts ...*options.UpdateOptions) (int64, error) {
+	res, err := r.collection.UpdateMany(ctx, nonNilFilter(filter), update, opts...)
+	if err != nil {
+		return 0, wrapMongoError(err)
+	}
+	return res.MatchedCount, nil
+}
+
+// Delete удаляет один документ. Если документа нет, возвращается ошибка NotFound
+func (r Repository[T]) Delete(ctx context.Context, filter any, opts ...*options.DeleteOptions) error {
+
+	res, err := r.collection.DeleteOne(ctx, nonNilFilter(filter), opts...)
+	if err != nil {
+		return wrapMongoError(err)
+	}
+
+	if res.DeletedCount == 0 {
+		return NotFound.Wrap(ErrNotFound).WithParams("collection", r.collection.Name())
+	}
+
+	return nil
+}
+
+// DeleteMany удаляет все документы по фильтру и возвращает их количество
+func (r Repository[T]) DeleteMany(ctx context.Context, filter any, opts ...*options.DeleteOptions) (int64, error) {
+	res, err := r.collection.DeleteMany(ctx, nonNilFilter(filter), opts...)
+	if err != nil {
+		return 0, wrapMongoError(err)
+	}
+	return res.DeletedCount, nil
+}
+
+// BulkWrite выполняет набор операций одним запросом. Модели удобно строить через InsertModel, ReplaceModel и т.д.
+func (r Repository[T]) BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...*options.BulkWriteOptions) (*mongo.BulkWriteResult, error) {
+
+	if len(models) == 0 {
+		return new(mongo.BulkWriteResult), nil
+	}
+
+	res, err := r.collection.BulkWrite(ctx, models, opts...)
+	if err != nil {
+		return res, wrapMongoError(err)
+	}
+
+	return res, nil
+}
+
+// InsertModel возвращает модель вставки документа для BulkWrite
+func (r Repository[T]) InsertModel(doc T) mongo.WriteModel {
+	return mongo.NewInsertOneModel().SetDocument(doc)
+}
+
+// ReplaceModel возвращает модель замены документа для BulkWrite
+func (r Repository[T]) ReplaceModel(filter any, doc T, upsert bool) mongo.WriteModel {
+	return mongo.NewReplaceOneModel().SetFilter(nonNilFilter(filter)).SetReplacement(doc).SetUpsert(upsert)
+}
+
+// UpdateModel возвращает модель обновления одного документа для BulkWrite
+func (r Repository[T]) UpdateModel(filter, update any) mongo.WriteModel {
+	return mongo.NewUpdateOneModel().SetFilter(nonNilFilter(filter)).SetUpdate(update)
+}
+
+// DeleteModel возвращает модель удаления одного документа для BulkWrite
+func (r Repository[T]) DeleteModel(filter any) mongo.WriteModel {
+	return mongo.NewDeleteOneModel().SetFilter(nonNilFilter(filter))
+}
+
+// nonNilFilter заменяет nil на пустой фильтр, драйвер не принимает nil
+func nonNilFilter(filter any) any {
+	if filter == nil {
+		return bson.D{}
+	}
+	return filter
+}
@@ -0,0 +1,106 @@
+package mongo
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"pkg/errors"
+)
+
+// DefaultTokenCollection - коллекция для токенов по умолчанию в CollectionTokenStore
+const DefaultTokenCollection = "change_stream_tokens"
+
+// TokenStore хранит resume token change stream'а по имени наблюдателя
+type TokenStore interface {
+
+	// Load возвращает сохраненный токен или nil, если токена нет
+	Load(ctx context.Context, name string) (bson.Raw, error)
+	Save(ctx context.Context, name string, token bson.Raw) error
+	Delete(ctx context.Context, name string) error
+}
+
+// MemoryTokenStore хранит токены в памяти процесса. Подходит для наполнения кэшей в памяти:
+// после рестарта кэш все равно пустой, и полная синхронизация нужна в любом случае
+type MemoryTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]bson.Raw
+}
+
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{
+		mu:     sync.Mutex{},
+		tokens: make(map[string]bson.Raw),
+	}
+}
+
+func (s *MemoryTokenStore) Load(_ context.Context, name string) (bson.Raw, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokens[name], nil
+}
+
+func (s *MemoryTokenStore) Save(_ context.Context, name string, token bson.Raw) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Драйвер переиспользует буфер, поэтому храним копию
+	s.tokens[name] = append(bson.Raw(nil), token...)
+	return nil
+}
+
+func (s *MemoryTokenStore) Delete(_ context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, name)
+	return nil
+}
+
+// CollectionTokenStore хранит токены в коллекции Mongo, документ на каждого наблюдателя
+type CollectionTokenStore struct {
+	repository Repository[resumeToken]
+}
+
+type resumeToken struct {
+	Name      string    `bson:"_id"`
+	Token     bson.Raw  `bson:"token"`
+	UpdatedAt time.Time `bson:"updatedAt"`
+}
+
+// NewCollectionTokenStore создает хранилище в коллекции collection, по умолчанию DefaultTokenCollection
+func NewCollectionTokenStore(db *mongo.Database, collection string) CollectionTokenStore {
+	if collection == "" {
+		collection = DefaultTokenCollection
+	}
+	return CollectionTokenStore{
+		repository: NewRepository[resumeToken](db, collection),
+	}
+}
+
+func (s CollectionTokenStore) Load(ctx context.Context, name string) (bson.Raw, error) {
+	doc, err := s.repository.FindOne(ctx, bson.D{{Key: "_id", Value: name}})
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return doc.Token, nil
+}
+
+func (s CollectionTokenStore) Save(ctx context.Context, name string, token bson.Raw) error {
+	_, err := s.repository.Upsert(ctx, bson.D{{Key: "_id", Value: name}}, resumeToken{
+		Name:      name,
+		Token:     token,
+		UpdatedAt: time.Now(),
+	})
+	return err
+}
+
+func (s CollectionTokenStore) Delete(ctx context.Context, name string) error {
+	_, err := s.repository.DeleteMany(ctx, bson.D{{Key: "_id", Value: name}})
+	return err
+}
@@ -0,0 +1,357 @@
+package mongo
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"pkg/backoff"
+	"pkg/errors"
+	"pkg/log"
+)
+
+// OperationType - тип изменения документа в change stream
+type OperationType string
+
+const (
+	OperationInsert  OperationType = "insert"
+	OperationUpdate  OperationType = "update"
+	OperationReplace OperationType = "replace"
+	OperationDelete  OperationType = "delete"
+
+	// После invalidate стрим закрывается: коллекцию удалили или переименовали
+	operationInvalidate OperationType = "invalidate"
+)
+
+// Коды ошибок сервера, при которых продолжить стрим с сохраненного токена нельзя
+const (
+	codeInvalidResumeToken      = 260
+	codeChangeStreamFatalError  = 280
+	codeChangeStreamHistoryLost = 286
+)
+
+// ChangeEvent - изменение документа типа T
+type ChangeEvent[T any] struct {
+	Operation OperationType
+
+	// _id измененного документа
+	DocumentID any
+
+	// Документ после изменения. Для delete всегда nil, для update - если документ уже удален
+	Document *T
+
+	// Измененные и удаленные поля, только для update
+	UpdatedFields bson.M
+	RemovedFields []string
+
+	ClusterTime primitive.Timestamp
+}
+
+// changeEventDoc - событие change stream в формате сервера
+type changeEventDoc[T any] struct {
+	OperationType OperationType `bson:"operationType"`
+	DocumentKey   struct {
+		ID any `bson:"_id"`
+	} `bson:"documentKey"`
+	FullDocument      *T `bson:"fullDocument"`
+	UpdateDescription *struct {
+		UpdatedFields bson.M   `bson:"updatedFields"`
+		RemovedFields []string `bson:"removedFields"`
+	} `bson:"updateDescription"`
+	ClusterTime primitive.Timestamp `bson:"clusterTime"`
+}
+
+// WatcherConfig - настройки Watcher
+type WatcherConfig struct {
+
+	// Имя наблюдателя, под которым сохраняется resume token. По умолчанию имя коллекции
+	Name string
+
+	// Дополнительные стадии агрегации, например $match по operationType или полям
+	Pipeline mongo.Pipeline
+
+	// Хранилище токенов, по умолчанию MemoryTokenStore
+	TokenStore TokenStore
+
+	// Задержка перед переподключением, растет экспоненциально от MinBackoff до MaxBackoff.
+	// По умолчанию 500 миллисекунд и 30 секунд
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// После скольких неудачных попыток подряд обработать одно и то же событие токен сбрасывается
+	// и запускается полная синхронизация, иначе стрим бесконечно переоткрывается на этом событии. По умолчанию 5
+	MaxEventFailures int
+}
+
+// EventHandler обрабатывает изменение. Если обработчик вернул ошибку, стрим переоткрывается
+// с последнего сохраненного токена и событие приходит повторно, но не больше MaxEventFailures раз
+type EventHandler[T any] func(ctx context.Context, event ChangeEvent[T]) error
+
+// ResyncHandler полностью перечитывает данные. Вызывается при первом запуске без токена
+// и когда продолжить стрим с токена нельзя, например история в oplog уже потеряна
+type ResyncHandler func(ctx context.Context) error
+
+// Watcher следит за изменениями коллекции через change stream, сохраняет resume token после каждого
+// обработанного события и пустой пачки и переподключается при ошибках. Доставка at-least-once
+type Watcher[T any] struct {
+	cfg     WatcherConfig
+	handler EventHandler[T]
+	resync  ResyncHandler
+
+	open func(ctx context.Context, token bson.Raw) (changeStream, error)
+
+	// Токен, после которого не удается обработать событие, и количество неудачных попыток подряд.
+	// Меняются только в горутине Run
+	failedToken   bson.Raw
+	eventFailures int
+}
+
+// changeStream - методы mongo.ChangeStream, которые использует Watcher
+type changeStream interface {
+	TryNext(ctx context.Context) bool
+	ID() int64
+	Decode(val any) error
+	ResumeToken() bson.Raw
+	Err() error
+	Close(ctx context.Context) error
+}
+
+// NewWatcher создает Watcher для коллекции. resync может быть nil, если полная синхронизация не нужна
+func NewWatcher[T any](collection *mongo.Collection, cfg WatcherConfig, handler EventHandler[T], resync ResyncHandler) (*Watcher[T], error) {
+
+	if handler == nil {
+		return nil, errors.Default.New("handler is required")
+	}
+	if cfg.Name == "" {
+		cfg.Name = collection.Name()
+	}
+	if cfg.Pipeline == nil {
+		cfg.Pipeline = mongo.Pipeline{}
+	}
+	if cfg.TokenStore == nil {
+		cfg.TokenStore = NewMemoryTokenStore()
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = 500 * time.Millisecond
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 30 * time.Second
+	}
+	if cfg.MaxEventFailures <= 0 {
+		cfg.MaxEventFailures = 5
+	}
+
+	pipeline := cfg.Pipeline
+
+	return &Watcher[T]{
+		cfg:     cfg,
+		handler: handler,
+		resync:  resync,
+		open: func(ctx context.Context, token bson.Raw) (changeStream, error) {
+			opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+			if token != nil {
+				opts.SetResumeAfter(token)
+			}
+			return collection.Watch(ctx, pipeline, opts)
+		},
+		failedToken:   nil,
+		eventFailures: 0,
+	}, nil
+}
+
+// Run следит за изменениями, пока не отменен контекст. Ошибки логируются, после чего стрим
+// переоткрывается с задержкой
+func (w *Watcher[T]) Run(ctx context.Context) error {
+
+	for attempt := 0; ; {
+
+		progressed, err := w.watch(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		// Задержку сбрасываем, только если стрим реально продвинулся, иначе стрим, который открывается
+		// и сразу падает, переоткрывался бы без задержки
+		if progressed {
+			attempt = 0
+		}
+		if err == nil {
+			continue
+		}
+
+		log.LogError(errors.Default.Wrap(err).WithParams("watcher", w.cfg.Name, "attempt", attempt))
+
+		if backoff.Sleep(ctx, w.cfg.MinBackoff, w.cfg.MaxBackoff, attempt) != nil {
+			return nil
+		}
+		attempt++
+	}
+}
+
+// watch открывает стрим и обрабатывает события до ошибки. Возвращает true, если прошла синхронизация
+// или было обработано и сохранено хотя бы одно событие.
+// nil без отмены контекста означает, что токен сброшен или курсор закрыт и стрим нужно сразу открыть заново
+func (w *Watcher[T]) watch(ctx context.Context) (progressed bool, err error) {
+
+	token, err := w.cfg.TokenStore.Load(ctx, w.cfg.Name)
+	if err != nil {
+		return false, err
+	}
+
+	stream, err := w.open(ctx, token)
+	if err != nil {
+		if token != nil && isResumeTokenInvalid(err) {
+			return false, w.resetToken(ctx, err)
+		}
+		return false, wrapMongoError(err)
+	}
+	defer func() { _ = stream.Close(context.WithoutCancel(ctx)) }()
+
+	// Без токена стрим открывается до синхронизации, чтобы не потерять изменения, сделанные во время нее
+	if token == nil {
+		if err = w.fullResync(ctx, stream); err != nil {
+			return progressed, err
+		}
+		progressed = true
+		token = stream.ResumeToken()
+	}
+
+	for {
+		if !stream.TryNext(ctx) {
+
+			if err = stream.Err(); err != nil {
+				if isResumeTokenInvalid(err) {
+					return progressed, w.resetToken(ctx, err)
+				}
+				return progressed, wrapMongoError(err)
+			}
+
+			// Курсор закрыт сервером
+			if stream.ID() == 0 {
+				return progressed, nil
+			}
+
+			// Пустая пачка: сохраняем токен после нее, иначе на редко меняющейся коллекции
+			// сохраненный токен выпадет из oplog и каждый рестарт будет запускать полную синхронизацию
+			if postBatchToken := stream.ResumeToken(); postBatchToken != nil && !bytes.Equal(postBatchToken, token) {
+				if err = w.cfg.TokenStore.Save(ctx, w.cfg.Name, postBatchToken); err != nil {
+					return progressed, err
+				}
+				token = postBatchToken
+			}
+			continue
+		}
+
+		var doc changeEventDoc[T]
+		if err = stream.Decode(&doc); err != nil {
+			return progressed, w.eventFailed(ctx, token, wrapMongoError(err))
+		}
+
+		switch doc.OperationType {
+		case operationInvalidate:
+			return progressed, w.resetToken(ctx, nil)
+		case OperationInsert, OperationUpdate, OperationReplace, OperationDelete:
+			if err = w.handler(ctx, doc.event()); err != nil {
+				err = errors.Default.Wrap(err).WithParams("operation", doc.OperationType, "id", doc.DocumentKey.ID)
+				return progressed, w.eventFailed(ctx, token, err)
+			}
+		}
+
+		token = stream.ResumeToken()
+		if err = w.cfg.TokenStore.Save(ctx, w.cfg.Name, token); err != nil {
+			return progressed, err
+		}
+		progressed = true
+	}
+}
+
+// eventFailed считает неудачные попытки обработать событие после token. Пока попытки не закончились,
+// возвращает ошибку, и событие придет повторно. После MaxEventFailures попыток подряд сбрасывает токен,
+// чтобы полная синхронизация восстановила данные в обход этого события
+func (w *Watcher[T]) eventFailed(ctx context.Context, token bson.Raw, err error) error {
+
+	if !bytes.Equal(token, w.failedToken) {
+		w.failedToken, w.eventFailures = token, 0
+	}
+
+	w.eventFailures++
+	if w.eventFailures < w.cfg.MaxEventFailures {
+		return err
+	}
+
+	w.failedToken, w.eventFailures = nil, 0
+
+	return w.resetToken(ctx, err)
+}
+
+// fullResync вызывает resync и сохраняет начальный токен стрима, чтобы после рестарта не синхронизироваться повторно
+func (w *Watcher[T]) fullResync(ctx context.Context, stream changeStream) error {
+
+	if w.resync != nil {
+		started := time.Now()
+		if err := w.resync(ctx); err != nil {
+			return errors.Default.Wrap(err).WithParams("watcher", w.cfg.Name)
+		}
+		log.WithParams("watcher", w.cfg.Name, "duration", time.Since(started)).Info("mongo change stream resynced")
+	}
+
+	// На старых версиях сервера токена до первого события нет
+	if token := stream.ResumeToken(); token != nil {
+		return w.cfg.TokenStore.Save(ctx, w.cfg.Name, token)
+	}
+
+	return nil
+}
+
+// resetToken удаляет токен, чтобы следующий стрим открылся с текущего момента с полной синхронизацией
+func (w *Watcher[T]) resetToken(ctx context.Context, reason error) error {
+
+	if err := w.cfg.TokenStore.Delete(ctx, w.cfg.Name); err != nil {
+		return err
+	}
+
+	params := []any{"watcher", w.cfg.Name}
+	if reason != nil {
+		params = append(params, "reason", reason.Error())
+	}
+	log.WithParams(params...).Warning("mongo change stream cannot be resumed, full resync scheduled")
+
+	return nil
+}
+
+func (doc changeEventDoc[T]) event() ChangeEvent[T] {
+
+	event := ChangeEvent[T]{
+		Operation:     doc.OperationType,
+		DocumentID:    doc.DocumentKey.ID,
+		Document:      doc.FullDocument,
+		UpdatedFields: nil,
+		RemovedFields: nil,
+		ClusterTime:   doc.ClusterTime,
+	}
+	if doc.UpdateDescription != nil {
+		event.UpdatedFields = doc.UpdateDescription.UpdatedFields
+		event.RemovedFields = doc.UpdateDescription.RemovedFields
+	}
+
+	return event
+}
+
+// isResumeTokenInvalid проверяет, что стрим нельзя продолжить с токена
+func isResumeTokenInvalid(err error) bool {
+
+	var serverErr mongo.ServerError
+	if !errors.As(err, &serverErr) {
+		return false
+	}
+
+	return serverErr.HasErrorCode(codeInvalidResumeToken) ||
+		serverErr.HasErrorCode(codeChangeStreamFatalError) ||
+		serverErr.HasErrorCode(codeChangeStreamHistoryLost) ||
+		serverErr.HasErrorLabel("NonResumableChangeStreamError")
+}
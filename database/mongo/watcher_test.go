@@ -0,0 +1,230 @@
+package mongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"pkg/errors"
+)
+
+// fakeStream отдает события, затем emptyBatches пустых пачек, после чего курсор закрывается или стрим падает с err
+type fakeStream struct {
+	events       []bson.D
+	pos          int
+	emptyBatches int
+	idle         int
+	closed       bool
+	err          error
+}
+
+func (s *fakeStream) TryNext(_ context.Context) bool {
+	if s.pos < len(s.events) {
+		s.pos++
+		return true
+	}
+	if s.idle < s.emptyBatches {
+		s.idle++
+		return false
+	}
+	s.closed = true
+	return false
+}
+
+func (s *fakeStream) ID() int64 {
+	if s.closed {
+		return 0
+	}
+	return 1
+}
+
+func (s *fakeStream) Decode(val any) error {
+	raw, err := bson.Marshal(s.events[s.pos-1])
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(raw, val)
+}
+
+func (s *fakeStream) ResumeToken() bson.Raw {
+	raw, _ := bson.Marshal(bson.D{{Key: "_data", Value: s.pos + s.idle*100}})
+	return raw
+}
+
+func (s *fakeStream) Err() error {
+	if s.closed {
+		return s.err
+	}
+	return nil
+}
+
+func (s *fakeStream) Close(_ context.Context) error { return nil }
+
+func TestWatcher(t *testing.T) {
+
+	type config struct {
+		Name  string `bson:"name"`
+		Value int    `bson:"value"`
+	}
+
+	ctx := context.Background()
+	historyLost := mongo.CommandError{Code: codeChangeStreamHistoryLost, Message: "history lost"}
+
+	newWatcher := func(streams []*fakeStream, openErrs []error) (*Watcher[config], *[]ChangeEvent[config], *int, *[]bson.Raw) {
+		var (
+			events  []ChangeEvent[config]
+			resyncs int
+			tokens  []bson.Raw
+		)
+		w := &Watcher[config]{
+			cfg: WatcherConfig{Name: "configs", Pipeline: mongo.Pipeline{}, TokenStore: NewMemoryTokenStore(), MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+			handler: func(_ context.Context, event ChangeEvent[config]) error {
+				events = append(events, event)
+				return nil
+			},
+			resync: func(_ context.Context) error {
+				resyncs++
+				return nil
+			},
+		}
+		i := 0
+		w.open = func(_ context.Context, token bson.Raw) (changeStream, error) {
+			tokens = append(tokens, token)
+			defer func() { i++ }()
+			if i < len(openErrs) && openErrs[i] != nil {
+				return nil, openErrs[i]
+			}
+			return streams[i], nil
+		}
+		return w, &events, &resyncs, &tokens
+	}
+
+	t.Run("1. События и синхронизация при первом запуске", func(t *testing.T) {
+		w, events, resyncs, _ := newWatcher([]*fakeStream{{events: []bson.D{
+			{{Key: "operationType", Value: "insert"}, {Key: "documentKey", Value: bson.D{{Key: "_id", Value: "a"}}}, {Key: "fullDocument", Value: bson.D{{Key: "name", Value: "a"}, {Key: "value", Value: 1}}}},
+			{{Key: "operationType", Value: "update"}, {Key: "documentKey", Value: bson.D{{Key: "_id", Value: "a"}}}, {Key: "updateDescription", Value: bson.D{{Key: "updatedFields", Value: bson.D{{Key: "value", Value: 2}}}, {Key: "removedFields", Value: bson.A{"old"}}}}},
+			{{Key: "operationType", Value: "drop"}},
+			{{Key: "operationType", Value: "delete"}, {Key: "documentKey", Value: bson.D{{Key: "_id", Value: "a"}}}},
+		}}}, nil)
+
+		progressed, err := w.watch(ctx)
+		require.NoError(t, err)
+		assert.True(t, progressed)
+		assert.Equal(t, 1, *resyncs)
+
+		require.Len(t, *events, 3)
+		assert.Equal(t, OperationInsert, (*events)[0].Operation)
+		assert.Equal(t, "a", (*events)[0].DocumentID)
+		assert.Equal(t, &config{Name: "a", Value: 1}, (*events)[0].Document)
+		assert.Equal(t, OperationUpdate, (*events)[1].Operation)
+		assert.EqualValues(t, 2, (*events)[1].UpdatedFields["value"])
+		assert.Equal(t, []string{"old"}, (*events)[1].RemovedFields)
+		assert.Equal(t, OperationDelete, (*events)[2].Operation)
+		assert.Nil(t, (*events)[2].Document)
+
+		token, err := w.cfg.TokenStore.Load(ctx, "configs")
+		require.NoError(t, err)
+		assert.EqualValues(t, 4, token.Lookup("_data").Int32())
+	})
+
+	t.Run("2. Продолжение с сохраненного токена без синхронизации", func(t *testing.T) {
+		w, _, resyncs, tokens := newWatcher([]*fakeStream{{}}, nil)
+		saved := bson.Raw(bsonDoc(t, bson.D{{Key: "_data", Value: 10}}))
+		require.NoError(t, w.cfg.TokenStore.Save(ctx, "configs", saved))
+
+		_, err := w.watch(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 0, *resyncs)
+		assert.Equal(t, []bson.Raw{saved}, *tokens)
+	})
+
+	t.Run("3. Невалидный токен сбрасывается и запускается синхронизация", func(t *testing.T) {
+		w, _, resyncs, tokens := newWatcher([]*fakeStream{nil, {}}, []error{historyLost})
+		require.NoError(t, w.cfg.TokenStore.Save(ctx, "configs", bsonDoc(t, bson.D{{Key: "_data", Value: 10}})))
+
+		_, err := w.watch(ctx)
+		require.NoError(t, err)
+		_, err = w.watch(ctx)
+		require.NoError(t, err)
+
+		assert.Equal(t, 1, *resyncs)
+		require.Len(t, *tokens, 2)
+		assert.Nil(t, (*tokens)[1])
+	})
+
+	t.Run("4. Переподключение после ошибки стрима", func(t *testing.T) {
+		w, events, _, tokens := newWatcher([]*fakeStream{
+			{events: []bson.D{{{Key: "operationType", Value: "insert"}, {Key: "documentKey", Value: bson.D{{Key: "_id", Value: "a"}}}}}, err: mongo.CommandError{Code: 6, Message: "host unreachable"}},
+			{},
+		}, nil)
+
+		runCtx, cancel := context.WithCancel(ctx)
+		w.open = func(open func(context.Context, bson.Raw) (changeStream, error)) func(context.Context, bson.Raw) (changeStream, error) {
+			return func(ctx context.Context, token bson.Raw) (changeStream, error) {
+				if len(*tokens) == 1 {
+					defer cancel()
+				}
+				return open(ctx, token)
+			}
+		}(w.open)
+
+		require.NoError(t, w.Run(runCtx))
+		assert.Len(t, *events, 1)
+		require.Len(t, *tokens, 2)
+		assert.NotNil(t, (*tokens)[1])
+	})
+
+	t.Run("5. Стрим открылся и упал без событий - задержка не сбрасывается", func(t *testing.T) {
+		w, _, _, _ := newWatcher([]*fakeStream{
+			{err: mongo.CommandError{Code: 6, Message: "host unreachable"}},
+			{events: []bson.D{{{Key: "operationType", Value: "insert"}, {Key: "documentKey", Value: bson.D{{Key: "_id", Value: "a"}}}}}, err: mongo.CommandError{Code: 6, Message: "host unreachable"}},
+		}, nil)
+		require.NoError(t, w.cfg.TokenStore.Save(ctx, "configs", bsonDoc(t, bson.D{{Key: "_data", Value: 10}})))
+
+		progressed, err := w.watch(ctx)
+		require.Error(t, err)
+		assert.False(t, progressed)
+
+		progressed, err = w.watch(ctx)
+		require.Error(t, err)
+		assert.True(t, progressed)
+	})
+
+	t.Run("6. Токен после пустых пачек сохраняется", func(t *testing.T) {
+		w, _, _, _ := newWatcher([]*fakeStream{{emptyBatches: 2}}, nil)
+		require.NoError(t, w.cfg.TokenStore.Save(ctx, "configs", bsonDoc(t, bson.D{{Key: "_data", Value: 10}})))
+
+		progressed, err := w.watch(ctx)
+		require.NoError(t, err)
+		assert.False(t, progressed)
+
+		token, err := w.cfg.TokenStore.Load(ctx, "configs")
+		require.NoError(t, err)
+		assert.EqualValues(t, 200, token.Lookup("_data").Int32())
+	})
+
+	t.Run("7. Событие, которое не удается обработать, сбрасывает токен после MaxEventFailures попыток", func(t *testing.T) {
+		insert := []bson.D{{{Key: "operationType", Value: "insert"}, {Key: "documentKey", Value: bson.D{{Key: "_id", Value: "a"}}}}}
+		w, _, _, _ := newWatcher([]*fakeStream{{events: insert}, {events: insert}, {events: insert}}, nil)
+		w.cfg.MaxEventFailures = 3
+		w.handler = func(context.Context, ChangeEvent[config]) error { return errors.Default.New("handler error") }
+		require.NoError(t, w.cfg.TokenStore.Save(ctx, "configs", bsonDoc(t, bson.D{{Key: "_data", Value: 10}})))
+
+		for range 2 {
+			_, err := w.watch(ctx)
+			require.Error(t, err)
+		}
+
+		_, err := w.watch(ctx)
+		require.NoError(t, err)
+
+		token, err := w.cfg.TokenStore.Load(ctx, "configs")
+		require.NoError(t, err)
+		assert.Nil(t, token)
+	})
+}
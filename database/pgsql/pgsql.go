@@ -2,18 +2,56 @@ package pgsql
 
 import (
 	"context"
-	"fmt"
+	"net/url"
+	"strconv"
+	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 
 	"pkg/sql"
 )
 
+// Значения по умолчанию для пула соединений
+const (
+	defaultMaxOpenConns = 500
+	defaultMaxIdleConns = 50
+)
+
 type PgsqlConfigEnv struct {
 	Host     string `env:"PGSQL_HOST"`
 	User     string `env:"PGSQL_USER"`
 	Password string `env:"PGSQL_PASSWORD"`
 	Database string `env:"PGSQL_DATABASE"`
+
+	// Режим TLS: disable, require, verify-ca, verify-full. Если не задан, используется значение по умолчанию драйвера (prefer)
+	SSLMode string `env:"PGSQL_SSLMODE" envDefault:""`
+
+	// Путь к сертификату центра сертификации для verify-ca и verify-full
+	SSLRootCert string `env:"PGSQL_SSLROOTCERT" envDefault:""`
+
+	// Пути к клиентскому сертификату и ключу
+	SSLCert string `env:"PGSQL_SSLCERT" envDefault:""`
+	SSLKey  string `env:"PGSQL_SSLKEY" envDefault:""`
+
+	// Схемы для поиска таблиц через запятую
+	SearchPath string `env:"PGSQL_SEARCH_PATH" envDefault:""`
+
+	// Название приложения, которое видно в pg_stat_activity
+	ApplicationName string `env:"PGSQL_APPLICATION_NAME" envDefault:""`
+
+	// Таймаут установки соединения
+	ConnectTimeout time.Duration `env:"PGSQL_CONNECT_TIMEOUT" envDefault:""`
+
+	// Максимальное время выполнения одного запроса на стороне сервера
+	StatementTimeout time.Duration `env:"PGSQL_STATEMENT_TIMEOUT" envDefault:""`
+
+	// Размеры пула, по умолчанию 500 открытых и 50 простаивающих соединений
+	MaxOpenConns int `env:"PGSQL_MAX_OPEN_CONNS" envDefault:""`
+	MaxIdleConns int `env:"PGSQL_MAX_IDLE_CONNS" envDefault:""`
+
+	// Время жизни соединения и время простоя, после которых соединение закрывается, 0 - без ограничений
+	ConnMaxLifetime time.Duration `env:"PGSQL_CONN_MAX_LIFETIME" envDefault:""`
+	ConnMaxIdleTime time.Duration `env:"PGSQL_CONN_MAX_IDLE_TIME" envDefault:""`
 }
 
 func NewClientPgsql(ctx context.Context, conf PgsqlConfigEnv) (*sql.DB, error) {
@@ -22,23 +60,96 @@ func NewClientPgsql(ctx context.Context, conf PgsqlConfigEnv) (*sql.DB, error) {
 		return nil, err
 	}
 
-	// 	TODO вынести в конфиги
-	const (
-		MaxIdleConns = 50
-		MaxOpenConns = 500
-	)
+	maxOpenConns := conf.MaxOpenConns
+	if maxOpenConns <= 0 {
+		maxOpenConns = defaultMaxOpenConns
+	}
+	maxIdleConns := conf.MaxIdleConns
+	if maxIdleConns <= 0 {
+		maxIdleConns = defaultMaxIdleConns
+	}
 
-	db.DB.SetMaxOpenConns(MaxOpenConns)
-	db.DB.SetMaxIdleConns(MaxIdleConns)
+	db.DB.SetMaxOpenConns(maxOpenConns)
+	db.DB.SetMaxIdleConns(maxIdleConns)
+	db.DB.SetConnMaxLifetime(conf.ConnMaxLifetime)
+	db.DB.SetConnMaxIdleTime(conf.ConnMaxIdleTime)
 
 	err = db.Ping(ctx)
 	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	// Экспортируем статистику пула в Prometheus
+	if err = db.RegisterPoolMetrics(nil, "pgsql_"+conf.Database+"@"+conf.Host); err != nil {
+		_ = db.Close()
 		return nil, err
 	}
 
 	return db.Unsafe(), nil
 }
 
+// GetConnectionURI возвращает строку подключения, учетные данные и параметры экранируются
 func (c *PgsqlConfigEnv) GetConnectionURI() string {
-	return fmt.Sprintf("postgres://%v:%v@%v/%v", c.User, c.Password, c.Host, c.Database)
+
+	params := url.Values{}
+	for key, value := range map[string]string{
+		"sslmode":          c.SSLMode,
+		"sslrootcert":      c.SSLRootCert,
+		"sslcert":          c.SSLCert,
+		"sslkey":           c.SSLKey,
+		"search_path":      c.SearchPath,
+		"application_name": c.ApplicationName,
+	} {
+		if value != "" {
+			params.Set(key, value)
+		}
+	}
+	if c.ConnectTimeout > 0 {
+		// Драйвер принимает таймаут в целых секундах, 0 означает отсутствие таймаута
+		params.Set("connect_timeout", strconv.Itoa(max(1, int(c.ConnectTimeout.Seconds()))))
+	}
+	if c.StatementTimeout > 0 {
+		// Неизвестные драйверу параметры pgx передает серверу как параметры сессии
+		params.Set("statement_timeout", strconv.FormatInt(c.StatementTimeout.Milliseconds(), 10))
+	}
+
+	uri := new(url.URL)
+	uri.Scheme = "postgres"
+	uri.User = url.UserPassword(c.User, c.Password)
+	uri.Host = c.Host
+	uri.Path = "/" + c.Database
+	uri.RawQuery = params.Encode()
+
+	return uri.String()
+}
+
+// NewClusterPgsql подключается к мастеру conf.Host и репликам replicaHosts с теми же учетными данными
+// и возвращает ClusterDB, который направляет чтение на реплики
+func NewClusterPgsql(ctx context.Context, conf PgsqlConfigEnv, replicaHosts []string, clusterConf sql.ClusterConfig) (*sql.ClusterDB, error) {
+
+	primary, err := NewClientPgsql(ctx, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	replicas := make([]*sql.DB, 0, len(replicaHosts))
+	for _, host := range replicaHosts {
+
+		replicaConf := conf
+		replicaConf.Host = host
+
+		replica, err := NewClientPgsql(ctx, replicaConf)
+		if err != nil {
+			_ = primary.Close()
+			for _, r := range replicas {
+				_ = r.Close()
+			}
+			return nil, err
+		}
+
+		replicas = append(replicas, replica)
+	}
+
+	return sql.NewClusterDB(ctx, primary, replicas, clusterConf), nil
 }
@@ -0,0 +1,59 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"pkg/errors"
+)
+
+// SetJSON сохраняет значение в JSON. ttl 0 - без срока жизни
+func SetJSON(ctx context.Context, client redis.Cmdable, key string, value any, ttl time.Duration) error {
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return errors.Default.Wrap(err).WithParams("key", key)
+	}
+
+	if err = client.Set(ctx, key, data, ttl).Err(); err != nil {
+		return errors.Default.Wrap(err).WithParams("key", key)
+	}
+
+	return nil
+}
+
+// GetJSON читает значение, сохраненное SetJSON. Если ключа нет, возвращает found = false без ошибки
+func GetJSON[T any](ctx context.Context, client redis.Cmdable, key string) (value T, found bool, err error) {
+
+	data, err := client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return value, false, nil
+	}
+	if err != nil {
+		return value, false, errors.Default.Wrap(err).WithParams("key", key)
+	}
+
+	if err = json.Unmarshal(data, &value); err != nil {
+		return value, false, errors.Default.Wrap(err).WithParams("key", key)
+	}
+
+	return value, true, nil
+}
+
+// GetOrSetJSON возвращает значение из кэша или вычисляет его через load и сохраняет с ttl
+func GetOrSetJSON[T any](ctx context.Context, client redis.Cmdable, key string, ttl time.Duration, load func(ctx context.Context) (T, error)) (T, error) {
+
+	value, found, err := GetJSON[T](ctx, client, key)
+	if err != nil || found {
+		return value, err
+	}
+
+	if value, err = load(ctx); err != nil {
+		return value, err
+	}
+
+	return value, SetJSON(ctx, client, key, value, ttl)
+}
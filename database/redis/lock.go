@@ -0,0 +1,120 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"pkg/errors"
+)
+
+var (
+	// ErrLockHeld - блокировка занята другим владельцем
+	ErrLockHeld = errors.New("redis: lock is held")
+
+	// ErrLockLost - блокировка истекла и могла быть захвачена другим владельцем
+	ErrLockLost = errors.New("redis: lock lost")
+)
+
+// Скрипты блокировки. Значение ключа - fencing токен, он же идентифицирует владельца.
+// Ключ блокировки и счетчик токенов используют один hash tag, поэтому скрипты работают в кластере
+var (
+	lockAcquireScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return 0
+end
+local token = redis.call("INCR", KEYS[2])
+redis.call("SET", KEYS[1], token, "PX", ARGV[1])
+return token`)
+
+	lockRefreshScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+	lockReleaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+// Lock - захваченная распределенная блокировка.
+// Token монотонно растет с каждым захватом: хранилище, в которое пишет владелец блокировки,
+// должно отклонять запись с токеном меньше последнего увиденного, тогда владелец с истекшей блокировкой ничего не испортит
+type Lock struct {
+	client redis.UniversalClient
+	key    string
+	token  int64
+}
+
+// TryLock захватывает блокировку name на ttl без ожидания. Если блокировка занята, возвращает ErrLockHeld
+func TryLock(ctx context.Context, client redis.UniversalClient, name string, ttl time.Duration) (*Lock, error) {
+
+	key := "lock:{" + name + "}"
+	token, err := lockAcquireScript.Run(ctx, client, []string{key, key + ":fence"}, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return nil, errors.Default.Wrap(err).WithParams("lock", name)
+	}
+	if token == 0 {
+		return nil, errors.Default.Wrap(ErrLockHeld).WithParams("lock", name)
+	}
+
+	return &Lock{
+		client: client,
+		key:    key,
+		token:  token,
+	}, nil
+}
+
+// AcquireLock ждет блокировку, повторяя попытки раз в retryInterval, пока не отменен контекст
+func AcquireLock(ctx context.Context, client redis.UniversalClient, name string, ttl, retryInterval time.Duration) (*Lock, error) {
+	for {
+		lock, err := TryLock(ctx, client, name, ttl)
+		if err == nil || !errors.Is(err, ErrLockHeld) {
+			return lock, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, errors.Default.Wrap(ctx.Err()).WithParams("lock", name)
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// Token возвращает fencing токен блокировки
+func (l *Lock) Token() int64 {
+	return l.token
+}
+
+// Refresh продлевает блокировку на ttl. Если блокировка уже истекла, возвращает ErrLockLost
+func (l *Lock) Refresh(ctx context.Context, ttl time.Duration) error {
+
+	ok, err := lockRefreshScript.Run(ctx, l.client, []string{l.key}, strconv.FormatInt(l.token, 10), ttl.Milliseconds()).Int64()
+	if err != nil {
+		return errors.Default.Wrap(err).WithParams("lock", l.key)
+	}
+	if ok == 0 {
+		return errors.Default.Wrap(ErrLockLost).WithParams("lock", l.key, "token", l.token)
+	}
+
+	return nil
+}
+
+// Unlock освобождает блокировку. Если блокировка уже истекла, возвращает ErrLockLost
+func (l *Lock) Unlock(ctx context.Context) error {
+
+	ok, err := lockReleaseScript.Run(ctx, l.client, []string{l.key}, strconv.FormatInt(l.token, 10)).Int64()
+	if err != nil {
+		return errors.Default.Wrap(err).WithParams("lock", l.key)
+	}
+	if ok == 0 {
+		return errors.Default.Wrap(ErrLockLost).WithParams("lock", l.key, "token", l.token)
+	}
+
+	return nil
+}
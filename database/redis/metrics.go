@@ -0,0 +1,125 @@
+package redis
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+
+	"pkg/errors"
+	"pkg/promUtils"
+)
+
+var _ redis.Hook = new(MetricsHook)
+
+// MetricsHook - хук go-redis с метриками времени выполнения и ошибок команд
+type MetricsHook struct {
+	namespace string
+
+	redisCommandDurationMetric *prometheus.HistogramVec
+	redisCommandFailedMetric   *prometheus.CounterVec
+}
+
+// NewMetricsHook создает хук и регистрирует метрики. Повторный вызов с тем же реестром переиспользует уже зарегистрированные метрики
+func NewMetricsHook(namespace string, registerer prometheus.Registerer) (*MetricsHook, error) {
+
+	hook := &MetricsHook{
+		namespace: namespace,
+
+		// Метрика времени выполнения команд
+		redisCommandDurationMetric: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace:                       namespace,
+				Subsystem:                       "",
+				Name:                            "redis_command_duration_seconds",
+				Help:                            "A histogram of the response delay (seconds) of commands that were processed by redis.",
+				ConstLabels:                     nil,
+				Buckets:                         []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+				NativeHistogramBucketFactor:     0,
+				NativeHistogramZeroThreshold:    0,
+				NativeHistogramMaxBucketNumber:  0,
+				NativeHistogramMinResetDuration: 0,
+				NativeHistogramMaxZeroThreshold: 0,
+			}, []string{"redis_service", "redis_command"},
+		),
+
+		// Метрика количества неудачных команд
+		redisCommandFailedMetric: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace:   namespace,
+				Subsystem:   "",
+				ConstLabels: map[string]string{},
+				Name:        "redis_command_failed_total",
+				Help:        "Total number of command failed in redis.",
+			}, []string{"redis_service", "redis_command"},
+		),
+	}
+
+	var err error
+	if hook.redisCommandDurationMetric, err = promUtils.Register(registerer, hook.redisCommandDurationMetric); err != nil {
+		return nil, err
+	}
+	if hook.redisCommandFailedMetric, err = promUtils.Register(registerer, hook.redisCommandFailedMetric); err != nil {
+		return nil, err
+	}
+
+	return hook, nil
+}
+
+// DialHook реализует интерфейс redis.Hook.
+func (h *MetricsHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := next(ctx, network, addr)
+		if err != nil {
+			h.redisCommandFailedMetric.WithLabelValues(h.namespace, "dial").Inc()
+		}
+		return conn, err
+	}
+}
+
+// ProcessHook реализует интерфейс redis.Hook.
+func (h *MetricsHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+		h.observe(commandName(cmd), time.Since(start), cmd.Err())
+		return err
+	}
+}
+
+// ProcessPipelineHook реализует интерфейс redis.Hook. Время считается на весь пайплайн, ошибки - по командам
+func (h *MetricsHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmds)
+
+		h.redisCommandDurationMetric.WithLabelValues(h.namespace, "pipeline").Observe(time.Since(start).Seconds())
+		for _, cmd := range cmds {
+			if isFailed(cmd.Err()) {
+				h.redisCommandFailedMetric.WithLabelValues(h.namespace, commandName(cmd)).Inc()
+			}
+		}
+
+		return err
+	}
+}
+
+func (h *MetricsHook) observe(command string, duration time.Duration, err error) {
+	h.redisCommandDurationMetric.WithLabelValues(h.namespace, command).Observe(duration.Seconds())
+	if isFailed(err) {
+		h.redisCommandFailedMetric.WithLabelValues(h.namespace, command).Inc()
+	}
+}
+
+// isFailed - отсутствие ключа не считается ошибкой
+func isFailed(err error) bool {
+	return err != nil && !errors.Is(err, redis.Nil)
+}
+
+// commandName возвращает имя команды без аргументов в нижнем регистре
+func commandName(cmd redis.Cmder) string {
+	return strings.ToLower(cmd.Name())
+}
@@ -0,0 +1,80 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"pkg/errors"
+)
+
+// slidingWindowScript - лимит запросов в скользящем окне. Время берется с сервера Redis, чтобы не зависеть от часов клиентов.
+// Каждый разрешенный запрос добавляется в sorted set со временем в миллисекундах, старые записи удаляются.
+// Возвращает {разрешен, осталось, через сколько миллисекунд освободится место}
+var slidingWindowScript = redis.NewScript(`
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+
+local count = redis.call("ZCARD", KEYS[1])
+if count < limit then
+	redis.call("ZADD", KEYS[1], now, now .. "-" .. ARGV[3])
+	redis.call("PEXPIRE", KEYS[1], window)
+	return {1, limit - count - 1, 0}
+end
+
+local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+return {0, 0, tonumber(oldest[2]) + window - now}`)
+
+// RateLimitResult - результат проверки лимита
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int64
+	RetryAfter time.Duration // Через сколько освободится место, если запрос не разрешен
+}
+
+// SlidingWindowLimiter - ограничение количества запросов по ключу в скользящем окне, общее для всех реплик
+type SlidingWindowLimiter struct {
+	client redis.UniversalClient
+	prefix string
+	limit  int64
+	window time.Duration
+}
+
+// NewSlidingWindowLimiter создает ограничитель: не больше limit запросов за window для каждого ключа
+func NewSlidingWindowLimiter(client redis.UniversalClient, prefix string, limit int64, window time.Duration) *SlidingWindowLimiter {
+	return &SlidingWindowLimiter{
+		client: client,
+		prefix: prefix,
+		limit:  limit,
+		window: window,
+	}
+}
+
+// Allow проверяет лимит для ключа и, если запрос разрешен, учитывает его
+func (l *SlidingWindowLimiter) Allow(ctx context.Context, key string) (RateLimitResult, error) {
+
+	// Случайный суффикс различает запросы в одну миллисекунду
+	suffix := make([]byte, 8)
+	_, _ = rand.Read(suffix)
+
+	res, err := slidingWindowScript.Run(ctx, l.client, []string{l.prefix + key}, l.window.Milliseconds(), l.limit, hex.EncodeToString(suffix)).Int64Slice()
+	if err != nil {
+		return RateLimitResult{}, errors.Default.Wrap(err).WithParams("key", key)
+	}
+	if len(res) != 3 {
+		return RateLimitResult{}, errors.Default.New("unexpected rate limiter response").WithParams("key", key, "response", res)
+	}
+
+	return RateLimitResult{
+		Allowed:    res[0] == 1,
+		Remaining:  res[1],
+		RetryAfter: time.Duration(res[2]) * time.Millisecond,
+	}, nil
+}
@@ -2,56 +2,85 @@ package redis
 
 import (
 	"context"
+	"strings"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/redis/go-redis/v9"
+
+	"pkg/database"
+	"pkg/errors"
+)
+
+// Значения по умолчанию для пула и таймаутов
+const (
+	defaultPoolSize     = 100
+	defaultMinIdleConns = 10
+	defaultMaxRetries   = 3
+	defaultPoolTimeout  = 10 * time.Second
+	defaultTimeout      = 5 * time.Second
 )
 
 type RedisConfigEnv struct {
 	Host     string `env:"REDIS_HOST"`
 	User     string `env:"REDIS_USER"`
 	Password string `env:"REDIS_PASSWORD"`
+
+	// Адреса узлов кластера или sentinel через запятую. Если не заданы, используется Host
+	Addrs []string `env:"REDIS_ADDRS" envDefault:"" envSeparator:","`
+
+	// Подключение к Redis Cluster. Кластер включается и без флага, если в Addrs несколько адресов
+	Cluster bool `env:"REDIS_CLUSTER" envDefault:""`
+
+	// Имя мастера sentinel. Если задано, Addrs - адреса sentinel
+	MasterName       string `env:"REDIS_MASTER_NAME" envDefault:""`
+	SentinelUser     string `env:"REDIS_SENTINEL_USER" envDefault:""`
+	SentinelPassword string `env:"REDIS_SENTINEL_PASSWORD" envDefault:""`
+
+	// TLS и пути к сертификату центра сертификации, клиентскому сертификату и ключу
+	TLS                bool   `env:"REDIS_TLS" envDefault:""`
+	CACert             string `env:"REDIS_CA_CERT" envDefault:""`
+	Cert               string `env:"REDIS_CERT" envDefault:""`
+	Key                string `env:"REDIS_KEY" envDefault:""`
+	InsecureSkipVerify bool   `env:"REDIS_INSECURE_SKIP_VERIFY" envDefault:""`
+
+	// Размеры пула, по умолчанию 100 соединений и 10 простаивающих
+	PoolSize     int `env:"REDIS_POOL_SIZE" envDefault:""`
+	MinIdleConns int `env:"REDIS_MIN_IDLE_CONNS" envDefault:""`
+	MaxIdleConns int `env:"REDIS_MAX_IDLE_CONNS" envDefault:""`
+
+	// Количество повторов команды при сетевых ошибках, по умолчанию 3
+	MaxRetries int `env:"REDIS_MAX_RETRIES" envDefault:""`
+
+	// Таймауты, по умолчанию 10 секунд ожидания соединения из пула и 5 секунд на остальное
+	PoolTimeout  time.Duration `env:"REDIS_POOL_TIMEOUT" envDefault:""`
+	DialTimeout  time.Duration `env:"REDIS_DIAL_TIMEOUT" envDefault:""`
+	ReadTimeout  time.Duration `env:"REDIS_READ_TIMEOUT" envDefault:""`
+	WriteTimeout time.Duration `env:"REDIS_WRITE_TIMEOUT" envDefault:""`
+
+	// Время простоя и время жизни соединения, 0 - без ограничений
+	ConnMaxIdleTime time.Duration `env:"REDIS_CONN_MAX_IDLE_TIME" envDefault:""`
+	ConnMaxLifetime time.Duration `env:"REDIS_CONN_MAX_LIFETIME" envDefault:""`
 }
 
-func NewClientRedis(cfg RedisConfigEnv, database int) (*redis.Client, error) {
+// Client - клиент Redis, одиночный узел, sentinel или кластер в зависимости от конфига
+type Client struct {
+	redis.UniversalClient
+}
+
+// NewClientRedis создает клиент одиночного узла. Для sentinel и кластера используйте NewClient
+func NewClientRedis(cfg RedisConfigEnv, db int) (*redis.Client, error) {
+
+	opts, err := cfg.universalOptions(db)
+	if err != nil {
+		return nil, err
+	}
 
 	// Создаем клиент
-	client := redis.NewClient(&redis.Options{
-		Network:                    "",
-		Addr:                       cfg.Host,
-		ClientName:                 "",
-		Dialer:                     nil,
-		OnConnect:                  nil,
-		Protocol:                   0,
-		Username:                   "",
-		Password:                   cfg.Password,
-		CredentialsProvider:        nil,
-		CredentialsProviderContext: nil,
-		DB:                         database,
-		MaxRetries:                 3,
-		MinRetryBackoff:            0,
-		MaxRetryBackoff:            0,
-		DialTimeout:                5 * time.Second,
-		ReadTimeout:                5 * time.Second,
-		WriteTimeout:               5 * time.Second,
-		ContextTimeoutEnabled:      false,
-		PoolFIFO:                   false,
-		PoolSize:                   100,
-		PoolTimeout:                10 * time.Second,
-		MinIdleConns:               10,
-		MaxIdleConns:               0,
-		MaxActiveConns:             0,
-		ConnMaxIdleTime:            0,
-		ConnMaxLifetime:            0,
-		TLSConfig:                  nil,
-		Limiter:                    nil,
-		DisableIndentity:           false,
-		IdentitySuffix:             "",
-		UnstableResp3:              false,
-	})
+	client := redis.NewClient(opts.Simple())
 
 	// Проверяем соединение
-	_, err := client.Ping(context.Background()).Result()
+	_, err = client.Ping(context.Background()).Result()
 	if err != nil {
 		return nil, err
 	}
@@ -59,3 +88,84 @@ func NewClientRedis(cfg RedisConfigEnv, database int) (*redis.Client, error) {
 	// Возвращаем клиент
 	return client, nil
 }
+
+// NewClient создает клиент и подключает метрики команд. namespace - префикс метрик,
+// registerer - реестр метрик, если nil, используется prometheus.DefaultRegisterer
+func NewClient(ctx context.Context, cfg RedisConfigEnv, db int, namespace string, registerer prometheus.Registerer) (*Client, error) {
+
+	opts, err := cfg.universalOptions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var client redis.UniversalClient
+	switch {
+	case opts.MasterName != "":
+		client = redis.NewFailoverClient(opts.Failover())
+	case cfg.Cluster || len(opts.Addrs) > 1:
+		client = redis.NewClusterClient(opts.Cluster())
+	default:
+		client = redis.NewClient(opts.Simple())
+	}
+
+	hook, err := NewMetricsHook(namespace, registerer)
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	client.AddHook(hook)
+
+	ctx, cancel := context.WithTimeout(ctx, database.ConnectionTimeout)
+	defer cancel()
+
+	if err = client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
+		return nil, errors.Default.Wrap(err)
+	}
+
+	return &Client{UniversalClient: client}, nil
+}
+
+func (cfg RedisConfigEnv) universalOptions(db int) (*redis.UniversalOptions, error) {
+
+	addrs := cfg.Addrs
+	if len(addrs) == 0 {
+		addrs = strings.Split(cfg.Host, ",")
+	}
+
+	opts := new(redis.UniversalOptions)
+	opts.Addrs = addrs
+	opts.DB = db
+	opts.Username = cfg.User
+	opts.Password = cfg.Password
+	opts.MasterName = cfg.MasterName
+	opts.SentinelUsername = cfg.SentinelUser
+	opts.SentinelPassword = cfg.SentinelPassword
+	opts.MaxRetries = valueOrDefault(cfg.MaxRetries, defaultMaxRetries)
+	opts.DialTimeout = valueOrDefault(cfg.DialTimeout, defaultTimeout)
+	opts.ReadTimeout = valueOrDefault(cfg.ReadTimeout, defaultTimeout)
+	opts.WriteTimeout = valueOrDefault(cfg.WriteTimeout, defaultTimeout)
+	opts.PoolSize = valueOrDefault(cfg.PoolSize, defaultPoolSize)
+	opts.PoolTimeout = valueOrDefault(cfg.PoolTimeout, defaultPoolTimeout)
+	opts.MinIdleConns = valueOrDefault(cfg.MinIdleConns, defaultMinIdleConns)
+	opts.MaxIdleConns = cfg.MaxIdleConns
+	opts.ConnMaxIdleTime = cfg.ConnMaxIdleTime
+	opts.ConnMaxLifetime = cfg.ConnMaxLifetime
+
+	if cfg.TLS {
+		tlsConfig, err := database.NewTLSConfig(cfg.CACert, cfg.Cert, cfg.Key, cfg.InsecureSkipVerify)
+		if err != nil {
+			return nil, err
+		}
+		opts.TLSConfig = tlsConfig
+	}
+
+	return opts, nil
+}
+
+func valueOrDefault[T int | time.Duration](value, defaultValue T) T {
+	if value <= 0 {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,70 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUniversalOptions(t *testing.T) {
+
+	t.Run("1. Значения по умолчанию", func(t *testing.T) {
+		opts, err := RedisConfigEnv{Host: "localhost:6379", User: "user", Password: "pass"}.universalOptions(2)
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"localhost:6379"}, opts.Addrs)
+		assert.Equal(t, "user", opts.Username)
+		assert.Equal(t, 2, opts.DB)
+		assert.Equal(t, defaultPoolSize, opts.PoolSize)
+		assert.Equal(t, defaultPoolTimeout, opts.PoolTimeout)
+		assert.Nil(t, opts.TLSConfig)
+	})
+
+	t.Run("2. Адреса кластера и TLS", func(t *testing.T) {
+		opts, err := RedisConfigEnv{Host: "ignored:6379", Addrs: []string{"a:6379", "b:6379"}, TLS: true, PoolSize: 5, ReadTimeout: time.Second}.universalOptions(0)
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"a:6379", "b:6379"}, opts.Addrs)
+		assert.Equal(t, 5, opts.PoolSize)
+		assert.Equal(t, time.Second, opts.ReadTimeout)
+		assert.NotNil(t, opts.TLSConfig)
+	})
+}
+
+func TestMetricsHook(t *testing.T) {
+
+	registry := prometheus.NewRegistry()
+
+	hook, err := NewMetricsHook("test", registry)
+	require.NoError(t, err)
+
+	// Повторная регистрация переиспользует метрики
+	again, err := NewMetricsHook("test", registry)
+	require.NoError(t, err)
+	assert.Same(t, hook.redisCommandFailedMetric, again.redisCommandFailedMetric)
+
+	process := hook.ProcessHook(func(_ context.Context, cmd redis.Cmder) error {
+		return cmd.Err()
+	})
+
+	ctx := context.Background()
+
+	// Отсутствие ключа не ошибка
+	missing := redis.NewStringCmd(ctx, "get", "key")
+	missing.SetErr(redis.Nil)
+	_ = process(ctx, missing)
+
+	failed := redis.NewStatusCmd(ctx, "set", "key", "value")
+	failed.SetErr(assert.AnError)
+	_ = process(ctx, failed)
+
+	assert.Equal(t, 2, testutil.CollectAndCount(hook.redisCommandDurationMetric))
+	assert.Equal(t, 0.0, testutil.ToFloat64(hook.redisCommandFailedMetric.WithLabelValues("test", "get")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(hook.redisCommandFailedMetric.WithLabelValues("test", "set")))
+}
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+
+	"pkg/errors"
+)
+
+// NewTLSConfig создает настройки TLS для подключения к базе данных.
+// caFile - путь к сертификату центра сертификации для проверки сервера, если пустой, используются системные сертификаты.
+// certFile и keyFile - пути к клиентскому сертификату и ключу для взаимной аутентификации, задаются вместе
+func NewTLSConfig(caFile, certFile, keyFile string, insecureSkipVerify bool) (*tls.Config, error) {
+
+	config := new(tls.Config)
+	config.MinVersion = tls.VersionTLS12
+	config.InsecureSkipVerify = insecureSkipVerify //nolint:gosec // Отключается явно через конфиг
+
+	if caFile != "" {
+		caCert, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, errors.Default.Wrap(err).WithParams("caFile", caFile)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, errors.Default.New("failed to parse CA certificate").WithParams("caFile", caFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, errors.Default.Wrap(err).WithParams("certFile", certFile, "keyFile", keyFile)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
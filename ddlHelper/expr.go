@@ -0,0 +1,351 @@
+package ddlHelper
+
+import (
+	"regexp"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+
+	"pkg/errors"
+)
+
+// Dialect - диалект SQL, от него зависят кавычки идентификаторов и операторы JSON и массивов
+type Dialect string
+
+const (
+	Postgres   Dialect = "postgres"
+	ClickHouse Dialect = "clickhouse"
+)
+
+// Builder собирает выражения SQL с экранированными идентификаторами и параметрами вместо подстановки значений в текст.
+// В отличие от строковых хелперов пакета, результат реализует sq.Sqlizer и передается в squirrel как есть:
+//
+//	b := ddlHelper.New(ddlHelper.Postgres)
+//	sq.Select().Column(b.Coalesce(b.Col("u", "name"), "").As("name")).Where(b.Col("u", "id").Eq(id))
+type Builder struct {
+	dialect Dialect
+}
+
+// New создает построитель выражений для диалекта
+func New(dialect Dialect) Builder {
+	return Builder{dialect: dialect}
+}
+
+// PG и CH - построители выражений для Postgres и ClickHouse
+var (
+	PG = New(Postgres)
+	CH = New(ClickHouse)
+)
+
+var _ sq.Sqlizer = Expr{}
+
+// Expr - выражение SQL с плейсхолдерами ? и их значениями. Выражения неизменяемы, методы возвращают новое выражение.
+// Ошибка построения сохраняется в выражении и возвращается из ToSql, как в squirrel
+type Expr struct {
+	dialect Dialect
+	sql     string
+	args    []any
+	err     error
+
+	// Выражение с оператором верхнего уровня, как a + b. Такие выражения берутся в скобки,
+	// когда становятся операндом другого оператора
+	compound bool
+}
+
+// ToSql реализует интерфейс sq.Sqlizer.
+func (e Expr) ToSql() (string, []any, error) {
+	if e.err != nil {
+		return "", nil, e.err
+	}
+	return e.sql, e.args, nil
+}
+
+// Dialect возвращает диалект выражения
+func (e Expr) Dialect() Dialect {
+	return e.dialect
+}
+
+// Выражения, которые допустимо вставлять в текст запроса без экранирования: имена функций и типов
+var (
+	functionName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	typeName     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_ ]*(\([0-9, ]*\))?(\[\])*$|^[A-Za-z_][A-Za-z0-9_]*\([A-Za-z0-9_, ()']*\)$`)
+)
+
+// Ident экранирует идентификатор из частей, разделенных точкой: Ident("public", "users") -> "public"."users".
+// Результат не содержит параметров и подходит для sq.From и sq.Columns
+func (b Builder) Ident(parts ...string) string {
+
+	quote := `"`
+	if b.dialect == ClickHouse {
+		quote = "`"
+	}
+
+	quoted := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if b.dialect == ClickHouse {
+			part = strings.ReplaceAll(part, `\`, `\\`)
+		}
+		quoted = append(quoted, quote+strings.ReplaceAll(part, quote, quote+quote)+quote)
+	}
+
+	return strings.Join(quoted, ".")
+}
+
+// IdentAs - идентификатор с алиасом для sq.From: "users" AS "u"
+func (b Builder) IdentAs(name, alias string) string {
+	return b.Ident(name) + " AS " + b.Ident(alias)
+}
+
+// Col - ссылка на колонку: Col("name") или Col("u", "name")
+func (b Builder) Col(parts ...string) Expr {
+	return b.raw(b.Ident(parts...))
+}
+
+// Table - ссылка на таблицу
+func (b Builder) Table(parts ...string) Expr {
+	return b.raw(b.Ident(parts...))
+}
+
+// TableAs - таблица с алиасом для Join
+func (b Builder) TableAs(table, alias string) Expr {
+	return b.raw(b.IdentAs(table, alias))
+}
+
+// Star - все колонки таблицы: "u".* или * без таблицы
+func (b Builder) Star(table ...string) Expr {
+	if len(table) == 0 {
+		return b.raw("*")
+	}
+	return b.raw(b.Ident(table...) + ".*")
+}
+
+// Value - значение, передаваемое параметром
+func (b Builder) Value(value any) Expr {
+	return Expr{dialect: b.dialect, sql: "?", args: []any{value}, err: nil, compound: false}
+}
+
+// Null - литерал NULL
+func (b Builder) Null() Expr {
+	return b.raw("NULL")
+}
+
+// Func - вызов функции. Аргументы, не являющиеся выражениями, передаются параметрами
+func (b Builder) Func(name string, args ...any) Expr {
+	if !functionName.MatchString(name) {
+		return b.error(errors.Default.New("invalid function name").WithParams("name", name))
+	}
+	return b.join(name+"(", ", ", ")", args...)
+}
+
+// Coalesce - COALESCE(args...)
+func (b Builder) Coalesce(args ...any) Expr { return b.Func("COALESCE", args...) }
+
+// Count - COUNT(arg), без аргумента COUNT(*)
+func (b Builder) Count(arg ...any) Expr {
+	if len(arg) == 0 {
+		return b.raw("COUNT(*)")
+	}
+	return b.Func("COUNT", arg...)
+}
+
+// CountDistinct - COUNT(DISTINCT arg)
+func (b Builder) CountDistinct(arg any) Expr { return b.wrap("COUNT(DISTINCT ", arg, ")") }
+
+// Агрегатные и строковые функции
+func (b Builder) Max(arg any) Expr   { return b.Func("MAX", arg) }
+func (b Builder) Min(arg any) Expr   { return b.Func("MIN", arg) }
+func (b Builder) Sum(arg any) Expr   { return b.Func("SUM", arg) }
+func (b Builder) Avg(arg any) Expr   { return b.Func("AVG", arg) }
+func (b Builder) Lower(arg any) Expr { return b.Func("LOWER", arg) }
+func (b Builder) Upper(arg any) Expr { return b.Func("UPPER", arg) }
+
+// Distinct - DISTINCT arg для списка колонок
+func (b Builder) Distinct(arg any) Expr { return b.wrap("DISTINCT ", arg, "") }
+
+// And объединяет условия через AND. Без условий дает истину
+func (b Builder) And(conditions ...any) Expr {
+	if len(conditions) == 0 {
+		return b.raw("(1=1)")
+	}
+	return b.join("(", " AND ", ")", conditions...)
+}
+
+// Or объединяет условия через OR. Без условий дает ложь
+func (b Builder) Or(conditions ...any) Expr {
+	if len(conditions) == 0 {
+		return b.raw("(1=0)")
+	}
+	return b.join("(", " OR ", ")", conditions...)
+}
+
+// Not - отрицание условия
+func (b Builder) Not(condition any) Expr { return b.wrap("NOT (", condition, ")") }
+
+// Join - JOIN table ON on для sq.SelectBuilder.JoinClause
+func (b Builder) Join(table, on any) Expr { return b.joinClause("JOIN ", table, on) }
+
+// LeftJoin - LEFT JOIN table ON on для sq.SelectBuilder.JoinClause
+func (b Builder) LeftJoin(table, on any) Expr { return b.joinClause("LEFT JOIN ", table, on) }
+
+func (b Builder) joinClause(kind string, table, on any) Expr {
+	return b.wrap(kind, table, " ON ").append(b.expr(on), "")
+}
+
+// As - выражение с алиасом
+func (e Expr) As(alias string) Expr {
+	return e.suffix(" AS " + e.builder().Ident(alias))
+}
+
+// Asc и Desc - направление сортировки для OrderByClause
+func (e Expr) Asc() Expr  { return e.suffix(" ASC") }
+func (e Expr) Desc() Expr { return e.suffix(" DESC") }
+
+// Cast - CAST(e AS typ). Тип проверяется, так как вставляется в текст запроса
+func (e Expr) Cast(typ string) Expr {
+	if !typeName.MatchString(typ) {
+		return e.builder().error(errors.Default.New("invalid type name").WithParams("type", typ))
+	}
+	return e.builder().wrap("CAST(", e, " AS "+typ+")")
+}
+
+// Операторы сравнения. Значения, не являющиеся выражениями, передаются параметрами
+func (e Expr) Eq(value any) Expr    { return e.binary(" = ", value) }
+func (e Expr) NotEq(value any) Expr { return e.binary(" <> ", value) }
+func (e Expr) Gt(value any) Expr    { return e.binary(" > ", value) }
+func (e Expr) Gte(value any) Expr   { return e.binary(" >= ", value) }
+func (e Expr) Lt(value any) Expr    { return e.binary(" < ", value) }
+func (e Expr) Lte(value any) Expr   { return e.binary(" <= ", value) }
+func (e Expr) Like(value any) Expr  { return e.binary(" LIKE ", value) }
+func (e Expr) ILike(value any) Expr { return e.binary(" ILIKE ", value) }
+
+// Арифметические операторы
+func (e Expr) Plus(value any) Expr     { return e.binary(" + ", value) }
+func (e Expr) Minus(value any) Expr    { return e.binary(" - ", value) }
+func (e Expr) Multiply(value any) Expr { return e.binary(" * ", value) }
+func (e Expr) Divide(value any) Expr   { return e.binary(" / ", value) }
+
+// IsNull и IsNotNull - проверка на NULL
+func (e Expr) IsNull() Expr    { return e.operand().suffix(" IS NULL").asCompound() }
+func (e Expr) IsNotNull() Expr { return e.operand().suffix(" IS NOT NULL").asCompound() }
+
+// Between - e BETWEEN from AND to
+func (e Expr) Between(from, to any) Expr {
+	b := e.builder()
+	return e.operand().suffix(" BETWEEN ").append(b.expr(from).operand(), "").
+		append(b.raw(" AND "), "").append(b.expr(to).operand(), "").asCompound()
+}
+
+// In - e IN (values...). Пустой список дает ложь
+func (e Expr) In(values ...any) Expr {
+	if len(values) == 0 {
+		return e.constant("(1=0)")
+	}
+	return e.operand().suffix(" IN ").append(e.builder().join("(", ", ", ")", values...), "").asCompound()
+}
+
+// NotIn - e NOT IN (values...). Пустой список дает истину
+func (e Expr) NotIn(values ...any) Expr {
+	if len(values) == 0 {
+		return e.constant("(1=1)")
+	}
+	return e.operand().suffix(" NOT IN ").append(e.builder().join("(", ", ", ")", values...), "").asCompound()
+}
+
+func (e Expr) builder() Builder {
+	return Builder{dialect: e.dialect}
+}
+
+// binary - e operator value. Составные операнды берутся в скобки, чтобы порядок вычисления
+// не зависел от приоритета операторов: Col("a").Plus(1).Multiply(2) -> ("a" + ?) * ?
+func (e Expr) binary(operator string, value any) Expr {
+	return e.operand().suffix(operator).append(e.builder().expr(value).operand(), "").asCompound()
+}
+
+// operand возвращает выражение, которое можно подставить в оператор: составное берется в скобки
+func (e Expr) operand() Expr {
+	if !e.compound {
+		return e
+	}
+	return e.builder().wrap("(", e, ")")
+}
+
+// asCompound помечает выражение как составное
+func (e Expr) asCompound() Expr {
+	if e.err == nil {
+		e.compound = true
+	}
+	return e
+}
+
+// constant заменяет выражение константой, сохраняя ошибку выражения
+func (e Expr) constant(sql string) Expr {
+	if e.err != nil {
+		return e
+	}
+	return e.builder().raw(sql)
+}
+
+func (e Expr) suffix(sql string) Expr {
+	return e.append(e.builder().raw(sql), "")
+}
+
+// append дописывает к выражению other через separator
+func (e Expr) append(other Expr, separator string) Expr {
+	if e.err != nil {
+		return e
+	}
+	if other.err != nil {
+		return other
+	}
+
+	var args []any
+	if len(e.args)+len(other.args) > 0 {
+		args = make([]any, 0, len(e.args)+len(other.args))
+		args = append(append(args, e.args...), other.args...)
+	}
+
+	return Expr{dialect: e.dialect, sql: e.sql + separator + other.sql, args: args, err: nil, compound: false}
+}
+
+func (b Builder) raw(sql string) Expr {
+	return Expr{dialect: b.dialect, sql: sql, args: nil, err: nil, compound: false}
+}
+
+func (b Builder) error(err error) Expr {
+	return Expr{dialect: b.dialect, sql: "", args: nil, err: err, compound: false}
+}
+
+// expr превращает значение в выражение: Expr и sq.Sqlizer вставляются как есть, остальное - параметром.
+// Текст sq.Sqlizer неизвестен, поэтому в операторах он берется в скобки
+func (b Builder) expr(value any) Expr {
+	switch v := value.(type) {
+	case Expr:
+		return v
+	case sq.Sqlizer:
+		sql, args, err := v.ToSql()
+		if err != nil {
+			return b.error(err)
+		}
+		return Expr{dialect: b.dialect, sql: sql, args: args, err: nil, compound: true}
+	default:
+		return b.Value(v)
+	}
+}
+
+// wrap - prefix value suffix
+func (b Builder) wrap(prefix string, value any, suffix string) Expr {
+	return b.raw(prefix).append(b.expr(value), "").append(b.raw(suffix), "")
+}
+
+// join - prefix values[0] separator values[1] ... suffix
+func (b Builder) join(prefix, separator, suffix string, values ...any) Expr {
+	res := b.raw(prefix)
+	for i, value := range values {
+		if i > 0 {
+			res = res.append(b.expr(value), separator)
+		} else {
+			res = res.append(b.expr(value), "")
+		}
+	}
+	return res.append(b.raw(suffix), "")
+}
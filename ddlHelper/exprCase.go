@@ -0,0 +1,129 @@
+package ddlHelper
+
+import (
+	"strconv"
+
+	"pkg/errors"
+)
+
+var errEmptyCase = errors.New("ddlHelper: case expression requires at least one WHEN")
+
+// CaseBuilder собирает выражение CASE WHEN ... THEN ... ELSE ... END
+type CaseBuilder struct {
+	builder Builder
+	expr    Expr
+	whens   int
+}
+
+// Case начинает выражение CASE. С аргументом получается простая форма CASE value WHEN ...
+func (b Builder) Case(value ...any) CaseBuilder {
+	expr := b.raw("CASE")
+	if len(value) > 0 {
+		expr = expr.append(b.expr(value[0]), " ")
+	}
+	return CaseBuilder{builder: b, expr: expr, whens: 0}
+}
+
+// When добавляет ветку WHEN condition THEN result
+func (c CaseBuilder) When(condition, result any) CaseBuilder {
+	c.expr = c.expr.
+		append(c.builder.wrap(" WHEN ", condition, " THEN "), "").
+		append(c.builder.expr(result), "")
+	c.whens++
+	return c
+}
+
+// Else задает значение по умолчанию и завершает выражение
+func (c CaseBuilder) Else(result any) Expr {
+	c.expr = c.expr.append(c.builder.wrap(" ELSE ", result, ""), "")
+	return c.End()
+}
+
+// End завершает выражение без ELSE
+func (c CaseBuilder) End() Expr {
+	if c.whens == 0 {
+		return c.builder.error(errEmptyCase)
+	}
+	return c.expr.suffix(" END")
+}
+
+// Window - описание окна для оконных функций: PARTITION BY, ORDER BY и рамка
+type Window struct {
+	builder     Builder
+	partitionBy []any
+	orderBy     []any
+	frame       string
+}
+
+// Window начинает описание окна
+func (b Builder) Window() Window {
+	return Window{builder: b, partitionBy: nil, orderBy: nil, frame: ""}
+}
+
+// PartitionBy добавляет выражения PARTITION BY
+func (w Window) PartitionBy(exprs ...any) Window {
+	w.partitionBy = append(w.partitionBy[:len(w.partitionBy):len(w.partitionBy)], exprs...)
+	return w
+}
+
+// OrderBy добавляет выражения ORDER BY, направление задается через Expr.Asc и Expr.Desc
+func (w Window) OrderBy(exprs ...any) Window {
+	w.orderBy = append(w.orderBy[:len(w.orderBy):len(w.orderBy)], exprs...)
+	return w
+}
+
+// Rows задает рамку ROWS BETWEEN from AND to, например Rows(UnboundedPreceding, CurrentRow)
+func (w Window) Rows(from, to FrameBound) Window {
+	w.frame = "ROWS BETWEEN " + string(from) + " AND " + string(to)
+	return w
+}
+
+// Range задает рамку RANGE BETWEEN from AND to
+func (w Window) Range(from, to FrameBound) Window {
+	w.frame = "RANGE BETWEEN " + string(from) + " AND " + string(to)
+	return w
+}
+
+// FrameBound - граница рамки окна
+type FrameBound string
+
+const (
+	UnboundedPreceding FrameBound = "UNBOUNDED PRECEDING"
+	CurrentRow         FrameBound = "CURRENT ROW"
+	UnboundedFollowing FrameBound = "UNBOUNDED FOLLOWING"
+)
+
+// Over - оконная функция: e OVER (window)
+func (e Expr) Over(w Window) Expr {
+
+	b := e.builder()
+	res := e.suffix(" OVER (")
+
+	separator := ""
+	if len(w.partitionBy) > 0 {
+		res = res.append(b.join("PARTITION BY ", ", ", "", w.partitionBy...), separator)
+		separator = " "
+	}
+	if len(w.orderBy) > 0 {
+		res = res.append(b.join("ORDER BY ", ", ", "", w.orderBy...), separator)
+		separator = " "
+	}
+	if w.frame != "" {
+		res = res.append(b.raw(w.frame), separator)
+	}
+
+	return res.suffix(")")
+}
+
+// Оконные функции без аргументов
+func (b Builder) RowNumber() Expr { return b.raw("row_number()") }
+func (b Builder) Rank() Expr      { return b.raw("rank()") }
+func (b Builder) DenseRank() Expr { return b.raw("dense_rank()") }
+
+// Lag и Lead - значение из предыдущей или следующей строки окна
+func (b Builder) Lag(arg any, offset int) Expr {
+	return b.Func("lag", arg, b.raw(strconv.Itoa(offset)))
+}
+func (b Builder) Lead(arg any, offset int) Expr {
+	return b.Func("lead", arg, b.raw(strconv.Itoa(offset)))
+}
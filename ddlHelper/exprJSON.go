@@ -0,0 +1,75 @@
+package ddlHelper
+
+import "pkg/errors"
+
+var errUnsupported = errors.New("ddlHelper: operator is not supported by dialect")
+
+// Get - поле JSON объекта как JSON: Postgres e -> key, ClickHouse JSONExtractRaw(e, key).
+// key - имя поля или индекс элемента массива
+func (e Expr) Get(key any) Expr {
+	if e.dialect == ClickHouse {
+		return e.builder().Func("JSONExtractRaw", e, key)
+	}
+	return e.binary(" -> ", key)
+}
+
+// GetText - поле JSON объекта как текст: Postgres e ->> key, ClickHouse JSONExtractString(e, key)
+func (e Expr) GetText(key any) Expr {
+	if e.dialect == ClickHouse {
+		return e.builder().Func("JSONExtractString", e, key)
+	}
+	return e.binary(" ->> ", key)
+}
+
+// JSONContains - JSONB содержит value: e @> value. В ClickHouse не поддерживается
+func (e Expr) JSONContains(value any) Expr {
+	if e.dialect == ClickHouse {
+		return e.unsupported("@>")
+	}
+	return e.binary(" @> ", value)
+}
+
+// HasAnyKey - в JSON объекте есть хотя бы один из ключей: Postgres e ?| keys, ClickHouse arrayExists(k -> JSONHas(e, k), keys).
+// В Postgres оператор записывается как ??|, поэтому запрос нужно собирать с sq.Dollar, который превращает ?? в ?
+func (e Expr) HasAnyKey(keys []string) Expr {
+	if e.dialect == ClickHouse {
+		return e.builder().wrap("arrayExists(k -> JSONHas(", e, ", k), ").append(e.builder().Value(keys), "").suffix(")")
+	}
+	return e.binary(" ??| ", keys)
+}
+
+// ArrayContains - массив содержит все элементы values: Postgres e @> values, ClickHouse hasAll(e, values)
+func (e Expr) ArrayContains(values any) Expr {
+	if e.dialect == ClickHouse {
+		return e.builder().Func("hasAll", e, values)
+	}
+	return e.binary(" @> ", values)
+}
+
+// ArrayContainedBy - все элементы массива входят в values: Postgres e <@ values, ClickHouse hasAll(values, e)
+func (e Expr) ArrayContainedBy(values any) Expr {
+	if e.dialect == ClickHouse {
+		return e.builder().Func("hasAll", values, e)
+	}
+	return e.binary(" <@ ", values)
+}
+
+// ArrayOverlaps - у массивов есть общие элементы: Postgres e && values, ClickHouse hasAny(e, values)
+func (e Expr) ArrayOverlaps(values any) Expr {
+	if e.dialect == ClickHouse {
+		return e.builder().Func("hasAny", e, values)
+	}
+	return e.binary(" && ", values)
+}
+
+// EqAny - значение равно одному из элементов массива: Postgres e = ANY(values), ClickHouse has(values, e)
+func (e Expr) EqAny(values any) Expr {
+	if e.dialect == ClickHouse {
+		return e.builder().Func("has", values, e)
+	}
+	return e.binary(" = ", e.builder().Func("ANY", values))
+}
+
+func (e Expr) unsupported(operator string) Expr {
+	return e.builder().error(errors.Default.Wrap(errUnsupported).WithParams("operator", operator, "dialect", e.dialect))
+}
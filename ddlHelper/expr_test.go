@@ -0,0 +1,158 @@
+package ddlHelper
+
+import (
+	"testing"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpr(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		expr     Expr
+		wantSQL  string
+		wantArgs []any
+	}{
+		{
+			name:     "1. Экранирование идентификаторов",
+			expr:     PG.Col("u", `na"me`).Eq("x"),
+			wantSQL:  `"u"."na""me" = ?`,
+			wantArgs: []any{"x"},
+		},
+		{
+			name:     "2. Экранирование в ClickHouse",
+			expr:     CH.Col("events", "a`b"),
+			wantSQL:  "`events`.`a``b`",
+			wantArgs: nil,
+		},
+		{
+			name:     "3. Функции и параметры",
+			expr:     PG.Coalesce(PG.Col("price"), 0).Multiply(2).As("total"),
+			wantSQL:  `COALESCE("price", ?) * ? AS "total"`,
+			wantArgs: []any{0, 2},
+		},
+		{
+			name:     "4. Условия и IN",
+			expr:     PG.And(PG.Col("status").In("a", "b"), PG.Or(PG.Col("deleted_at").IsNull(), PG.Not(PG.Col("archived")))),
+			wantSQL:  `("status" IN (?, ?) AND ("deleted_at" IS NULL OR NOT ("archived")))`,
+			wantArgs: []any{"a", "b"},
+		},
+		{
+			name:     "5. CASE WHEN",
+			expr:     PG.Case().When(PG.Col("amount").Gt(100), "big").Else("small"),
+			wantSQL:  `CASE WHEN "amount" > ? THEN ? ELSE ? END`,
+			wantArgs: []any{100, "big", "small"},
+		},
+		{
+			name:     "6. Оконная функция",
+			expr:     PG.RowNumber().Over(PG.Window().PartitionBy(PG.Col("user_id")).OrderBy(PG.Col("created_at").Desc())),
+			wantSQL:  `row_number() OVER (PARTITION BY "user_id" ORDER BY "created_at" DESC)`,
+			wantArgs: nil,
+		},
+		{
+			name:     "7. JSONB в Postgres",
+			expr:     PG.And(PG.Col("data").Get("a").GetText("b").Eq("c"), PG.Col("data").HasAnyKey([]string{"x", "y"})),
+			wantSQL:  `((("data" -> ?) ->> ?) = ? AND "data" ??| ?)`,
+			wantArgs: []any{"a", "b", "c", []string{"x", "y"}},
+		},
+		{
+			name:     "8. JSON в ClickHouse",
+			expr:     CH.Col("data").GetText("b"),
+			wantSQL:  "JSONExtractString(`data`, ?)",
+			wantArgs: []any{"b"},
+		},
+		{
+			name:     "9. Массивы",
+			expr:     PG.And(PG.Col("tags").ArrayOverlaps([]string{"a"}), PG.Value("a").EqAny(PG.Col("tags"))),
+			wantSQL:  `("tags" && ? AND ? = ANY("tags"))`,
+			wantArgs: []any{[]string{"a"}, "a"},
+		},
+		{
+			name:     "10. Массивы в ClickHouse",
+			expr:     CH.Col("tags").ArrayContains([]string{"a"}),
+			wantSQL:  "hasAll(`tags`, ?)",
+			wantArgs: []any{[]string{"a"}},
+		},
+		{
+			name:     "11. Приоритет левого операнда",
+			expr:     PG.Col("a").Plus(PG.Col("b")).Multiply(2),
+			wantSQL:  `("a" + "b") * ?`,
+			wantArgs: []any{2},
+		},
+		{
+			name:     "12. Приоритет правого операнда",
+			expr:     PG.Col("a").Minus(PG.Col("b").Minus(1)),
+			wantSQL:  `"a" - ("b" - ?)`,
+			wantArgs: []any{1},
+		},
+		{
+			name:     "13. Сравнение выражений",
+			expr:     PG.Col("a").Divide(PG.Col("b").Plus(1)).Gt(PG.Col("c").Multiply(2)),
+			wantSQL:  `("a" / ("b" + ?)) > ("c" * ?)`,
+			wantArgs: []any{1, 2},
+		},
+		{
+			name:     "14. BETWEEN, IN и IS NULL для выражений",
+			expr:     PG.And(PG.Col("a").Plus(1).Between(PG.Col("b").Minus(1), 10), PG.Col("a").Plus(1).In(1, 2), PG.Col("a").Plus(PG.Col("b")).IsNull()),
+			wantSQL:  `(("a" + ?) BETWEEN ("b" - ?) AND ? AND ("a" + ?) IN (?, ?) AND ("a" + "b") IS NULL)`,
+			wantArgs: []any{1, 1, 10, 1, 1, 2},
+		},
+		{
+			name:     "15. Условие squirrel как операнд",
+			expr:     PG.Col("flag").Eq(sq.Eq{"a": 1}),
+			wantSQL:  `"flag" = (a = ?)`,
+			wantArgs: []any{1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args, err := tt.expr.ToSql()
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantSQL, sql)
+			assert.Equal(t, tt.wantArgs, args)
+		})
+	}
+}
+
+func TestExprErrors(t *testing.T) {
+
+	tests := []struct {
+		name string
+		expr Expr
+	}{
+		{name: "1. Недопустимое имя функции", expr: PG.Func("now(); DROP TABLE users; --")},
+		{name: "2. Недопустимый тип", expr: PG.Col("id").Cast("int); DROP TABLE users; --")},
+		{name: "3. CASE без WHEN", expr: PG.Case().Else(1)},
+		{name: "4. Оператор не поддерживается диалектом", expr: CH.Col("data").JSONContains("{}")},
+		{name: "5. Ошибка распространяется по выражению", expr: PG.And(PG.Col("id").Cast("bad;"), PG.Col("x").Eq(1))},
+		{name: "6. Ошибка выражения при пустом IN", expr: PG.Col("id").Cast("bad;").In()},
+		{name: "7. Ошибка выражения при пустом NOT IN", expr: PG.Col("id").Cast("bad;").NotIn()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := tt.expr.ToSql()
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestExprSquirrel(t *testing.T) {
+
+	query, args, err := sq.Select().
+		Column(PG.Col("u", "id")).
+		Column(PG.Count().As("orders")).
+		From(PG.IdentAs("users", "u")).
+		JoinClause(PG.LeftJoin(PG.TableAs("orders", "o"), PG.Col("o", "user_id").Eq(PG.Col("u", "id")))).
+		Where(PG.Col("u", "data").HasAnyKey([]string{"vip"})).
+		GroupBy(PG.Ident("u", "id")).
+		OrderByClause(PG.Col("orders").Desc()).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT "u"."id", COUNT(*) AS "orders" FROM "users" AS "u" LEFT JOIN "orders" AS "o" ON "o"."user_id" = "u"."id" WHERE "u"."data" ?| $1 GROUP BY "u"."id" ORDER BY "orders" DESC`, query)
+	assert.Equal(t, []any{[]string{"vip"}}, args)
+}
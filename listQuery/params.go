@@ -0,0 +1,44 @@
+package listQuery
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"pkg/middleware"
+)
+
+// Зарезервированные параметры запроса, остальные считаются фильтрами
+const (
+	paramSort   = "sort"
+	paramLimit  = "limit"
+	paramCursor = "cursor"
+)
+
+// Params - параметры списка из строки запроса: ?status=in:a,b&price=gte:10&sort=-created_at&limit=50&cursor=...
+type Params struct {
+	Sort   string `schema:"sort"`
+	Limit  uint64 `schema:"limit"`
+	Cursor string `schema:"cursor"`
+
+	// Фильтры: имя поля -> значение с необязательным оператором
+	Filters map[string]string `schema:"-"`
+}
+
+// DecodeParams декодирует параметры списка через middleware.DefaultDecoder.
+// Все параметры, кроме sort, limit и cursor, попадают в Filters и проверяются в Spec.Parse
+func DecodeParams(ctx *fiber.Ctx) (params Params, err error) {
+
+	if err = middleware.DefaultDecoder(ctx, middleware.DecodeSchema, &params); err != nil {
+		return params, BadRequest.Wrap(err)
+	}
+
+	params.Filters = make(map[string]string)
+	for key, value := range ctx.Queries() {
+		switch key {
+		case paramSort, paramLimit, paramCursor:
+		default:
+			params.Filters[key] = value
+		}
+	}
+
+	return params, nil
+}
@@ -0,0 +1,237 @@
+package listQuery
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+
+	"pkg/ddlHelper"
+	"pkg/errors"
+)
+
+// Query - проверенные фильтры, сортировка и позиция курсора
+type Query struct {
+	spec    Spec
+	filters []Filter
+	sorts   []Sort
+	limit   uint64
+	after   []any // Значения полей сортировки последней строки предыдущей страницы
+}
+
+// Filters возвращает разобранные фильтры
+func (q Query) Filters() []Filter {
+	return q.filters
+}
+
+// Sorts возвращает сортировку вместе с ключевым полем
+func (q Query) Sorts() []Sort {
+	return q.sorts
+}
+
+// Limit возвращает размер страницы
+func (q Query) Limit() uint64 {
+	return q.limit
+}
+
+// Apply добавляет в запрос условия, сортировку и лимит. Лимит на единицу больше размера страницы,
+// чтобы Paginate понял, есть ли следующая страница
+func (q Query) Apply(builder sq.SelectBuilder) sq.SelectBuilder {
+
+	b := q.spec.builder()
+
+	for _, filter := range q.filters {
+		builder = builder.Where(q.filterExpr(b, filter))
+	}
+
+	if q.after != nil {
+		builder = builder.Where(q.afterExpr(b))
+	}
+
+	for _, sort := range q.sorts {
+		column := q.column(b, sort.Field)
+		if sort.Desc {
+			builder = builder.OrderByClause(column.Desc())
+		} else {
+			builder = builder.OrderByClause(column.Asc())
+		}
+	}
+
+	return builder.Limit(q.limit + 1)
+}
+
+// likeEscaper экранирует спецсимволы LIKE, чтобы значение искалось как подстрока
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (q Query) filterExpr(b ddlHelper.Builder, filter Filter) ddlHelper.Expr {
+
+	column := q.column(b, filter.Field)
+
+	switch filter.Operator {
+	case OpNe:
+		return column.NotEq(filter.Values[0])
+	case OpGt:
+		return column.Gt(filter.Values[0])
+	case OpGte:
+		return column.Gte(filter.Values[0])
+	case OpLt:
+		return column.Lt(filter.Values[0])
+	case OpLte:
+		return column.Lte(filter.Values[0])
+	case OpIn:
+		return column.In(filter.Values...)
+	case OpNotIn:
+		return column.NotIn(filter.Values...)
+	case OpLike:
+		return column.ILike(ddlHelper.AllSubstring(likeEscaper.Replace(filter.Values[0].(string)))) //nolint:forcetypeassert // значение like всегда строка
+	case OpNull:
+		if filter.Values[0].(bool) { //nolint:forcetypeassert // значение null всегда bool
+			return column.IsNull()
+		}
+		return column.IsNotNull()
+	default:
+		return column.Eq(filter.Values[0])
+	}
+}
+
+// afterExpr - условие строк после курсора. Направления сортировки могут различаться, поэтому вместо сравнения кортежей
+// условие раскрывается: a > x OR (a = x AND b < y) OR ...
+func (q Query) afterExpr(b ddlHelper.Builder) ddlHelper.Expr {
+
+	var (
+		branches []any
+		equal    []any
+	)
+
+	for i, sort := range q.sorts {
+		column := q.column(b, sort.Field)
+
+		var next ddlHelper.Expr
+		if sort.Desc {
+			next = column.Lt(q.after[i])
+		} else {
+			next = column.Gt(q.after[i])
+		}
+
+		branches = append(branches, b.And(append(equal[:len(equal):len(equal)], next)...))
+		equal = append(equal, column.Eq(q.after[i]))
+	}
+
+	return b.Or(branches...)
+}
+
+func (q Query) column(b ddlHelper.Builder, field string) ddlHelper.Expr {
+	return b.Col(strings.Split(q.spec.Fields[field].Column, ".")...)
+}
+
+// Paginate обрезает строки, полученные по запросу из Apply, до размера страницы и возвращает курсор следующей страницы.
+// value возвращает значение поля сортировки у строки. Пустой курсор - страница последняя
+func Paginate[T any](q Query, rows []T, value func(row T, field string) any) ([]T, string, error) {
+
+	if uint64(len(rows)) <= q.limit {
+		return rows, "", nil
+	}
+
+	rows = rows[:q.limit]
+	last := rows[len(rows)-1]
+
+	values := make([]any, 0, len(q.sorts))
+	for _, sort := range q.sorts {
+		values = append(values, value(last, sort.Field))
+	}
+
+	cursor, err := encodeCursor(q.sorts, values)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return rows, cursor, nil
+}
+
+// cursor - содержимое курсора. Сортировка сохраняется, чтобы курсор нельзя было применить к другому порядку
+type cursor struct {
+	Sort   string   `json:"s"`
+	Values []string `json:"v"`
+}
+
+func encodeCursor(sorts []Sort, values []any) (string, error) {
+
+	c := cursor{Sort: sortSignature(sorts), Values: make([]string, 0, len(values))}
+	for i, value := range values {
+		formatted, err := formatValue(value)
+		if err != nil {
+			return "", errors.Default.Wrap(err).WithParams("field", sorts[i].Field)
+		}
+		c.Values = append(c.Values, formatted)
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", BadRequest.Wrap(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func (s Spec) decodeCursor(raw string, sorts []Sort) ([]any, error) {
+
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, BadRequest.New("invalid cursor")
+	}
+
+	var c cursor
+	if err = json.Unmarshal(data, &c); err != nil {
+		return nil, BadRequest.New("invalid cursor")
+	}
+
+	if c.Sort != sortSignature(sorts) || len(c.Values) != len(sorts) {
+		return nil, BadRequest.New("cursor does not match sort")
+	}
+
+	values := make([]any, 0, len(sorts))
+	for i, sort := range sorts {
+		value, err := parseValue(s.Fields[sort.Field].Type, c.Values[i])
+		if err != nil {
+			return nil, BadRequest.New("invalid cursor")
+		}
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+func sortSignature(sorts []Sort) string {
+	items := make([]string, 0, len(sorts))
+	for _, sort := range sorts {
+		if sort.Desc {
+			items = append(items, "-"+sort.Field)
+		} else {
+			items = append(items, sort.Field)
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+// formatValue приводит значение поля сортировки к строке, которую разбирает parseValue.
+// Указатели разыменовываются. NULL в курсоре не поддерживается, так как условие afterExpr не умеет сравнивать с NULL
+func formatValue(value any) (string, error) {
+
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	if !v.IsValid() || v.Kind() == reflect.Pointer {
+		return "", ErrNullSortValue
+	}
+
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.Format(time.RFC3339Nano), nil
+	}
+
+	return fmt.Sprint(v.Interface()), nil
+}
@@ -0,0 +1,162 @@
+package listQuery
+
+import (
+	"testing"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pkg/errors"
+)
+
+var testSpec = Spec{
+	Fields: map[string]Field{
+		"id":         {Column: "o.id", Type: TypeInt, Operators: []Operator{OpEq, OpIn}, Sortable: true},
+		"status":     {Column: "o.status", Type: TypeString, Operators: []Operator{OpEq, OpIn, OpNotIn}, Sortable: false},
+		"price":      {Column: "o.price", Type: TypeFloat, Operators: []Operator{OpGte, OpLte}, Sortable: true},
+		"name":       {Column: "o.name", Type: TypeString, Operators: []Operator{OpLike}, Sortable: false},
+		"created_at": {Column: "o.created_at", Type: TypeTime, Operators: nil, Sortable: true},
+	},
+	Key:          "id",
+	DefaultSort:  "-created_at",
+	DefaultLimit: 0,
+	MaxLimit:     100,
+	Builder:      nil,
+}
+
+func TestSpecParse(t *testing.T) {
+
+	query, err := testSpec.Parse(Params{
+		Sort:   "-created_at",
+		Limit:  2,
+		Cursor: "",
+		Filters: map[string]string{
+			"status": "in:a,b",
+			"price":  "gte:10",
+			"name":   "like:50%",
+		},
+	})
+	require.NoError(t, err)
+
+	sql, args, err := query.Apply(sq.Select("o.id").From("orders o")).ToSql()
+	require.NoError(t, err)
+
+	assert.Equal(t, `SELECT o.id FROM orders o WHERE "o"."name" ILIKE ? AND "o"."price" >= ? AND "o"."status" IN (?, ?) ORDER BY "o"."created_at" DESC, "o"."id" DESC LIMIT 3`, sql)
+	assert.Equal(t, []any{`%50\%%`, 10.0, "a", "b"}, args)
+}
+
+func TestSpecParseErrors(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		params Params
+	}{
+		{name: "1. Неизвестное поле фильтра", params: Params{Filters: map[string]string{"secret": "1"}}},
+		{name: "2. Поле без фильтрации", params: Params{Filters: map[string]string{"created_at": "2024-01-01T00:00:00Z"}}},
+		{name: "3. Запрещенный оператор", params: Params{Filters: map[string]string{"price": "gt:10"}}},
+		{name: "4. Неверное значение", params: Params{Filters: map[string]string{"id": "abc"}}},
+		{name: "5. Неизвестная сортировка", params: Params{Sort: "status"}},
+		{name: "6. Слишком большой лимит", params: Params{Limit: 1000}},
+		{name: "7. Неверный курсор", params: Params{Cursor: "not a cursor"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := testSpec.Parse(tt.params)
+			require.Error(t, err)
+
+			var customErr errors.Error
+			require.True(t, errors.As(err, &customErr))
+			assert.Equal(t, BadRequest, customErr.ErrorType)
+		})
+	}
+}
+
+func TestPaginate(t *testing.T) {
+
+	type order struct {
+		ID        int64
+		CreatedAt time.Time
+	}
+
+	createdAt := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	rows := []order{{ID: 3, CreatedAt: createdAt}, {ID: 2, CreatedAt: createdAt}, {ID: 1, CreatedAt: createdAt}}
+	value := func(row order, field string) any {
+		if field == "id" {
+			return row.ID
+		}
+		return row.CreatedAt
+	}
+
+	query, err := testSpec.Parse(Params{Limit: 2})
+	require.NoError(t, err)
+
+	page, cursor, err := Paginate(query, rows, value)
+	require.NoError(t, err)
+	assert.Len(t, page, 2)
+	require.NotEmpty(t, cursor)
+
+	// Курсор следующей страницы дает условие после последней строки
+	next, err := testSpec.Parse(Params{Limit: 2, Cursor: cursor})
+	require.NoError(t, err)
+
+	sql, args, err := next.Apply(sq.Select("o.id").From("orders o")).ToSql()
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT o.id FROM orders o WHERE (("o"."created_at" < ?) OR ("o"."created_at" = ? AND "o"."id" < ?)) ORDER BY "o"."created_at" DESC, "o"."id" DESC LIMIT 3`, sql)
+	assert.Equal(t, []any{createdAt, createdAt, int64(2)}, args)
+
+	// Курсор нельзя применить к другой сортировке
+	_, err = testSpec.Parse(Params{Sort: "price", Cursor: cursor})
+	assert.Error(t, err)
+
+	// Последняя страница без курсора
+	_, cursor, err = Paginate(next, rows[2:], value)
+	require.NoError(t, err)
+	assert.Empty(t, cursor)
+}
+
+func TestFormatValue(t *testing.T) {
+
+	createdAt := time.Date(2024, 1, 1, 10, 0, 0, 5, time.UTC)
+	id := int64(7)
+	name := "name"
+
+	tests := []struct {
+		name    string
+		value   any
+		want    string
+		wantErr bool
+	}{
+		{name: "1. Время", value: createdAt, want: "2024-01-01T10:00:00.000000005Z", wantErr: false},
+		{name: "2. Указатель на время", value: &createdAt, want: "2024-01-01T10:00:00.000000005Z", wantErr: false},
+		{name: "3. Указатель на число", value: &id, want: "7", wantErr: false},
+		{name: "4. Указатель на строку", value: &name, want: "name", wantErr: false},
+		{name: "5. Nil-указатель на время", value: (*time.Time)(nil), want: "", wantErr: true},
+		{name: "6. Nil", value: nil, want: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := formatValue(tt.value)
+			if tt.wantErr {
+				assert.True(t, errors.Is(err, ErrNullSortValue))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSpecParseInvalidKey(t *testing.T) {
+
+	spec := testSpec
+	spec.Key = "status"
+
+	_, err := spec.Parse(Params{})
+	assert.True(t, errors.Is(err, ErrInvalidKey))
+
+	spec.Key = "unknown"
+	_, err = spec.Parse(Params{})
+	assert.True(t, errors.Is(err, ErrInvalidKey))
+}
@@ -0,0 +1,286 @@
+package listQuery
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"pkg/ddlHelper"
+	"pkg/errors"
+)
+
+// BadRequest - ошибка в параметрах фильтрации, сортировки или пагинации
+var BadRequest = errors.ErrorType{
+	Name:      "BadRequest",
+	HTTPCode:  http.StatusBadRequest,
+	LogAs:     errors.LogAsWarning,
+	HumanText: "",
+}
+
+var (
+	// ErrInvalidKey - Spec.Key не указан среди сортируемых полей
+	ErrInvalidKey = errors.New("listQuery: key is not a sortable field")
+
+	// ErrNullSortValue - у последней строки страницы NULL в поле сортировки, курсор для такой строки не построить
+	ErrNullSortValue = errors.New("listQuery: sort field value is null")
+)
+
+// Значения по умолчанию для лимита
+const (
+	defaultLimit = 50
+	defaultMax   = 1000
+)
+
+// Operator - оператор фильтра в параметре запроса: ?price=gte:10
+type Operator string
+
+const (
+	OpEq    Operator = "eq"
+	OpNe    Operator = "ne"
+	OpGt    Operator = "gt"
+	OpGte   Operator = "gte"
+	OpLt    Operator = "lt"
+	OpLte   Operator = "lte"
+	OpIn    Operator = "in"
+	OpNotIn Operator = "nin"
+	OpLike  Operator = "like" // Подстрока без учета регистра
+	OpNull  Operator = "null" // null:true или null:false
+)
+
+var operators = []Operator{OpEq, OpNe, OpGt, OpGte, OpLt, OpLte, OpIn, OpNotIn, OpLike, OpNull}
+
+// FieldType - тип значения поля, по нему разбираются значения фильтров и курсора
+type FieldType int
+
+const (
+	TypeString FieldType = iota
+	TypeInt
+	TypeFloat
+	TypeBool
+	TypeTime // RFC 3339
+)
+
+// Field - поле, доступное для фильтрации и сортировки
+type Field struct {
+
+	// Колонка в запросе, можно с префиксом таблицы: u.created_at
+	Column string
+
+	Type FieldType
+
+	// Разрешенные операторы фильтра. Если пусто, по полю нельзя фильтровать
+	Operators []Operator
+
+	// Можно ли сортировать по полю
+	Sortable bool
+}
+
+// Spec - белый список полей для фильтрации и сортировки списка
+type Spec struct {
+
+	// Поля по имени параметра запроса
+	Fields map[string]Field
+
+	// Уникальное сортируемое поле, которое добавляется в конец сортировки, чтобы курсор однозначно определял позицию.
+	// Поля сортировки не должны принимать NULL, иначе Paginate вернет ErrNullSortValue
+	Key string
+
+	// Сортировка по умолчанию в формате параметра sort: "-created_at"
+	DefaultSort string
+
+	// Лимит по умолчанию и максимальный лимит, по умолчанию 50 и 1000
+	DefaultLimit uint64
+	MaxLimit     uint64
+
+	// Построитель выражений, по умолчанию ddlHelper.PG
+	Builder *ddlHelper.Builder
+}
+
+// Filter - разобранный фильтр по одному полю
+type Filter struct {
+	Field    string
+	Operator Operator
+	Values   []any
+}
+
+// Sort - разобранная сортировка по одному полю
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// Parse проверяет параметры по белому списку и возвращает запрос для Apply.
+// Неизвестные поля, операторы и неверные значения возвращают ошибку BadRequest
+func (s Spec) Parse(params Params) (Query, error) {
+
+	query := Query{
+		spec:    s,
+		filters: nil,
+		sorts:   nil,
+		limit:   0,
+		after:   nil,
+	}
+
+	// Ошибка в самой спецификации, а не в параметрах запроса
+	if field, ok := s.Fields[s.Key]; s.Key != "" && (!ok || !field.Sortable) {
+		return query, errors.Default.Wrap(ErrInvalidKey).WithParams("key", s.Key)
+	}
+
+	// Фильтры в порядке имен, чтобы запрос не зависел от порядка обхода map
+	names := make([]string, 0, len(params.Filters))
+	for name := range params.Filters {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		filter, err := s.parseFilter(name, params.Filters[name])
+		if err != nil {
+			return query, err
+		}
+		query.filters = append(query.filters, filter)
+	}
+
+	sorts, err := s.parseSort(params.Sort)
+	if err != nil {
+		return query, err
+	}
+	query.sorts = sorts
+
+	if query.limit, err = s.parseLimit(params.Limit); err != nil {
+		return query, err
+	}
+
+	if params.Cursor != "" {
+		if query.after, err = s.decodeCursor(params.Cursor, sorts); err != nil {
+			return query, err
+		}
+	}
+
+	return query, nil
+}
+
+func (s Spec) parseFilter(name, raw string) (Filter, error) {
+
+	field, ok := s.Fields[name]
+	if !ok || len(field.Operators) == 0 {
+		return Filter{}, BadRequest.New("unknown filter field").WithParams("field", name)
+	}
+
+	// Оператор необязателен: ?status=active означает eq
+	operator, value := OpEq, raw
+	if prefix, rest, found := strings.Cut(raw, ":"); found && slices.Contains(operators, Operator(prefix)) {
+		operator, value = Operator(prefix), rest
+	}
+
+	if !slices.Contains(field.Operators, operator) {
+		return Filter{}, BadRequest.New("operator is not allowed").WithParams("field", name, "operator", operator)
+	}
+
+	filter := Filter{Field: name, Operator: operator, Values: nil}
+
+	switch operator {
+	case OpNull:
+		isNull, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, BadRequest.Wrap(err).WithParams("field", name, "value", value)
+		}
+		filter.Values = []any{isNull}
+		return filter, nil
+	case OpLike:
+		filter.Values = []any{value}
+		return filter, nil
+	}
+
+	rawValues := []string{value}
+	if operator == OpIn || operator == OpNotIn {
+		rawValues = strings.Split(value, ",")
+	}
+
+	for _, rawValue := range rawValues {
+		parsed, err := parseValue(field.Type, rawValue)
+		if err != nil {
+			return filter, BadRequest.Wrap(err).WithParams("field", name, "value", rawValue)
+		}
+		filter.Values = append(filter.Values, parsed)
+	}
+
+	return filter, nil
+}
+
+// parseSort разбирает sort=-created_at,name и добавляет ключевое поле
+func (s Spec) parseSort(raw string) ([]Sort, error) {
+
+	if raw == "" {
+		raw = s.DefaultSort
+	}
+
+	var sorts []Sort
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		sort := Sort{Field: strings.TrimPrefix(item, "-"), Desc: strings.HasPrefix(item, "-")}
+		if field, ok := s.Fields[sort.Field]; !ok || !field.Sortable {
+			return nil, BadRequest.New("unknown sort field").WithParams("field", sort.Field)
+		}
+		if slices.ContainsFunc(sorts, func(s Sort) bool { return s.Field == sort.Field }) {
+			return nil, BadRequest.New("duplicate sort field").WithParams("field", sort.Field)
+		}
+		sorts = append(sorts, sort)
+	}
+
+	if s.Key != "" && !slices.ContainsFunc(sorts, func(sort Sort) bool { return sort.Field == s.Key }) {
+		desc := len(sorts) > 0 && sorts[len(sorts)-1].Desc
+		sorts = append(sorts, Sort{Field: s.Key, Desc: desc})
+	}
+
+	return sorts, nil
+}
+
+func (s Spec) parseLimit(limit uint64) (uint64, error) {
+
+	limitDefault, maxLimit := s.DefaultLimit, s.MaxLimit
+	if limitDefault == 0 {
+		limitDefault = defaultLimit
+	}
+	if maxLimit == 0 {
+		maxLimit = defaultMax
+	}
+
+	if limit == 0 {
+		return min(limitDefault, maxLimit), nil
+	}
+	if limit > maxLimit {
+		return 0, BadRequest.New("limit is too large").WithParams("limit", limit, "max", maxLimit)
+	}
+
+	return limit, nil
+}
+
+func (s Spec) builder() ddlHelper.Builder {
+	if s.Builder != nil {
+		return *s.Builder
+	}
+	return ddlHelper.PG
+}
+
+// parseValue разбирает значение фильтра или курсора по типу поля
+func parseValue(typ FieldType, raw string) (any, error) {
+	switch typ {
+	case TypeInt:
+		return strconv.ParseInt(raw, 10, 64)
+	case TypeFloat:
+		return strconv.ParseFloat(raw, 64)
+	case TypeBool:
+		return strconv.ParseBool(raw)
+	case TypeTime:
+		return time.Parse(time.RFC3339Nano, raw)
+	default:
+		return raw, nil
+	}
+}
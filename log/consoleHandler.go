@@ -120,6 +120,16 @@ func (h *ConsoleHandler) handle(log Log) {
 		state.buf.WriteString(fmt.Sprintf("%+v", value))
 	}
 
+	if log.traceID != "" {
+		state.buf.WriteByte(' ')
+		state.buf.WriteString(colorDarkGray)
+		state.buf.WriteString("trace_id=")
+		state.buf.WriteString(log.traceID)
+		state.buf.WriteString(" span_id=")
+		state.buf.WriteString(log.spanID)
+		state.buf.WriteString(colorReset)
+	}
+
 	state.buf.WriteByte('\n')
 
 	_, err := state.buf.WriteTo(h.w)
@@ -0,0 +1,456 @@
+package log
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"pkg/errors"
+)
+
+// backupTimeFormat - формат времени в имени ротированного файла, сортируется лексикографически
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+const compressSuffix = ".gz"
+
+// FileHandlerConfig - настройки файлового обработчика
+type FileHandlerConfig struct {
+
+	// Путь до файла лога
+	Path string `env:"LOG_FILE_PATH"`
+
+	// Формат записей в файле, по умолчанию JSON
+	Format LogFormat `env:"LOG_FILE_FORMAT" envDefault:""`
+
+	// Размер файла в байтах, после которого файл ротируется. 0 - без ротации по размеру
+	MaxSize int64 `env:"LOG_FILE_MAX_SIZE" envDefault:""`
+
+	// Время жизни файла, после которого файл ротируется. 0 - без ротации по времени
+	RotateInterval time.Duration `env:"LOG_FILE_ROTATE_INTERVAL" envDefault:""`
+
+	// Количество хранимых ротированных файлов. 0 - хранятся все
+	MaxBackups int `env:"LOG_FILE_MAX_BACKUPS" envDefault:""`
+
+	// Сжимать ли ротированные файлы в gzip
+	Compress bool `env:"LOG_FILE_COMPRESS" envDefault:""`
+}
+
+var _ Handler = new(FileHandler)
+var _ io.Writer = new(FileHandler)
+
+func (h *FileHandler) SetLogLevel(level LogLevel) {
+	h.formatter.SetLogLevel(level)
+}
+
+func (h *FileHandler) GetLogLevel() LogLevel {
+	return h.formatter.GetLogLevel()
+}
+
+// FileHandler - это версия обработчика журналов для записи в файл с ротацией по размеру и времени.
+//
+// Форматирование делегируется JSONHandler или ConsoleHandler, которые пишут в сам FileHandler как в io.Writer.
+// По сигналу SIGHUP файл переоткрывается, чтобы обработчик работал вместе с logrotate
+type FileHandler struct {
+	cfg       FileHandlerConfig
+	formatter Handler
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	closed   bool
+
+	// Время последнего бэкапа, чтобы имена бэкапов не совпадали при частой ротации
+	lastBackupAt time.Time
+
+	millCh  chan struct{}
+	signals chan os.Signal
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewFileHandler возвращает новый экземпляр FileHandler.
+//
+// Обработчик запускает фоновые горутины, поэтому после использования его нужно закрыть через Close
+func NewFileHandler(cfg FileHandlerConfig, level LogLevel) (*FileHandler, error) {
+
+	if cfg.Path == "" {
+		return nil, errors.Default.New("log file path is empty")
+	}
+
+	if cfg.Format == "" {
+		cfg.Format = JSONFormat
+	}
+	if err := cfg.Format.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0o755); err != nil { //nolint:gosec
+		return nil, errors.Default.Wrap(err)
+	}
+
+	h := &FileHandler{
+		cfg:          cfg,
+		formatter:    nil,
+		mu:           sync.Mutex{},
+		file:         nil,
+		size:         0,
+		openedAt:     time.Time{},
+		closed:       false,
+		lastBackupAt: time.Time{},
+		millCh:       make(chan struct{}, 1),
+		signals:      make(chan os.Signal, 1),
+		done:         make(chan struct{}),
+		wg:           sync.WaitGroup{},
+	}
+
+	switch cfg.Format {
+	case TextFormat:
+		h.formatter = NewTextHandler(h, level)
+	case JSONFormat:
+		h.formatter = NewJSONHandler(h, level)
+	}
+
+	if err := h.openFile(); err != nil {
+		return nil, err
+	}
+
+	signal.Notify(h.signals, syscall.SIGHUP)
+
+	h.wg.Add(2)
+	go h.runMill()
+	go h.listenSignals()
+
+	// Подчищаем файлы, оставшиеся от прошлых запусков
+	h.triggerMill()
+
+	return h, nil
+}
+
+// handle реализует интерфейс Handler.
+func (h *FileHandler) handle(log Log) {
+	h.formatter.handle(log)
+}
+
+// Write реализует интерфейс io.Writer, при необходимости ротируя файл перед записью
+func (h *FileHandler) Write(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return 0, errors.Default.New("log file handler is closed")
+	}
+
+	if h.shouldRotate(len(p)) {
+		if err := h.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := h.file.Write(p)
+	h.size += int64(n)
+	if err != nil {
+		return n, errors.Default.Wrap(err)
+	}
+
+	return n, nil
+}
+
+// Rotate принудительно ротирует файл
+func (h *FileHandler) Rotate() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return errors.Default.New("log file handler is closed")
+	}
+
+	return h.rotate()
+}
+
+// Reopen закрывает и заново открывает файл по тому же пути.
+// Используется, когда файл переместили снаружи, например logrotate
+func (h *FileHandler) Reopen() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return errors.Default.New("log file handler is closed")
+	}
+
+	// Файл уже не пригоден для записи, поэтому при ошибке закрытия все равно открываем новый
+	h.closeFile()
+
+	return h.openFile()
+}
+
+// Close останавливает фоновые горутины, закрывает файл и дообрабатывает ротированные файлы
+func (h *FileHandler) Close() error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil
+	}
+	h.closed = true
+	err := h.file.Close()
+	h.mu.Unlock()
+
+	signal.Stop(h.signals)
+	close(h.done)
+	h.wg.Wait()
+
+	if err != nil {
+		return errors.Default.Wrap(err)
+	}
+
+	return h.mill()
+}
+
+func (h *FileHandler) shouldRotate(writeLen int) bool {
+
+	// Пустой файл не ротируем, иначе запись больше MaxSize будет ротировать файл бесконечно
+	if h.size == 0 {
+		return false
+	}
+
+	if h.cfg.MaxSize > 0 && h.size+int64(writeLen) > h.cfg.MaxSize {
+		return true
+	}
+
+	if h.cfg.RotateInterval > 0 && time.Since(h.openedAt) >= h.cfg.RotateInterval {
+		return true
+	}
+
+	return false
+}
+
+// rotate переименовывает текущий файл в бэкап и открывает новый. Вызывается под мьютексом
+func (h *FileHandler) rotate() error {
+
+	// Файл уже не пригоден для записи, поэтому при ошибке закрытия все равно продолжаем ротацию
+	h.closeFile()
+
+	backupAt := time.Now().Truncate(time.Millisecond)
+	if !backupAt.After(h.lastBackupAt) {
+		backupAt = h.lastBackupAt.Add(time.Millisecond)
+	}
+	h.lastBackupAt = backupAt
+
+	if err := os.Rename(h.cfg.Path, h.backupName(backupAt)); err != nil {
+
+		// Продолжаем писать в старый файл, чтобы не терять логи
+		if openErr := h.openFile(); openErr != nil {
+			return errors.Default.Wrap(openErr)
+		}
+		return errors.Default.Wrap(err)
+	}
+
+	if err := h.openFile(); err != nil {
+		return err
+	}
+
+	h.triggerMill()
+
+	return nil
+}
+
+// closeFile закрывает текущий файл перед открытием нового. Ошибку некуда вернуть, не потеряв новый файл,
+// поэтому она пишется в stderr. Вызывается под мьютексом
+func (h *FileHandler) closeFile() {
+	if err := h.file.Close(); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "logging: could not close log file: %s\n", err)
+	}
+}
+
+// openFile открывает файл на дозапись. Вызывается под мьютексом
+func (h *FileHandler) openFile() error {
+
+	file, err := os.OpenFile(h.cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644) //nolint:gosec
+	if err != nil {
+		return errors.Default.Wrap(err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return errors.Default.Wrap(err)
+	}
+
+	h.file = file
+	h.size = info.Size()
+	h.openedAt = time.Now()
+
+	return nil
+}
+
+func (h *FileHandler) backupName(t time.Time) string {
+	dir, prefix, ext := h.splitPath()
+	return filepath.Join(dir, prefix+t.Format(backupTimeFormat)+ext)
+}
+
+// splitPath возвращает директорию, префикс имени бэкапа и расширение файла
+func (h *FileHandler) splitPath() (dir, prefix, ext string) {
+	dir = filepath.Dir(h.cfg.Path)
+	base := filepath.Base(h.cfg.Path)
+	ext = filepath.Ext(base)
+	prefix = strings.TrimSuffix(base, ext) + "-"
+	return dir, prefix, ext
+}
+
+func (h *FileHandler) triggerMill() {
+	select {
+	case h.millCh <- struct{}{}:
+	default:
+	}
+}
+
+// runMill сжимает ротированные файлы и удаляет лишние бэкапы в фоне, чтобы не блокировать запись
+func (h *FileHandler) runMill() {
+	defer h.wg.Done()
+
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-h.millCh:
+			if err := h.mill(); err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "logging: could not process rotated log files: %s\n", err)
+			}
+		}
+	}
+}
+
+func (h *FileHandler) listenSignals() {
+	defer h.wg.Done()
+
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-h.signals:
+			if err := h.Reopen(); err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "logging: could not reopen log file: %s\n", err)
+			}
+		}
+	}
+}
+
+func (h *FileHandler) mill() error {
+
+	backups, err := h.listBackups()
+	if err != nil {
+		return err
+	}
+
+	if h.cfg.Compress {
+		for i, backup := range backups {
+			if strings.HasSuffix(backup, compressSuffix) {
+				continue
+			}
+			if err = compressFile(backup); err != nil {
+				return err
+			}
+			backups[i] = backup + compressSuffix
+		}
+	}
+
+	if h.cfg.MaxBackups <= 0 || len(backups) <= h.cfg.MaxBackups {
+		return nil
+	}
+
+	// Бэкапы отсортированы от новых к старым, удаляем хвост
+	for _, backup := range backups[h.cfg.MaxBackups:] {
+		if err = os.Remove(backup); err != nil && !os.IsNotExist(err) {
+			return errors.Default.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+// listBackups возвращает пути ротированных файлов, отсортированные от новых к старым
+func (h *FileHandler) listBackups() ([]string, error) {
+
+	dir, prefix, ext := h.splitPath()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Default.Wrap(err)
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		timestamp := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(name, prefix), compressSuffix), ext)
+		if _, err = time.Parse(backupTimeFormat, timestamp); err != nil {
+			continue
+		}
+
+		backups = append(backups, filepath.Join(dir, name))
+	}
+
+	slices.SortFunc(backups, func(a, b string) int {
+		return strings.Compare(b, a)
+	})
+
+	return backups, nil
+}
+
+// compressFile сжимает файл в gzip рядом с оригиналом и удаляет оригинал
+func compressFile(path string) (err error) {
+
+	src, err := os.Open(path) //nolint:gosec
+	if err != nil {
+		return errors.Default.Wrap(err)
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+compressSuffix, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644) //nolint:gosec
+	if err != nil {
+		return errors.Default.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = os.Remove(path + compressSuffix)
+		}
+	}()
+
+	gz := gzip.NewWriter(dst)
+
+	if _, err = io.Copy(gz, src); err != nil {
+		_ = dst.Close()
+		return errors.Default.Wrap(err)
+	}
+
+	if err = gz.Close(); err != nil {
+		_ = dst.Close()
+		return errors.Default.Wrap(err)
+	}
+
+	if err = dst.Close(); err != nil {
+		return errors.Default.Wrap(err)
+	}
+
+	if err = os.Remove(path); err != nil {
+		return errors.Default.Wrap(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,198 @@
+package log
+
+import (
+	"bufio"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileHandler(t *testing.T) {
+
+	t.Run("1. Ротация по размеру с ограничением количества бэкапов", func(t *testing.T) {
+		dir := t.TempDir()
+
+		h, err := NewFileHandler(FileHandlerConfig{
+			Path:       filepath.Join(dir, "app.log"),
+			Format:     JSONFormat,
+			MaxSize:    512,
+			MaxBackups: 2,
+		}, LevelDebug)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 50; i++ {
+			h.handle(emptyLog().ChangeLog(LevelInfo, strings.Repeat("x", 100)))
+		}
+
+		if err = h.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		backups, err := h.listBackups()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(backups) != 2 {
+			t.Fatalf("Должно остаться 2 бэкапа, осталось %d", len(backups))
+		}
+
+		info, err := os.Stat(filepath.Join(dir, "app.log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > 512 {
+			t.Fatalf("Размер текущего файла %d больше максимального", info.Size())
+		}
+	})
+
+	t.Run("2. Сжатие ротированных файлов", func(t *testing.T) {
+		dir := t.TempDir()
+
+		h, err := NewFileHandler(FileHandlerConfig{
+			Path:     filepath.Join(dir, "app.log"),
+			Compress: true,
+		}, LevelDebug)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		h.handle(emptyLog().ChangeLog(LevelInfo, "before rotation"))
+
+		if err = h.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+
+		var backups []string
+		for i := 0; i < 100; i++ {
+			backups, err = h.listBackups()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(backups) == 1 && strings.HasSuffix(backups[0], compressSuffix) {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if err = h.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(backups) != 1 || !strings.HasSuffix(backups[0], compressSuffix) {
+			t.Fatalf("Ожидался один сжатый бэкап, получено %v", backups)
+		}
+
+		file, err := os.Open(backups[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		scanner := bufio.NewScanner(gz)
+		if !scanner.Scan() || !strings.Contains(scanner.Text(), "before rotation") {
+			t.Fatalf("В бэкапе нет записанного лога")
+		}
+	})
+
+	t.Run("3. Конкурентная запись не разрывает строки", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.log")
+
+		h, err := NewFileHandler(FileHandlerConfig{
+			Path:    path,
+			Format:  TextFormat,
+			MaxSize: 4096,
+		}, LevelDebug)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					h.handle(emptyLog().ChangeLog(LevelInfo, "message"))
+				}
+			}()
+		}
+		wg.Wait()
+
+		if err = h.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		backups, err := h.listBackups()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var lines int
+		for _, name := range append(backups, path) {
+			content, err := os.ReadFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, line := range strings.Split(strings.TrimSuffix(string(content), "\n"), "\n") {
+				if !strings.HasSuffix(line, "message") {
+					t.Fatalf("Строка лога повреждена: %q", line)
+				}
+				lines++
+			}
+		}
+
+		if lines != 1000 {
+			t.Fatalf("Записано %d строк вместо 1000", lines)
+		}
+	})
+
+	t.Run("4. Ошибка закрытия файла не ломает дальнейшую запись", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.log")
+
+		h, err := NewFileHandler(FileHandlerConfig{
+			Path:   path,
+			Format: TextFormat,
+		}, LevelDebug)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Закрываем файл снаружи, чтобы Close в Reopen и Rotate вернул ошибку
+		_ = h.file.Close()
+		if err = h.Reopen(); err != nil {
+			t.Fatal(err)
+		}
+		h.handle(emptyLog().ChangeLog(LevelInfo, "after reopen"))
+
+		_ = h.file.Close()
+		if err = h.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+		h.handle(emptyLog().ChangeLog(LevelInfo, "after rotate"))
+
+		if err = h.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(content), "after rotate") {
+			t.Fatalf("Лог после ротации не записан: %q", content)
+		}
+	})
+}
@@ -23,6 +23,8 @@ type jsonLog struct {
 	Message    string           `json:"message"`
 	StackTrace []string         `json:"stackTrace"`
 	Params     map[string]any   `json:"params,omitempty"`
+	TraceID    string           `json:"traceId,omitempty"`
+	SpanID     string           `json:"spanId,omitempty"`
 	SystemInfo model.SystemInfo `json:"systemInfo"`
 }
 
@@ -84,6 +86,8 @@ func (h *JSONHandler) handle(log Log) {
 			Message:    message,
 			StackTrace: customErr.StackTrace,
 			Params:     maps.Join(log.params, customErr.Params),
+			TraceID:    log.traceID,
+			SpanID:     log.spanID,
 			SystemInfo: logger.systemInfo,
 		}
 	default:
@@ -92,6 +96,8 @@ func (h *JSONHandler) handle(log Log) {
 			Message:    fmt.Sprintf("%v", v),
 			StackTrace: stackTrace.GetStackTrace(errors.SkipPreviousCaller),
 			Params:     log.params,
+			TraceID:    log.traceID,
+			SpanID:     log.spanID,
 			SystemInfo: logger.systemInfo,
 		}
 	}
@@ -90,6 +90,10 @@ func easyjson65a741d4DecodePkgLog(in *jlexer.Lexer, out *jsonLog) {
 				}
 				in.Delim('}')
 			}
+		case "traceId":
+			out.TraceID = string(in.String())
+		case "spanId":
+			out.SpanID = string(in.String())
 		case "systemInfo":
 			easyjson65a741d4DecodePkgLogModel(in, &out.SystemInfo)
 		default:
@@ -157,6 +161,16 @@ func easyjson65a741d4EncodePkgLog(out *jwriter.Writer, in jsonLog) {
 			out.RawByte('}')
 		}
 	}
+	if in.TraceID != "" {
+		const prefix string = ",\"traceId\":"
+		out.RawString(prefix)
+		out.String(string(in.TraceID))
+	}
+	if in.SpanID != "" {
+		const prefix string = ",\"spanId\":"
+		out.RawString(prefix)
+		out.String(string(in.SpanID))
+	}
 	{
 		const prefix string = ",\"systemInfo\":"
 		out.RawString(prefix)
@@ -14,6 +14,10 @@ type Log struct {
 	content    any
 	params     map[string]any
 	stackTrace []string
+
+	// Идентификаторы трейса и спана из контекста в hex-формате W3C, проставляются через WithContextParams
+	traceID string
+	spanID  string
 }
 
 // loggerSettings - конфигурация логгера
@@ -52,6 +56,7 @@ func Init(
 }
 
 func handle(log Log) {
+	log = redactLog(log)
 	for _, handler := range logger.handlers {
 		handler.handle(log)
 	}
@@ -80,6 +85,8 @@ func emptyLog() Log {
 		content:    nil,
 		params:     make(map[string]any),
 		stackTrace: stackTrace.GetStackTrace(errors.SkipPreviousCaller),
+		traceID:    "",
+		spanID:     "",
 	}
 }
 
@@ -10,6 +10,9 @@ import (
 
 func (l Log) WithContextParams(ctx context.Context) Log {
 
+	// Получаем идентификаторы трейса и спана из контекста
+	l.traceID, l.spanID = traceFromContext(ctx)
+
 	// Получаем параметры из контекста
 	contextParams := contextMap.GetMap(ctx)
 
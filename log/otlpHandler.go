@@ -0,0 +1,497 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	stdErrors "errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"pkg/errors"
+	"pkg/log/model"
+	"pkg/maps"
+)
+
+const (
+	defaultOTLPBatchSize     = 512
+	defaultOTLPFlushInterval = 5 * time.Second
+	defaultOTLPTimeout       = 10 * time.Second
+	otlpScopeName            = "pkg/log"
+)
+
+// OTLPHandlerConfig - настройки обработчика, экспортирующего логи по протоколу OTLP/HTTP в формате JSON
+type OTLPHandlerConfig struct {
+
+	// Полный адрес приемника логов, например http://otel-collector:4318/v1/logs
+	Endpoint string `env:"OTEL_EXPORTER_OTLP_LOGS_ENDPOINT"`
+
+	// Дополнительные заголовки запроса, например для авторизации
+	Headers map[string]string `env:"OTEL_EXPORTER_OTLP_LOGS_HEADERS" envKeyValSeparator:"=" envDefault:""`
+
+	// Таймаут отправки одной пачки
+	Timeout time.Duration `env:"OTEL_EXPORTER_OTLP_LOGS_TIMEOUT" envDefault:""`
+
+	// Размер пачки, при достижении которого записи отправляются, не дожидаясь FlushInterval
+	BatchSize int `env:"OTEL_BLRP_MAX_EXPORT_BATCH_SIZE" envDefault:""`
+
+	// Максимальное количество записей в очереди, лишние записи отбрасываются
+	MaxQueueSize int `env:"OTEL_BLRP_MAX_QUEUE_SIZE" envDefault:""`
+
+	// Интервал отправки накопленных записей
+	FlushInterval time.Duration `env:"OTEL_BLRP_SCHEDULE_DELAY" envDefault:""`
+}
+
+// Номера уровней из модели данных логов OpenTelemetry
+const (
+	otlpSeverityDebug = 5
+	otlpSeverityInfo  = 9
+	otlpSeverityWarn  = 13
+	otlpSeverityError = 17
+	otlpSeverityFatal = 21
+)
+
+type (
+	otlpExportRequest struct {
+		ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+	}
+
+	otlpResourceLogs struct {
+		Resource  otlpResource    `json:"resource"`
+		ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+	}
+
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+
+	otlpScopeLogs struct {
+		Scope      otlpScope       `json:"scope"`
+		LogRecords []otlpLogRecord `json:"logRecords"`
+	}
+
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+
+	otlpLogRecord struct {
+		TimeUnixNano         string         `json:"timeUnixNano"`
+		ObservedTimeUnixNano string         `json:"observedTimeUnixNano"`
+		SeverityNumber       int            `json:"severityNumber"`
+		SeverityText         string         `json:"severityText"`
+		Body                 otlpAnyValue   `json:"body"`
+		Attributes           []otlpKeyValue `json:"attributes,omitempty"`
+		TraceID              string         `json:"traceId,omitempty"`
+		SpanID               string         `json:"spanId,omitempty"`
+	}
+
+	otlpKeyValue struct {
+		Key   string       `json:"key"`
+		Value otlpAnyValue `json:"value"`
+	}
+
+	// otlpAnyValue - значение атрибута, заполняется ровно одно поле
+	otlpAnyValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+	}
+)
+
+var _ Handler = new(OTLPHandler)
+
+func (h *OTLPHandler) SetLogLevel(level LogLevel) {
+	h.logLevel.Store(level)
+}
+
+func (h *OTLPHandler) GetLogLevel() LogLevel {
+	logLevel, ok := h.logLevel.Load().(LogLevel)
+	if !ok {
+		return ""
+	}
+	return logLevel
+}
+
+// OTLPHandler - это версия обработчика журналов, которая пачками отправляет логи в коллектор OpenTelemetry.
+//
+// SystemInfo отображается в атрибуты ресурса, параметры лога - в атрибуты записи,
+// trace_id и span_id берутся из контекста, переданного в WithContextParams
+type OTLPHandler struct {
+	logLevel atomic.Value
+	cfg      OTLPHandlerConfig
+	client   *http.Client
+
+	mu      sync.Mutex
+	records []otlpLogRecord
+	dropped int
+
+	flushCh chan struct{}
+	done    chan struct{}
+	wg      sync.WaitGroup
+	closed  atomic.Bool
+}
+
+// NewOTLPHandler возвращает новый экземпляр OTLPHandler.
+//
+// Обработчик запускает фоновую горутину отправки, поэтому после использования его нужно закрыть через Close
+func NewOTLPHandler(cfg OTLPHandlerConfig, level LogLevel) (*OTLPHandler, error) {
+
+	if cfg.Endpoint == "" {
+		return nil, errors.Default.New("otlp logs endpoint is empty")
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultOTLPTimeout
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultOTLPBatchSize
+	}
+	if cfg.MaxQueueSize < cfg.BatchSize {
+		cfg.MaxQueueSize = cfg.BatchSize * 4
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultOTLPFlushInterval
+	}
+
+	h := &OTLPHandler{
+		logLevel: atomic.Value{},
+		cfg:      cfg,
+		client: &http.Client{
+			Transport:     nil,
+			CheckRedirect: nil,
+			Jar:           nil,
+			Timeout:       cfg.Timeout,
+		},
+		mu:      sync.Mutex{},
+		records: make([]otlpLogRecord, 0, cfg.BatchSize),
+		dropped: 0,
+		flushCh: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		wg:      sync.WaitGroup{},
+		closed:  atomic.Bool{},
+	}
+	h.logLevel.Store(level)
+
+	h.wg.Add(1)
+	go h.run()
+
+	return h, nil
+}
+
+// handle реализует интерфейс Handler.
+func (h *OTLPHandler) handle(log Log) {
+
+	if h.GetLogLevel().GreaterThan(log.level) || h.closed.Load() {
+		return
+	}
+
+	record := newOTLPLogRecord(log)
+
+	h.mu.Lock()
+	if len(h.records) >= h.cfg.MaxQueueSize {
+		h.dropped++
+		h.mu.Unlock()
+		return
+	}
+	h.records = append(h.records, record)
+	batchIsFull := len(h.records) >= h.cfg.BatchSize
+	h.mu.Unlock()
+
+	// Фатальные логи отправляем сразу, так как после них процесс завершается
+	if batchIsFull || log.level == LevelFatal {
+		select {
+		case h.flushCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Flush отправляет все накопленные записи. Если пачку не удалось отправить, остальные пачки все равно отправляются.
+// Записи пачек с временной ошибкой (сеть, 429, 5xx) возвращаются в очередь в пределах MaxQueueSize и уходят при следующем сбросе,
+// записи пачек, которые приемник отклонил, отбрасываются
+func (h *OTLPHandler) Flush(ctx context.Context) error {
+
+	h.mu.Lock()
+	records := h.records
+	h.records = make([]otlpLogRecord, 0, h.cfg.BatchSize)
+	h.mu.Unlock()
+
+	var (
+		errs     []error
+		failed   []otlpLogRecord
+		rejected int
+	)
+	for batch := range slices.Chunk(records, h.cfg.BatchSize) {
+		retryable, err := h.export(ctx, batch)
+		if err == nil {
+			continue
+		}
+		errs = append(errs, err)
+		if retryable {
+			failed = append(failed, batch...)
+		} else {
+			rejected += len(batch)
+		}
+	}
+
+	h.mu.Lock()
+	h.dropped += rejected
+	if len(failed) != 0 {
+
+		// После Close следующего сброса не будет, поэтому неотправленные записи теряются
+		if h.closed.Load() {
+			h.dropped += len(failed)
+		} else {
+			queue := append(failed, h.records...)
+
+			// Если очередь переполнена, отбрасываем самые старые записи
+			if overflow := len(queue) - h.cfg.MaxQueueSize; overflow > 0 {
+				h.dropped += overflow
+				queue = queue[overflow:]
+			}
+			h.records = queue
+		}
+	}
+	dropped := h.dropped
+	h.dropped = 0
+	h.mu.Unlock()
+
+	if dropped != 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "logging: otlp export failed or queue is full, dropped %d records\n", dropped)
+	}
+
+	if len(errs) != 0 {
+		return errors.Default.Wrap(stdErrors.Join(errs...)).WithParams("failed", len(failed), "dropped", dropped)
+	}
+
+	return nil
+}
+
+// Close останавливает фоновую отправку и отправляет оставшиеся записи
+func (h *OTLPHandler) Close(ctx context.Context) error {
+	if h.closed.Swap(true) {
+		return nil
+	}
+
+	close(h.done)
+	h.wg.Wait()
+
+	return h.Flush(ctx)
+}
+
+func (h *OTLPHandler) run() {
+	defer h.wg.Done()
+
+	ticker := time.NewTicker(h.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-ticker.C:
+		case <-h.flushCh:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), h.cfg.Timeout)
+		if err := h.Flush(ctx); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "logging: could not export logs to otlp: %s\n", err)
+		}
+		cancel()
+	}
+}
+
+// export отправляет пачку записей. retryable сообщает, имеет ли смысл отправить пачку повторно:
+// повторяются ошибки сети и ответы 429 и 5xx, остальные ошибки повторятся и при следующей отправке
+func (h *OTLPHandler) export(ctx context.Context, records []otlpLogRecord) (retryable bool, err error) {
+
+	body, err := json.Marshal(otlpExportRequest{
+		ResourceLogs: []otlpResourceLogs{{
+			Resource: otlpResource{
+				Attributes: otlpResourceAttributes(logger.systemInfo),
+			},
+			ScopeLogs: []otlpScopeLogs{{
+				Scope:      otlpScope{Name: otlpScopeName},
+				LogRecords: records,
+			}},
+		}},
+	})
+	if err != nil {
+		return false, errors.Default.Wrap(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, errors.Default.Wrap(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range h.cfg.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return true, errors.Default.Wrap(err)
+	}
+	defer resp.Body.Close()
+
+	// Вычитываем тело, чтобы соединение вернулось в пул
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		retryable = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+		return retryable, errors.Default.New("otlp receiver returned unexpected status").WithParams(
+			"status", resp.StatusCode,
+			"body", string(respBody),
+		)
+	}
+
+	return false, nil
+}
+
+func newOTLPLogRecord(log Log) otlpLogRecord {
+
+	var (
+		message    string
+		params     map[string]any
+		stackTrace []string
+	)
+
+	switch v := log.content.(type) {
+	case error:
+		customErr := errors.CastError(v)
+
+		if customErr.Err != nil {
+			message = customErr.Error()
+		} else {
+			message = "unknown error"
+		}
+
+		params = maps.Join(log.params, customErr.Params)
+		stackTrace = customErr.StackTrace
+	default:
+		message = fmt.Sprintf("%v", v)
+		params = log.params
+		stackTrace = log.stackTrace
+	}
+
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	attributes := make([]otlpKeyValue, 0, len(keys)+1)
+	for _, key := range keys {
+		attributes = append(attributes, otlpKeyValue{Key: key, Value: newOTLPAnyValue(params[key])})
+	}
+
+	if len(stackTrace) != 0 {
+		attributes = append(attributes, otlpKeyValue{
+			Key:   "exception.stacktrace",
+			Value: newOTLPAnyValue(strings.Join(stackTrace, "\n")),
+		})
+	}
+
+	now := strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	return otlpLogRecord{
+		TimeUnixNano:         now,
+		ObservedTimeUnixNano: now,
+		SeverityNumber:       logLevelToOTLPSeverity(log.level),
+		SeverityText:         strings.ToUpper(log.level.String()),
+		Body:                 newOTLPAnyValue(message),
+		Attributes:           attributes,
+		TraceID:              log.traceID,
+		SpanID:               log.spanID,
+	}
+}
+
+// otlpResourceAttributes отображает SystemInfo в атрибуты ресурса по семантическим соглашениям OpenTelemetry
+func otlpResourceAttributes(systemInfo model.SystemInfo) []otlpKeyValue {
+
+	attributes := make([]otlpKeyValue, 0, 6)
+
+	for _, attr := range []struct{ key, value string }{
+		{"service.name", systemInfo.ServiceName},
+		{"service.version", systemInfo.Version},
+		{"host.name", systemInfo.Hostname},
+		{"deployment.environment", systemInfo.Env},
+		{"service.build", systemInfo.Build},
+		{"service.build_date", systemInfo.BuildDate},
+	} {
+		if attr.value != "" {
+			attributes = append(attributes, otlpKeyValue{Key: attr.key, Value: newOTLPAnyValue(attr.value)})
+		}
+	}
+
+	return attributes
+}
+
+func newOTLPAnyValue(value any) otlpAnyValue {
+
+	var anyValue otlpAnyValue
+
+	switch v := value.(type) {
+	case string:
+		anyValue.StringValue = &v
+	case bool:
+		anyValue.BoolValue = &v
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		s := fmt.Sprintf("%d", v)
+		anyValue.IntValue = &s
+	case float32:
+		anyValue = newOTLPDoubleValue(float64(v))
+	case float64:
+		anyValue = newOTLPDoubleValue(v)
+	default:
+		s := fmt.Sprintf("%+v", v)
+		anyValue.StringValue = &s
+	}
+
+	return anyValue
+}
+
+// newOTLPDoubleValue возвращает значение с плавающей точкой. NaN и бесконечности не кодируются в JSON,
+// поэтому передаются строкой
+func newOTLPDoubleValue(v float64) otlpAnyValue {
+
+	var anyValue otlpAnyValue
+
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		anyValue.StringValue = &s
+	} else {
+		anyValue.DoubleValue = &v
+	}
+
+	return anyValue
+}
+
+func logLevelToOTLPSeverity(level LogLevel) int {
+	switch level {
+	case LevelDebug:
+		return otlpSeverityDebug
+	case LevelInfo:
+		return otlpSeverityInfo
+	case LevelWarning:
+		return otlpSeverityWarn
+	case LevelError:
+		return otlpSeverityError
+	case LevelFatal:
+		return otlpSeverityFatal
+	default:
+		return 0
+	}
+}
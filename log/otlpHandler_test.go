@@ -0,0 +1,254 @@
+package log
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"pkg/errors"
+	"pkg/log/model"
+)
+
+func TestOTLPHandler(t *testing.T) {
+
+	var (
+		mu       sync.Mutex
+		requests []otlpExportRequest
+		headers  []http.Header
+	)
+
+	// Заглушка приемника OTLP/HTTP
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req otlpExportRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		requests = append(requests, req)
+		headers = append(headers, r.Header.Clone())
+		mu.Unlock()
+	}))
+	defer receiver.Close()
+
+	prevLogger := logger
+	defer func() { logger = prevLogger }()
+	_ = Init(model.SystemInfo{ServiceName: "test-service", Version: "1.0.0", Env: "test"})
+
+	h, err := NewOTLPHandler(OTLPHandlerConfig{
+		Endpoint:      receiver.URL + "/v1/logs",
+		Headers:       map[string]string{"Authorization": "Bearer token"},
+		FlushInterval: time.Hour,
+	}, LevelInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929e0e4736aa")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	h.handle(WithContextParams(ctx).WithParams("key", "value").ChangeLog(LevelInfo, "message"))
+	h.handle(emptyLog().ChangeLog(LevelWarning, errors.Default.New("error text").WithParams("id", 1)))
+	h.handle(emptyLog().ChangeLog(LevelDebug, "skipped"))
+
+	if err = h.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requests) != 1 {
+		t.Fatalf("Ожидался 1 запрос в приемник, получено %d", len(requests))
+	}
+	if got := headers[0].Get("Authorization"); got != "Bearer token" {
+		t.Errorf("Authorization = %q", got)
+	}
+
+	resourceLogs := requests[0].ResourceLogs[0]
+
+	resource := make(map[string]string)
+	for _, attr := range resourceLogs.Resource.Attributes {
+		resource[attr.Key] = *attr.Value.StringValue
+	}
+	if resource["service.name"] != "test-service" || resource["service.version"] != "1.0.0" || resource["deployment.environment"] != "test" {
+		t.Errorf("Неверные атрибуты ресурса: %v", resource)
+	}
+
+	records := resourceLogs.ScopeLogs[0].LogRecords
+	if len(records) != 2 {
+		t.Fatalf("Ожидалось 2 записи, получено %d", len(records))
+	}
+
+	first := records[0]
+	if first.TraceID != "4bf92f3577b34da6a3ce929e0e4736aa" || first.SpanID != "00f067aa0ba902b7" {
+		t.Errorf("Неверные идентификаторы трейса: %s %s", first.TraceID, first.SpanID)
+	}
+	if first.SeverityNumber != otlpSeverityInfo || *first.Body.StringValue != "message" {
+		t.Errorf("Неверная запись: %+v", first)
+	}
+	if len(first.Attributes) != 1 || first.Attributes[0].Key != "key" || *first.Attributes[0].Value.StringValue != "value" {
+		t.Errorf("Неверные атрибуты записи: %+v", first.Attributes)
+	}
+
+	second := records[1]
+	if second.SeverityNumber != otlpSeverityWarn || *second.Body.StringValue != "error text" || second.TraceID != "" {
+		t.Errorf("Неверная запись: %+v", second)
+	}
+}
+
+func TestOTLPHandlerFlushRequeue(t *testing.T) {
+
+	var (
+		mu       sync.Mutex
+		requests int
+		received int
+	)
+
+	// Приемник отвечает ошибкой на первый запрос
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req otlpExportRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		received += len(req.ResourceLogs[0].ScopeLogs[0].LogRecords)
+	}))
+	defer receiver.Close()
+
+	h, err := NewOTLPHandler(OTLPHandlerConfig{
+		Endpoint:      receiver.URL + "/v1/logs",
+		BatchSize:     2,
+		MaxQueueSize:  3,
+		FlushInterval: time.Hour,
+	}, LevelInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close(context.Background())
+
+	h.mu.Lock()
+	for range 3 {
+		h.records = append(h.records, newOTLPLogRecord(emptyLog().ChangeLog(LevelInfo, "message")))
+	}
+	h.mu.Unlock()
+
+	// Первая пачка не отправилась, вторая отправилась несмотря на ошибку первой
+	if err = h.Flush(context.Background()); err == nil {
+		t.Fatal("Ожидалась ошибка отправки")
+	}
+	if requests != 2 || received != 1 {
+		t.Fatalf("requests = %d, received = %d, ожидалось 2 и 1", requests, received)
+	}
+
+	// Неотправленные записи вернулись в очередь и ушли при следующем сбросе
+	if err = h.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if received != 3 {
+		t.Errorf("received = %d, ожидалось 3", received)
+	}
+}
+
+func TestOTLPHandlerFlushRejected(t *testing.T) {
+
+	var (
+		mu       sync.Mutex
+		requests int
+		received int
+	)
+
+	// Приемник отклоняет первый запрос, такую пачку повторять бессмысленно
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req otlpExportRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received += len(req.ResourceLogs[0].ScopeLogs[0].LogRecords)
+	}))
+	defer receiver.Close()
+
+	h, err := NewOTLPHandler(OTLPHandlerConfig{
+		Endpoint:      receiver.URL + "/v1/logs",
+		BatchSize:     2,
+		MaxQueueSize:  4,
+		FlushInterval: time.Hour,
+	}, LevelInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close(context.Background())
+
+	h.mu.Lock()
+	for range 3 {
+		h.records = append(h.records, newOTLPLogRecord(emptyLog().ChangeLog(LevelInfo, "message")))
+	}
+	h.mu.Unlock()
+
+	if err = h.Flush(context.Background()); err == nil {
+		t.Fatal("Ожидалась ошибка отправки")
+	}
+	if requests != 2 || received != 1 {
+		t.Fatalf("requests = %d, received = %d, ожидалось 2 и 1", requests, received)
+	}
+
+	// Отклоненные записи не вернулись в очередь
+	h.mu.Lock()
+	queued := len(h.records)
+	h.mu.Unlock()
+	if queued != 0 {
+		t.Fatalf("В очереди осталось %d записей, ожидалось 0", queued)
+	}
+
+	if err = h.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 {
+		t.Errorf("requests = %d, ожидалось 2", requests)
+	}
+}
+
+func TestNewOTLPAnyValue(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{name: "1. Число", value: 1.5, want: `{"doubleValue":1.5}`},
+		{name: "2. NaN", value: math.NaN(), want: `{"stringValue":"NaN"}`},
+		{name: "3. Положительная бесконечность", value: math.Inf(1), want: `{"stringValue":"+Inf"}`},
+		{name: "4. Отрицательная бесконечность float32", value: float32(math.Inf(-1)), want: `{"stringValue":"-Inf"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(newOTLPAnyValue(tt.value))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("newOTLPAnyValue() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
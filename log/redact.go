@@ -0,0 +1,60 @@
+package log
+
+import (
+	"pkg/errors"
+	"pkg/redact"
+)
+
+// redactLog скрывает чувствительные данные в параметрах лога и параметрах ошибки глобальным редактором,
+// чтобы обработчики получали уже очищенную запись
+func redactLog(log Log) Log {
+
+	r := redact.Default()
+	if r == nil {
+		return log
+	}
+
+	return redactLogWith(r, log)
+}
+
+func redactLogWith(r *redact.Redactor, log Log) Log {
+
+	log.params = r.Params(log.params)
+
+	switch v := log.content.(type) {
+	case error:
+		var customErr errors.Error
+		if errors.As(v, &customErr) {
+			customErr.Params = r.Params(customErr.Params)
+			if _, ok := v.(errors.Error); ok {
+				log.content = customErr
+			} else {
+				log.content = redactedError{error: v, redacted: customErr}
+			}
+		}
+	case string:
+		log.content = r.String(v)
+	}
+
+	return log
+}
+
+// redactedError подменяет нашу ошибку внутри цепочки оберток на копию со скрытыми параметрами.
+// Внешние обертки и их сообщения сохраняются, а исходная ошибка не меняется
+type redactedError struct {
+	error
+	redacted errors.Error
+}
+
+func (e redactedError) Unwrap() error {
+	return e.error
+}
+
+// As отдает копию со скрытыми параметрами вместо исходной ошибки из цепочки
+func (e redactedError) As(target any) bool {
+	if customErr, ok := target.(*errors.Error); ok {
+		*customErr = e.redacted
+		return true
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package log
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pkg/errors"
+	"pkg/redact"
+)
+
+func TestRedactLog(t *testing.T) {
+
+	r := redact.New(redact.Config{Keys: []string{"password"}, Detectors: nil, Mode: redact.ModeMask, HashSalt: ""})
+
+	t.Run("1. Ошибка в обертке сохраняет сообщение обертки", func(t *testing.T) {
+		inner := errors.Default.New("inner").WithParams("password", "secret", "id", 1)
+		err := fmt.Errorf("outer: %w", inner)
+
+		log := redactLogWith(r, emptyLog().ChangeLog(LevelError, err))
+
+		content, ok := log.content.(error)
+		require.True(t, ok)
+		assert.Equal(t, "outer: inner", content.Error())
+
+		customErr := errors.CastError(content)
+		assert.Equal(t, map[string]any{"password": "[REDACTED]", "id": "1"}, customErr.Params)
+
+		// Исходная ошибка не меняется
+		assert.Equal(t, "secret", inner.Params["password"])
+	})
+
+	t.Run("2. Наша ошибка без обертки", func(t *testing.T) {
+		err := errors.Default.New("error").WithParams("password", "secret")
+
+		log := redactLogWith(r, emptyLog().WithParams("password", "secret").ChangeLog(LevelError, err))
+
+		assert.Equal(t, map[string]any{"password": "[REDACTED]"}, errors.CastError(log.content.(error)).Params)
+		assert.Equal(t, map[string]any{"password": "[REDACTED]"}, log.params)
+	})
+}
@@ -0,0 +1,128 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"pkg/errors"
+	"pkg/maps"
+)
+
+// LevelSlogFatal - уровень slog, в который отображается LevelFatal, так как в slog нет своего уровня для фатальных ошибок
+const LevelSlogFatal = slog.LevelError + 4
+
+var _ Handler = new(SlogForwardHandler)
+
+func (h *SlogForwardHandler) SetLogLevel(level LogLevel) {
+	h.logLevel.Store(level)
+}
+
+func (h *SlogForwardHandler) GetLogLevel() LogLevel {
+	logLevel, ok := h.logLevel.Load().(LogLevel)
+	if !ok {
+		return ""
+	}
+	return logLevel
+}
+
+// SlogForwardHandler - это версия обработчика журналов, которая перенаправляет логи в любой slog.Handler.
+type SlogForwardHandler struct {
+	logLevel atomic.Value
+	h        slog.Handler
+}
+
+// NewSlogForwardHandler возвращает новый экземпляр SlogForwardHandler.
+func NewSlogForwardHandler(h slog.Handler, level LogLevel) *SlogForwardHandler {
+	handler := &SlogForwardHandler{
+		h:        h,
+		logLevel: atomic.Value{},
+	}
+	handler.logLevel.Store(level)
+	return handler
+}
+
+// handle реализует интерфейс Handler.
+func (h *SlogForwardHandler) handle(log Log) {
+
+	if h.GetLogLevel().GreaterThan(log.level) {
+		return
+	}
+
+	ctx := context.Background()
+	level := logLevelToSlogLevel(log.level)
+
+	if !h.h.Enabled(ctx, level) {
+		return
+	}
+
+	var (
+		message    string
+		params     map[string]any
+		stackTrace []string
+	)
+
+	switch v := log.content.(type) {
+	case error:
+		customErr := errors.CastError(v)
+
+		if customErr.Err != nil {
+			message = customErr.Error()
+		} else {
+			message = "unknown error"
+		}
+
+		params = maps.Join(log.params, customErr.Params)
+		stackTrace = customErr.StackTrace
+	default:
+		message = fmt.Sprintf("%v", v)
+		params = log.params
+		stackTrace = log.stackTrace
+	}
+
+	record := slog.NewRecord(time.Now(), level, message, 0)
+
+	// Сортируем ключи, чтобы порядок атрибутов не менялся от записи к записи
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		record.AddAttrs(slog.Any(key, params[key]))
+	}
+
+	if len(stackTrace) != 0 {
+		record.AddAttrs(slog.Any("stackTrace", stackTrace))
+	}
+
+	if log.traceID != "" {
+		record.AddAttrs(slog.String("trace_id", log.traceID), slog.String("span_id", log.spanID))
+	}
+
+	if err := h.h.Handle(ctx, record); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "logging: could not forward log to slog: %s\n", err)
+	}
+}
+
+func logLevelToSlogLevel(level LogLevel) slog.Level {
+	switch level {
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelInfo:
+		return slog.LevelInfo
+	case LevelWarning:
+		return slog.LevelWarn
+	case LevelError:
+		return slog.LevelError
+	case LevelFatal:
+		return LevelSlogFatal
+	default:
+		return slog.LevelInfo
+	}
+}
@@ -0,0 +1,193 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"runtime"
+
+	"pkg/contextMap"
+	"pkg/errors"
+)
+
+var _ slog.Handler = new(SlogHandler)
+
+// SlogHandler - это реализация slog.Handler, которая передает записи в обработчики pkg/log.
+// Благодаря этому библиотеки на log/slog пишут логи в нашем формате и с нашим SystemInfo
+type SlogHandler struct {
+
+	// Обработчики, в которые передаются записи. Если не заданы, используются обработчики глобального логгера
+	handlers []Handler
+
+	// Параметры, накопленные через WithAttrs
+	params map[string]any
+
+	// Префикс ключей, накопленный через WithGroup
+	groupPrefix string
+}
+
+// NewSlogHandler возвращает новый экземпляр SlogHandler.
+//
+// Если обработчики не переданы, записи уходят в обработчики, заданные через Init,
+// поэтому хэндлер можно создать до инициализации логгера
+func NewSlogHandler(handlers ...Handler) *SlogHandler {
+	return &SlogHandler{
+		handlers:    handlers,
+		params:      make(map[string]any),
+		groupPrefix: "",
+	}
+}
+
+// NewSlogLogger возвращает slog.Logger поверх SlogHandler
+func NewSlogLogger(handlers ...Handler) *slog.Logger {
+	return slog.New(NewSlogHandler(handlers...))
+}
+
+// Enabled реализует интерфейс slog.Handler.
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	logLevel := slogLevelToLogLevel(level)
+	for _, handler := range h.getHandlers() {
+		if !handler.GetLogLevel().GreaterThan(logLevel) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle реализует интерфейс slog.Handler.
+func (h *SlogHandler) Handle(ctx context.Context, record slog.Record) error {
+
+	// Приоритет параметров по возрастанию: контекст, атрибуты из WithAttrs, атрибуты записи
+	params := contextMap.GetMap(ctx)
+	maps.Copy(params, h.params)
+
+	record.Attrs(func(attr slog.Attr) bool {
+		addSlogAttr(params, h.groupPrefix, attr)
+		return true
+	})
+
+	traceID, spanID := traceFromContext(ctx)
+
+	log := redactLog(Log{
+		level:      slogLevelToLogLevel(record.Level),
+		content:    record.Message,
+		params:     params,
+		stackTrace: slogSource(record.PC),
+		traceID:    traceID,
+		spanID:     spanID,
+	})
+
+	for _, handler := range h.getHandlers() {
+		handler.handle(log)
+	}
+
+	return nil
+}
+
+// WithAttrs реализует интерфейс slog.Handler.
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+
+	params := maps.Clone(h.params)
+	for _, attr := range attrs {
+		addSlogAttr(params, h.groupPrefix, attr)
+	}
+
+	return &SlogHandler{
+		handlers:    h.handlers,
+		params:      params,
+		groupPrefix: h.groupPrefix,
+	}
+}
+
+// WithGroup реализует интерфейс slog.Handler.
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	return &SlogHandler{
+		handlers:    h.handlers,
+		params:      maps.Clone(h.params),
+		groupPrefix: h.groupPrefix + name + ".",
+	}
+}
+
+func (h *SlogHandler) getHandlers() []Handler {
+	if len(h.handlers) != 0 {
+		return h.handlers
+	}
+	return logger.handlers
+}
+
+// addSlogAttr раскладывает атрибут slog в плоскую мапу параметров, группы превращаются в префиксы ключей
+func addSlogAttr(params map[string]any, prefix string, attr slog.Attr) {
+
+	attr.Value = attr.Value.Resolve()
+
+	// Пустые атрибуты по контракту slog игнорируются
+	if attr.Equal(slog.Attr{Key: "", Value: slog.Value{}}) {
+		return
+	}
+
+	if attr.Value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		for _, groupAttr := range attr.Value.Group() {
+			addSlogAttr(params, prefix, groupAttr)
+		}
+		return
+	}
+
+	// Для наших ошибок дополнительно забираем их параметры
+	if err, ok := attr.Value.Any().(error); ok && attr.Value.Kind() == slog.KindAny {
+		var customErr errors.Error
+		if errors.As(err, &customErr) {
+			for key, value := range customErr.Params {
+				params[prefix+key] = value
+			}
+		}
+		params[prefix+attr.Key] = err.Error()
+		return
+	}
+
+	// Скалярные значения сохраняют тип, чтобы обработчики писали числа числами, а не строками.
+	// Произвольные значения приводятся к строке, так как обработчики не обязаны уметь их сериализовать
+	switch attr.Value.Kind() {
+	case slog.KindAny, slog.KindLogValuer:
+		params[prefix+attr.Key] = attr.Value.String()
+	default:
+		params[prefix+attr.Key] = attr.Value.Any()
+	}
+}
+
+// slogSource возвращает путь до места вызова в формате стектрейса пакета stackTrace
+func slogSource(pc uintptr) []string {
+	if pc == 0 {
+		return nil
+	}
+
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	if frame.File == "" {
+		return nil
+	}
+
+	return []string{fmt.Sprintf("%s:%d", frame.File, frame.Line)}
+}
+
+func slogLevelToLogLevel(level slog.Level) LogLevel {
+	switch {
+	case level < slog.LevelInfo:
+		return LevelDebug
+	case level < slog.LevelWarn:
+		return LevelInfo
+	case level < slog.LevelError:
+		return LevelWarning
+	default:
+		return LevelError
+	}
+}
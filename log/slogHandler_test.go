@@ -0,0 +1,196 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+
+	"pkg/contextMap"
+	"pkg/errors"
+)
+
+func TestSlogHandler(t *testing.T) {
+
+	type want struct {
+		written bool
+		level   string
+		message string
+		params  map[string]any
+	}
+
+	tests := []struct {
+		name  string
+		level LogLevel
+		log   func(logger *slog.Logger)
+		want  want
+	}{
+		{
+			name:  "1. Запись с атрибутами",
+			level: LevelDebug,
+			log: func(logger *slog.Logger) {
+				logger.Info("message", "key", "value", "number", 1)
+			},
+			want: want{
+				written: true,
+				level:   "info",
+				message: "message",
+				params:  map[string]any{"key": "value", "number": 1.0},
+			},
+		},
+		{
+			name:  "2. Группы превращаются в префиксы ключей",
+			level: LevelDebug,
+			log: func(logger *slog.Logger) {
+				logger.WithGroup("request").With("id", "42").Warn("message", slog.Group("user", "name", "bob"))
+			},
+			want: want{
+				written: true,
+				level:   "warn",
+				message: "message",
+				params:  map[string]any{"request.id": "42", "request.user.name": "bob"},
+			},
+		},
+		{
+			name:  "3. Параметры кастомной ошибки попадают в параметры лога",
+			level: LevelDebug,
+			log: func(logger *slog.Logger) {
+				logger.Error("message", "error", errors.Default.New("error text").WithParams("id", 1))
+			},
+			want: want{
+				written: true,
+				level:   "error",
+				message: "message",
+				params:  map[string]any{"error": "error text", "id": "1"},
+			},
+		},
+		{
+			name:  "4. Атрибуты записи важнее атрибутов из With, а те важнее параметров контекста",
+			level: LevelDebug,
+			log: func(logger *slog.Logger) {
+				ctx := contextMap.AddValue(context.Background(), "a", "ctx", "b", "ctx", "c", "ctx")
+				logger.With("b", "attrs", "c", "attrs").InfoContext(ctx, "message", "c", "record")
+			},
+			want: want{
+				written: true,
+				level:   "info",
+				message: "message",
+				params:  map[string]any{"a": "ctx", "b": "attrs", "c": "record"},
+			},
+		},
+		{
+			name:  "5. Запись ниже уровня обработчика отбрасывается",
+			level: LevelError,
+			log: func(logger *slog.Logger) {
+				logger.Info("message")
+			},
+			want: want{
+				written: false,
+				level:   "",
+				message: "",
+				params:  nil,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.log(NewSlogLogger(NewJSONHandler(&buf, tt.level)))
+
+			if !tt.want.written {
+				if buf.Len() != 0 {
+					t.Fatalf("Лог не должен был записаться: %s", buf.String())
+				}
+				return
+			}
+
+			var got jsonLog
+			if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+
+			if got.Level != tt.want.level {
+				t.Errorf("level = %v, want %v", got.Level, tt.want.level)
+			}
+			if got.Message != tt.want.message {
+				t.Errorf("message = %v, want %v", got.Message, tt.want.message)
+			}
+			for key, value := range tt.want.params {
+				if got.Params[key] != value {
+					t.Errorf("params[%s] = %v, want %v", key, got.Params[key], value)
+				}
+			}
+		})
+	}
+}
+
+func TestSlogForwardHandler(t *testing.T) {
+
+	var buf bytes.Buffer
+	handler := NewSlogForwardHandler(slog.NewJSONHandler(&buf, nil), LevelDebug)
+
+	handler.handle(emptyLog().
+		WithParams("key", "value").
+		ChangeLog(LevelWarning, errors.Default.New("error text").WithParams("id", 1)),
+	)
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]any{
+		"level": "WARN",
+		"msg":   "error text",
+		"key":   "value",
+		"id":    "1",
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %v, want %v", key, got[key], value)
+		}
+	}
+}
+
+func TestAddSlogAttr(t *testing.T) {
+
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	params := make(map[string]any)
+	for _, attr := range []slog.Attr{
+		slog.String("string", "value"),
+		slog.Int("int", 1),
+		slog.Uint64("uint", 2),
+		slog.Float64("float", 1.5),
+		slog.Bool("bool", true),
+		slog.Duration("duration", time.Second),
+		slog.Time("time", createdAt),
+		slog.Any("any", []int{1, 2}),
+		slog.Any("valuer", slogValuer{}),
+	} {
+		addSlogAttr(params, "", attr)
+	}
+
+	want := map[string]any{
+		"string":   "value",
+		"int":      int64(1),
+		"uint":     uint64(2),
+		"float":    1.5,
+		"bool":     true,
+		"duration": time.Second,
+		"time":     createdAt,
+		"any":      "[1 2]",
+		"valuer":   int64(42),
+	}
+	if !reflect.DeepEqual(params, want) {
+		t.Errorf("params = %#v, want %#v", params, want)
+	}
+}
+
+// slogValuer - значение, которое slog разворачивает через LogValue
+type slogValuer struct{}
+
+func (slogValuer) LogValue() slog.Value { return slog.Int64Value(42) }
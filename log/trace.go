@@ -0,0 +1,22 @@
+package log
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceFromContext возвращает идентификаторы трейса и спана OpenTelemetry из контекста.
+// Если в контексте нет валидного спана, возвращает пустые строки
+func traceFromContext(ctx context.Context) (traceID, spanID string) {
+	if ctx == nil {
+		return "", ""
+	}
+
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return "", ""
+	}
+
+	return spanContext.TraceID().String(), spanContext.SpanID().String()
+}
@@ -5,6 +5,7 @@ import (
 
 	"pkg/errors"
 	"pkg/log"
+	"pkg/redact"
 )
 
 var DefaultErrorHandler = func(ctx *fiber.Ctx, err error) error {
@@ -34,6 +35,9 @@ var DefaultErrorHandler = func(ctx *fiber.Ctx, err error) error {
 
 	customErr.SystemInfo = log.GetSystemInfo()
 
+	// Скрываем чувствительные данные, так как параметры ошибки уходят клиенту
+	customErr.Params = redact.Params(customErr.Params)
+
 	// Логгируем ошибку
 	log.LogError(customErr)
 
@@ -0,0 +1,180 @@
+package migrator
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"pkg/errors"
+)
+
+// ClickhouseConfig - настройки миграций ClickHouse
+type ClickhouseConfig struct {
+
+	// Имя кластера для ON CLUSTER. Если пустое, миграции применяются к одному узлу
+	Cluster string
+
+	// База данных, подставляется в шаблоны миграций как {{ .Database }}
+	Database string
+
+	// Таблица версий, по умолчанию goose_db_version
+	VersionTable string
+
+	// Путь таблицы версий в ZooKeeper, по умолчанию /clickhouse/tables/{database}/{table}.
+	// Путь не зависит от шарда, чтобы все реплики кластера видели одну таблицу версий
+	ZooKeeperPath string
+}
+
+// template возвращает данные для шаблонов миграций
+func (c ClickhouseConfig) template() ClickhouseTemplate {
+	return ClickhouseTemplate{
+		Cluster:  c.Cluster,
+		Database: c.Database,
+	}
+}
+
+// ClickhouseTemplate - данные, доступные в шаблонах миграций ClickHouse.
+// Пример миграции: CREATE TABLE events {{ .OnCluster }} (...) ENGINE = {{ .Replicated "MergeTree" }} ORDER BY id
+type ClickhouseTemplate struct {
+	Cluster  string
+	Database string
+}
+
+// OnCluster возвращает "ON CLUSTER <имя>" или пустую строку для одиночного узла
+func (t ClickhouseTemplate) OnCluster() string {
+	if t.Cluster == "" {
+		return ""
+	}
+	return "ON CLUSTER " + quoteClickhouseIdentifier(t.Cluster)
+}
+
+// Replicated возвращает Replicated движок с путями по умолчанию для кластера или исходный движок для одиночного узла.
+// Параметры движка передаются как есть: {{ .Replicated "ReplacingMergeTree" "updated_at" }}
+func (t ClickhouseTemplate) Replicated(engine string, params ...string) string {
+	if t.Cluster == "" {
+		return engine + "(" + strings.Join(params, ", ") + ")"
+	}
+	return "Replicated" + engine + "(" + strings.Join(params, ", ") + ")"
+}
+
+// templateFS отдает SQL миграции с подставленными параметрами кластера и переписанным идемпотентным DDL
+type templateFS struct {
+	fsys fs.FS
+	data ClickhouseTemplate
+}
+
+func newTemplateFS(fsys fs.FS, data ClickhouseTemplate) templateFS {
+	return templateFS{
+		fsys: fsys,
+		data: data,
+	}
+}
+
+// Open реализует интерфейс fs.FS.
+func (t templateFS) Open(name string) (fs.File, error) {
+
+	file, err := t.fsys.Open(name)
+	if err != nil || path.Ext(name) != ".sql" {
+		return file, err
+	}
+	defer func() { _ = file.Close() }()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered, err := renderClickhouseMigration(name, string(content), t.data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &memFile{
+		Reader: bytes.NewReader([]byte(rendered)),
+		info:   memFileInfo{FileInfo: info, size: int64(len(rendered))},
+	}, nil
+}
+
+// renderClickhouseMigration подставляет параметры в шаблон миграции и делает DDL идемпотентным
+func renderClickhouseMigration(name, content string, data ClickhouseTemplate) (string, error) {
+
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(content)
+	if err != nil {
+		return "", errors.Default.Wrap(err).WithParams("path", name)
+	}
+
+	var rendered strings.Builder
+	if err = tmpl.Execute(&rendered, data); err != nil {
+		return "", errors.Default.Wrap(err).WithParams("path", name)
+	}
+
+	return idempotentDDL(rendered.String()), nil
+}
+
+// Выражения DDL, которые дополняются IF [NOT] EXISTS
+var idempotentClauses = []struct {
+	re     *regexp.Regexp
+	clause string
+}{
+	{regexp.MustCompile(`(?i)\bCREATE\s+(?:TABLE|DATABASE|MATERIALIZED\s+VIEW|VIEW|DICTIONARY)\s+(IF\s+NOT\s+EXISTS\s+)?`), "IF NOT EXISTS "},
+	{regexp.MustCompile(`(?i)\bDROP\s+(?:TABLE|DATABASE|VIEW|DICTIONARY)\s+(IF\s+EXISTS\s+)?`), "IF EXISTS "},
+	{regexp.MustCompile(`(?i)\bADD\s+(?:COLUMN|INDEX|PROJECTION|CONSTRAINT)\s+(IF\s+NOT\s+EXISTS\s+)?`), "IF NOT EXISTS "},
+	{regexp.MustCompile(`(?i)\b(?:DROP|MODIFY|RENAME|CLEAR|COMMENT)\s+COLUMN\s+(IF\s+EXISTS\s+)?`), "IF EXISTS "},
+	{regexp.MustCompile(`(?i)\bDROP\s+(?:INDEX|PROJECTION|CONSTRAINT)\s+(IF\s+EXISTS\s+)?`), "IF EXISTS "},
+}
+
+// idempotentDDL добавляет IF [NOT] EXISTS в DDL, где его нет. В ClickHouse DDL не транзакционный,
+// поэтому миграция, упавшая на середине, должна безопасно применяться повторно
+func idempotentDDL(query string) string {
+
+	for _, c := range idempotentClauses {
+		matches := c.re.FindAllStringSubmatchIndex(query, -1)
+		if len(matches) == 0 {
+			continue
+		}
+
+		var res strings.Builder
+		last := 0
+		for _, match := range matches {
+			res.WriteString(query[last:match[1]])
+			// Группа IF [NOT] EXISTS не нашлась
+			if match[2] < 0 {
+				res.WriteString(c.clause)
+			}
+			last = match[1]
+		}
+		res.WriteString(query[last:])
+		query = res.String()
+	}
+
+	return query
+}
+
+func quoteClickhouseIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "\\`") + "`"
+}
+
+// memFile - отрендеренный файл миграции в памяти
+type memFile struct {
+	*bytes.Reader
+	info fs.FileInfo
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *memFile) Close() error               { return nil }
+
+type memFileInfo struct {
+	fs.FileInfo
+	size int64
+}
+
+func (i memFileInfo) Size() int64 { return i.size }
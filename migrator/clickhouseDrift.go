@@ -0,0 +1,147 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+
+	"pkg/errors"
+)
+
+// ReplicaDrift - расхождение схемы таблицы на реплике кластера ClickHouse с остальными репликами
+type ReplicaDrift struct {
+	Host   string
+	Table  string
+	Column string // Пустой, если на реплике нет всей таблицы
+
+	// Тип колонки на реплике и тип, который стоит на большинстве реплик. Пустой тип - колонки нет
+	Type     string
+	Expected string
+}
+
+// replicaColumn - колонка таблицы на одной реплике
+type replicaColumn struct {
+	Host   string
+	Table  string
+	Column string
+	Type   string
+}
+
+// CheckReplicaDrift сравнивает колонки таблиц базы database на всех репликах кластера и возвращает расхождения.
+// Пустая database означает текущую базу подключения
+func CheckReplicaDrift(ctx context.Context, db *sql.DB, cluster, database string) ([]ReplicaDrift, error) {
+
+	if cluster == "" {
+		return nil, errors.Default.New("cluster is required")
+	}
+
+	query := `SELECT hostName(), table, name, type
+		FROM clusterAllReplicas(?, system.columns)
+		WHERE database = if(? = '', currentDatabase(), ?)`
+
+	rows, err := db.QueryContext(ctx, query, cluster, database, database)
+	if err != nil {
+		return nil, errors.Default.Wrap(err).WithParams("cluster", cluster)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var columns []replicaColumn
+	for rows.Next() {
+		var column replicaColumn
+		if err = rows.Scan(&column.Host, &column.Table, &column.Column, &column.Type); err != nil {
+			return nil, errors.Default.Wrap(err)
+		}
+		columns = append(columns, column)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Default.Wrap(err)
+	}
+
+	return replicaDrift(columns), nil
+}
+
+// replicaDrift находит расхождения колонок между репликами. Ожидаемым считается тип, который стоит на большинстве реплик
+func replicaDrift(columns []replicaColumn) []ReplicaDrift {
+
+	type key struct{ table, column string }
+
+	var (
+		hosts      = make(map[string]struct{})
+		tables     = make(map[string]map[string]struct{}) // таблица -> реплики, где она есть
+		types      = make(map[key]map[string]string)      // колонка -> реплика -> тип
+		columnKeys []key
+	)
+
+	for _, c := range columns {
+		hosts[c.Host] = struct{}{}
+
+		if tables[c.Table] == nil {
+			tables[c.Table] = make(map[string]struct{})
+		}
+		tables[c.Table][c.Host] = struct{}{}
+
+		k := key{c.Table, c.Column}
+		if types[k] == nil {
+			types[k] = make(map[string]string)
+			columnKeys = append(columnKeys, k)
+		}
+		types[k][c.Host] = c.Type
+	}
+
+	var drift []ReplicaDrift
+
+	// Таблицы, которых нет на части реплик
+	for table, tableHosts := range tables {
+		for host := range hosts {
+			if _, ok := tableHosts[host]; !ok {
+				drift = append(drift, ReplicaDrift{Host: host, Table: table, Column: "", Type: "", Expected: ""})
+			}
+		}
+	}
+
+	// Колонки, которых нет или у которых другой тип
+	for _, k := range columnKeys {
+		byHost := types[k]
+		expected := majorityType(byHost)
+
+		for host := range tables[k.table] {
+			if typ := byHost[host]; typ != expected {
+				drift = append(drift, ReplicaDrift{Host: host, Table: k.table, Column: k.column, Type: typ, Expected: expected})
+			}
+		}
+	}
+
+	slices.SortFunc(drift, func(a, b ReplicaDrift) int {
+		if c := strings.Compare(a.Table, b.Table); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.Column, b.Column); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Host, b.Host)
+	})
+
+	return drift
+}
+
+// majorityType возвращает самый частый тип, при равенстве - меньший по алфавиту, чтобы результат был стабильным
+func majorityType(byHost map[string]string) string {
+
+	counts := make(map[string]int)
+	for _, typ := range byHost {
+		counts[typ]++
+	}
+
+	var (
+		res  string
+		best int
+	)
+	for typ, count := range counts {
+		if count > best || (count == best && typ < res) {
+			res, best = typ, count
+		}
+	}
+
+	return res
+}
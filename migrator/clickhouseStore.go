@@ -0,0 +1,170 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pressly/goose/v3/database"
+
+	"pkg/errors"
+)
+
+// Значения по умолчанию для таблицы версий ClickHouse
+const (
+	defaultClickhouseVersionTable  = "goose_db_version"
+	defaultClickhouseZooKeeperPath = "/clickhouse/tables/{database}/{table}"
+)
+
+var _ database.Store = clickhouseStore{}
+
+// clickhouseStore - таблица версий goose для ClickHouse. На кластере таблица создается ON CLUSTER с Replicated движком.
+// Движок ReplacingMergeTree по version_id делает повторную запись версии безопасной,
+// а откат записывает строку с is_applied = 0 вместо мутации DELETE
+type clickhouseStore struct {
+	table         string
+	cluster       string
+	zooKeeperPath string
+}
+
+func newClickhouseStore(config ClickhouseConfig) clickhouseStore {
+	store := clickhouseStore{
+		table:         config.VersionTable,
+		cluster:       config.Cluster,
+		zooKeeperPath: config.ZooKeeperPath,
+	}
+	if store.table == "" {
+		store.table = defaultClickhouseVersionTable
+	}
+	if store.zooKeeperPath == "" {
+		store.zooKeeperPath = defaultClickhouseZooKeeperPath
+	}
+	return store
+}
+
+// Tablename реализует интерфейс database.Store.
+func (s clickhouseStore) Tablename() string {
+	return s.table
+}
+
+// TableExists проверяет наличие таблицы версий, goose вызывает его перед созданием таблицы
+func (s clickhouseStore) TableExists(ctx context.Context, db database.DBTxConn, table string) (bool, error) {
+
+	var exists uint8
+	if err := db.QueryRowContext(ctx, "EXISTS TABLE "+table).Scan(&exists); err != nil {
+		return false, errors.Default.Wrap(err).WithParams("table", table)
+	}
+
+	return exists == 1, nil
+}
+
+// CreateVersionTable реализует интерфейс database.Store.
+func (s clickhouseStore) CreateVersionTable(ctx context.Context, db database.DBTxConn) error {
+
+	engine := "ReplacingMergeTree(tstamp)"
+	onCluster := ""
+	if s.cluster != "" {
+		engine = fmt.Sprintf("ReplicatedReplacingMergeTree('%s', '{replica}', tstamp)", strings.ReplaceAll(s.zooKeeperPath, "'", "\\'"))
+		onCluster = "ON CLUSTER " + quoteClickhouseIdentifier(s.cluster)
+	}
+
+	query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s %s (
+		version_id Int64,
+		is_applied UInt8,
+		tstamp DateTime64(3) DEFAULT now64(3)
+	) ENGINE = %s
+	ORDER BY version_id`, s.table, onCluster, engine)
+
+	if _, err := db.ExecContext(ctx, query); err != nil {
+		return errors.Default.Wrap(err).WithParams("table", s.table)
+	}
+
+	return nil
+}
+
+// Insert реализует интерфейс database.Store.
+func (s clickhouseStore) Insert(ctx context.Context, db database.DBTxConn, req database.InsertRequest) error {
+	return s.insert(ctx, db, req.Version, true)
+}
+
+// Delete реализует интерфейс database.Store.
+func (s clickhouseStore) Delete(ctx context.Context, db database.DBTxConn, version int64) error {
+	return s.insert(ctx, db, version, false)
+}
+
+func (s clickhouseStore) insert(ctx context.Context, db database.DBTxConn, version int64, applied bool) error {
+
+	var isApplied uint8
+	if applied {
+		isApplied = 1
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (version_id, is_applied) VALUES (?, ?)", s.table)
+	if _, err := db.ExecContext(ctx, query, version, isApplied); err != nil {
+		return errors.Default.Wrap(err).WithParams("table", s.table, "version", version)
+	}
+
+	return nil
+}
+
+// GetMigration реализует интерфейс database.Store.
+func (s clickhouseStore) GetMigration(ctx context.Context, db database.DBTxConn, version int64) (*database.GetMigrationResult, error) {
+
+	query := fmt.Sprintf("SELECT tstamp FROM %s FINAL WHERE version_id = ? AND is_applied = 1", s.table)
+
+	res := database.GetMigrationResult{Timestamp: time.Time{}, IsApplied: true}
+	err := db.QueryRowContext(ctx, query, version).Scan(&res.Timestamp)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, database.ErrVersionNotFound
+	}
+	if err != nil {
+		return nil, errors.Default.Wrap(err).WithParams("table", s.table, "version", version)
+	}
+
+	return &res, nil
+}
+
+// GetLatestVersion возвращает последнюю примененную версию. При применении не по порядку это не самая старшая версия
+func (s clickhouseStore) GetLatestVersion(ctx context.Context, db database.DBTxConn) (int64, error) {
+
+	query := fmt.Sprintf("SELECT version_id FROM %s FINAL WHERE is_applied = 1 ORDER BY tstamp DESC, version_id DESC LIMIT 1", s.table)
+
+	var version int64
+	err := db.QueryRowContext(ctx, query).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, database.ErrVersionNotFound
+	}
+	if err != nil {
+		return 0, errors.Default.Wrap(err).WithParams("table", s.table)
+	}
+
+	return version, nil
+}
+
+// ListMigrations возвращает примененные версии в порядке применения, начиная с последней, как ожидает goose при откате
+func (s clickhouseStore) ListMigrations(ctx context.Context, db database.DBTxConn) ([]*database.ListMigrationsResult, error) {
+
+	query := fmt.Sprintf("SELECT version_id FROM %s FINAL WHERE is_applied = 1 ORDER BY tstamp DESC, version_id DESC", s.table)
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Default.Wrap(err).WithParams("table", s.table)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var res []*database.ListMigrationsResult
+	for rows.Next() {
+		migration := database.ListMigrationsResult{Version: 0, IsApplied: true}
+		if err = rows.Scan(&migration.Version); err != nil {
+			return nil, errors.Default.Wrap(err)
+		}
+		res = append(res, &migration)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Default.Wrap(err)
+	}
+
+	return res, nil
+}
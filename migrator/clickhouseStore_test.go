@@ -0,0 +1,129 @@
+package migrator
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pressly/goose/v3/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// versionDriver - заглушка таблицы версий ReplacingMergeTree: у версии учитывается только последняя запись,
+// сортировка берется из ORDER BY запроса
+type versionDriver struct {
+	rows []versionRow
+}
+
+type versionRow struct {
+	version int64
+	applied bool
+	tstamp  time.Time
+}
+
+type versionConn struct{ driver *versionDriver }
+
+func (c *versionConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c *versionConn) Close() error                        { return nil }
+func (c *versionConn) Begin() (driver.Tx, error)           { return nil, driver.ErrSkip }
+
+func (c *versionConn) ExecContext(_ context.Context, _ string, args []driver.NamedValue) (driver.Result, error) {
+	c.driver.rows = append(c.driver.rows, versionRow{
+		version: args[0].Value.(int64),
+		applied: args[1].Value.(int64) == 1,
+		tstamp:  time.Unix(0, 0).Add(time.Duration(len(c.driver.rows)) * time.Second),
+	})
+	return driver.ResultNoRows, nil
+}
+
+func (c *versionConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+
+	latest := make(map[int64]versionRow)
+	for _, row := range c.driver.rows {
+		latest[row.version] = row
+	}
+
+	var applied []versionRow
+	for _, row := range latest {
+		if row.applied {
+			applied = append(applied, row)
+		}
+	}
+
+	slices.SortFunc(applied, func(a, b versionRow) int {
+		if strings.Contains(query, "ORDER BY tstamp DESC") {
+			if c := b.tstamp.Compare(a.tstamp); c != 0 {
+				return c
+			}
+		}
+		return cmp.Compare(b.version, a.version)
+	})
+	if strings.Contains(query, "LIMIT 1") && len(applied) > 1 {
+		applied = applied[:1]
+	}
+
+	return &versionRows{rows: applied}, nil
+}
+
+type versionRows struct{ rows []versionRow }
+
+func (r *versionRows) Columns() []string { return []string{"version_id"} }
+func (r *versionRows) Close() error      { return nil }
+
+func (r *versionRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	dest[0] = r.rows[0].version
+	r.rows = r.rows[1:]
+	return nil
+}
+
+type versionConnector struct{ driver *versionDriver }
+
+func (c versionConnector) Connect(context.Context) (driver.Conn, error) { return &versionConn{driver: c.driver}, nil }
+func (c versionConnector) Driver() driver.Driver                        { return nil }
+
+func TestClickhouseStoreOutOfOrder(t *testing.T) {
+
+	ctx := context.Background()
+	db := sql.OpenDB(versionConnector{driver: &versionDriver{rows: nil}})
+	defer db.Close()
+
+	store := newClickhouseStore(ClickhouseConfig{})
+
+	// Версия 2 применена последней, после 3
+	for _, version := range []int64{1, 3, 2} {
+		require.NoError(t, store.Insert(ctx, db, database.InsertRequest{Version: version}))
+	}
+
+	versions := func() []int64 {
+		migrations, err := store.ListMigrations(ctx, db)
+		require.NoError(t, err)
+		var res []int64
+		for _, migration := range migrations {
+			res = append(res, migration.Version)
+		}
+		return res
+	}
+
+	assert.Equal(t, []int64{2, 3, 1}, versions())
+	latest, err := store.GetLatestVersion(ctx, db)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), latest)
+
+	// Откат последней примененной версии
+	require.NoError(t, store.Delete(ctx, db, 2))
+
+	assert.Equal(t, []int64{3, 1}, versions())
+	latest, err = store.GetLatestVersion(ctx, db)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), latest)
+}
@@ -0,0 +1,90 @@
+package migrator
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotentDDL(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "1. Создание таблицы",
+			query: "CREATE TABLE events (id UInt64) ENGINE = MergeTree ORDER BY id",
+			want:  "CREATE TABLE IF NOT EXISTS events (id UInt64) ENGINE = MergeTree ORDER BY id",
+		},
+		{
+			name:  "2. IF NOT EXISTS уже есть",
+			query: "create materialized view if not exists mv TO t AS SELECT 1",
+			want:  "create materialized view if not exists mv TO t AS SELECT 1",
+		},
+		{
+			name:  "3. Изменение колонок",
+			query: "ALTER TABLE events ON CLUSTER `main` ADD COLUMN name String, DROP COLUMN old, MODIFY COLUMN id UInt32",
+			want:  "ALTER TABLE events ON CLUSTER `main` ADD COLUMN IF NOT EXISTS name String, DROP COLUMN IF EXISTS old, MODIFY COLUMN IF EXISTS id UInt32",
+		},
+		{
+			name:  "4. Удаление таблицы и индекса",
+			query: "ALTER TABLE events DROP INDEX idx;\nDROP TABLE events;",
+			want:  "ALTER TABLE events DROP INDEX IF EXISTS idx;\nDROP TABLE IF EXISTS events;",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, idempotentDDL(tt.query))
+		})
+	}
+}
+
+func TestTemplateFS(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"migrations/1_events.sql": {Data: []byte("CREATE TABLE events {{ .OnCluster }} (id UInt64) ENGINE = {{ .Replicated \"MergeTree\" }} ORDER BY id")},
+		"migrations/2_noop.go":    {Data: []byte("package migrations")},
+	}
+
+	t.Run("1. Кластер", func(t *testing.T) {
+		content, err := fs.ReadFile(newTemplateFS(fsys, ClickhouseTemplate{Cluster: "main", Database: ""}), "migrations/1_events.sql")
+		require.NoError(t, err)
+		assert.Equal(t, "CREATE TABLE IF NOT EXISTS events ON CLUSTER `main` (id UInt64) ENGINE = ReplicatedMergeTree() ORDER BY id", string(content))
+	})
+
+	t.Run("2. Одиночный узел", func(t *testing.T) {
+		content, err := fs.ReadFile(newTemplateFS(fsys, ClickhouseTemplate{Cluster: "", Database: ""}), "migrations/1_events.sql")
+		require.NoError(t, err)
+		assert.Equal(t, "CREATE TABLE IF NOT EXISTS events  (id UInt64) ENGINE = MergeTree() ORDER BY id", string(content))
+	})
+
+	t.Run("3. Не SQL файлы не меняются", func(t *testing.T) {
+		content, err := fs.ReadFile(newTemplateFS(fsys, ClickhouseTemplate{Cluster: "main", Database: ""}), "migrations/2_noop.go")
+		require.NoError(t, err)
+		assert.Equal(t, "package migrations", string(content))
+	})
+}
+
+func TestReplicaDrift(t *testing.T) {
+
+	columns := []replicaColumn{
+		{Host: "ch1", Table: "events", Column: "id", Type: "UInt64"},
+		{Host: "ch2", Table: "events", Column: "id", Type: "UInt64"},
+		{Host: "ch3", Table: "events", Column: "id", Type: "UInt32"},
+		{Host: "ch1", Table: "events", Column: "name", Type: "String"},
+		{Host: "ch2", Table: "events", Column: "name", Type: "String"},
+		{Host: "ch1", Table: "users", Column: "id", Type: "UInt64"},
+		{Host: "ch2", Table: "users", Column: "id", Type: "UInt64"},
+	}
+
+	assert.Equal(t, []ReplicaDrift{
+		{Host: "ch3", Table: "events", Column: "id", Type: "UInt32", Expected: "UInt64"},
+		{Host: "ch3", Table: "events", Column: "name", Type: "", Expected: "String"},
+		{Host: "ch3", Table: "users", Column: "", Type: "", Expected: ""},
+	}, replicaDrift(columns))
+}
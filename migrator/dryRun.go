@@ -0,0 +1,145 @@
+package migrator
+
+import (
+	"bufio"
+	"context"
+	"io/fs"
+	"slices"
+	"strings"
+
+	"github.com/pressly/goose/v3"
+
+	"pkg/errors"
+)
+
+// Direction - направление миграции
+type Direction string
+
+const (
+	DirectionUp   Direction = "up"
+	DirectionDown Direction = "down"
+)
+
+// PlannedMigration - миграция, которая будет выполнена, и ее SQL
+type PlannedMigration struct {
+	Version   int64
+	Path      string
+	Direction Direction
+
+	// SQL секции миграции для направления Direction. Для go миграций пустой
+	SQL string
+}
+
+// PlanUp возвращает миграции, которые применит UpTo(ctx, version), без изменения базы.
+// Для всех непримененных миграций передается math.MaxInt64
+func (m Migrator) PlanUp(ctx context.Context, version int64) ([]PlannedMigration, error) {
+
+	statuses, err := m.provider.Status(ctx)
+	if err != nil {
+		return nil, errors.Default.Wrap(err)
+	}
+
+	var plan []PlannedMigration
+	for _, status := range statuses {
+		if status.State != goose.StatePending || status.Source.Version > version {
+			continue
+		}
+
+		planned, err := m.planned(status.Source, DirectionUp)
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, planned)
+	}
+
+	return plan, nil
+}
+
+// PlanDown возвращает миграции, которые откатит DownTo(ctx, version), без изменения базы.
+// Миграции откатываются в порядке, обратном порядку применения
+func (m Migrator) PlanDown(ctx context.Context, version int64) ([]PlannedMigration, error) {
+
+	statuses, err := m.provider.Status(ctx)
+	if err != nil {
+		return nil, errors.Default.Wrap(err)
+	}
+
+	var applied []*goose.MigrationStatus
+	for _, status := range statuses {
+		if status.State == goose.StateApplied && status.Source.Version > version {
+			applied = append(applied, status)
+		}
+	}
+
+	// Последней примененной миграцией может быть не самая старшая версия, так как разрешено применение не по порядку
+	slices.SortStableFunc(applied, func(a, b *goose.MigrationStatus) int {
+		return b.AppliedAt.Compare(a.AppliedAt)
+	})
+
+	plan := make([]PlannedMigration, 0, len(applied))
+	for _, status := range applied {
+		planned, err := m.planned(status.Source, DirectionDown)
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, planned)
+	}
+
+	return plan, nil
+}
+
+func (m Migrator) planned(source *goose.Source, direction Direction) (PlannedMigration, error) {
+
+	planned := PlannedMigration{
+		Version:   source.Version,
+		Path:      source.Path,
+		Direction: direction,
+		SQL:       "",
+	}
+
+	if source.Type != goose.TypeSQL {
+		return planned, nil
+	}
+
+	content, err := fs.ReadFile(m.fsys, source.Path)
+	if err != nil {
+		return planned, errors.Default.Wrap(err).WithParams("path", source.Path)
+	}
+
+	planned.SQL = sqlSection(string(content), direction)
+
+	return planned, nil
+}
+
+// sqlSection возвращает часть SQL файла goose между аннотацией "-- +goose Up" или "-- +goose Down"
+// и следующей аннотацией направления. Остальные аннотации goose остаются в тексте
+func sqlSection(content string, direction Direction) string {
+
+	var (
+		section strings.Builder
+		current Direction
+	)
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch annotation := strings.ToLower(strings.Join(strings.Fields(line), " ")); {
+		case strings.HasPrefix(annotation, "-- +goose up"):
+			current = DirectionUp
+			continue
+		case strings.HasPrefix(annotation, "-- +goose down"):
+			current = DirectionDown
+			continue
+		}
+
+		if current == direction {
+			section.WriteString(line)
+			section.WriteByte('\n')
+		}
+	}
+
+	return strings.TrimSpace(section.String())
+}
@@ -0,0 +1,40 @@
+package migrator
+
+import "testing"
+
+func TestSqlSection(t *testing.T) {
+
+	content := `-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE users (id BIGINT);
+-- +goose StatementEnd
+CREATE INDEX users_id_idx ON users (id);
+
+--  +goose   DOWN
+DROP TABLE users;
+`
+
+	tests := []struct {
+		name      string
+		direction Direction
+		want      string
+	}{
+		{
+			name:      "1. Секция применения",
+			direction: DirectionUp,
+			want:      "-- +goose StatementBegin\nCREATE TABLE users (id BIGINT);\n-- +goose StatementEnd\nCREATE INDEX users_id_idx ON users (id);",
+		},
+		{
+			name:      "2. Секция отката",
+			direction: DirectionDown,
+			want:      "DROP TABLE users;",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sqlSection(content, tt.direction); got != tt.want {
+				t.Errorf("sqlSection() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
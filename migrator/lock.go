@@ -0,0 +1,104 @@
+package migrator
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"pkg/errors"
+	"pkg/log"
+)
+
+// Значения по умолчанию для блокировки
+const (
+	defaultLockTimeout   = 5 * time.Minute
+	defaultRetryInterval = time.Second
+	defaultLockTTL       = 10 * time.Minute
+)
+
+// ErrLockTimeout - блокировку не удалось получить за отведенное время
+var ErrLockTimeout = errors.New("migrator: lock wait timeout")
+
+// Locker - распределенная блокировка, которая не дает нескольким репликам применять миграции одновременно
+type Locker interface {
+
+	// TryLock пытается получить блокировку без ожидания. Возвращает false, если блокировка занята
+	TryLock(ctx context.Context) (bool, error)
+
+	// Unlock освобождает блокировку
+	Unlock(ctx context.Context) error
+}
+
+// withLock выполняет fn под блокировкой и логирует время ожидания блокировки и выполнения миграций
+func (m Migrator) withLock(ctx context.Context, operation string, fn func(ctx context.Context) error) error {
+
+	if m.locker == nil {
+		return fn(ctx)
+	}
+
+	// Ждем блокировку
+	waitStart := time.Now()
+	if err := acquire(ctx, m.locker, m.lockTimeout, defaultRetryInterval); err != nil {
+		return errors.Default.Wrap(err).WithParams("operation", operation, "waited", time.Since(waitStart).String())
+	}
+	log.WithParams("operation", operation, "waited", time.Since(waitStart).String()).Info("migration lock acquired")
+
+	// Освобождаем блокировку, даже если контекст отменен
+	defer func() {
+		unlockCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+		defer cancel()
+		if err := m.locker.Unlock(unlockCtx); err != nil {
+			log.LogError(errors.Default.Wrap(err).WithParams("operation", operation))
+		}
+	}()
+
+	// Выполняем миграции
+	start := time.Now()
+	err := fn(ctx)
+	log.WithParams("operation", operation, "duration", time.Since(start).String()).Info("migrations finished")
+
+	return err
+}
+
+// acquire ждет блокировку не дольше timeout, повторяя попытки раз в retryInterval
+func acquire(ctx context.Context, locker Locker, timeout, retryInterval time.Duration) error {
+
+	if timeout <= 0 {
+		timeout = defaultLockTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		locked, err := locker.TryLock(ctx)
+		if err != nil {
+			return err
+		}
+		if locked {
+			return nil
+		}
+
+		log.WithParams("retryIn", retryInterval.String()).Debug("migration lock is busy, waiting")
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return errors.Default.Wrap(ErrLockTimeout).WithParams("timeout", timeout.String())
+			}
+			return errors.Default.Wrap(ctx.Err())
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// lockOwner возвращает уникальный идентификатор владельца блокировки: хост, pid и случайный суффикс
+func lockOwner() string {
+	hostname, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), hex.EncodeToString(suffix))
+}
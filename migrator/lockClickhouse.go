@@ -0,0 +1,191 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"pkg/errors"
+)
+
+// DefaultClickhouseLockTable - таблица блокировки в ClickHouse по умолчанию
+const DefaultClickhouseLockTable = "migrator_lock"
+
+var _ Locker = new(ClickhouseLocker)
+
+// ClickhouseLocker - блокировка через таблицу в ClickHouse, у которого нет своих блокировок.
+// Каждая попытка вставляет заявку с TTL, блокировку получает самая ранняя живая заявка.
+// Блокировка best-effort: она рассчитана на один узел и синхронные вставки, для кластера лучше использовать RedisLocker
+type ClickhouseLocker struct {
+	db    *sql.DB
+	table string
+	ttl   time.Duration
+
+	mu    sync.Mutex
+	owner string
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// NewClickhouseLocker создает блокировку. Пустой table и нулевой ttl заменяются значениями по умолчанию
+func NewClickhouseLocker(db *sql.DB, table string, ttl time.Duration) *ClickhouseLocker {
+	if table == "" {
+		table = DefaultClickhouseLockTable
+	}
+	if ttl <= 0 {
+		ttl = defaultLockTTL
+	}
+	return &ClickhouseLocker{
+		db:    db,
+		table: table,
+		ttl:   ttl,
+		mu:    sync.Mutex{},
+		owner: "",
+		stop:  nil,
+		done:  nil,
+	}
+}
+
+// TryLock реализует интерфейс Locker.
+func (l *ClickhouseLocker) TryLock(ctx context.Context) (bool, error) {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.owner != "" {
+		return false, errors.Default.New("clickhouse lock is already held")
+	}
+
+	if err := l.createTable(ctx); err != nil {
+		return false, err
+	}
+
+	// Если блокировка уже занята, не создаем лишних заявок
+	holder, err := l.holder(ctx)
+	if err != nil {
+		return false, err
+	}
+	if holder != "" {
+		return false, nil
+	}
+
+	// Каждая попытка - новая заявка, чтобы освобожденные заявки не мешали повторному захвату
+	owner := lockOwner()
+	if err = l.insert(ctx, owner, false); err != nil {
+		return false, err
+	}
+
+	// Заявки могли вставить одновременно, побеждает самая ранняя
+	if holder, err = l.holder(ctx); err != nil {
+		return false, err
+	}
+	if holder != owner {
+		if err = l.insert(ctx, owner, true); err != nil {
+			return false, err
+		}
+		return false, nil
+	}
+
+	// Продлеваем заявку, пока блокировка не освобождена
+	l.owner = owner
+	l.stop, l.done = make(chan struct{}), make(chan struct{})
+	go l.refresh(owner, l.stop, l.done)
+
+	return true, nil
+}
+
+// Unlock реализует интерфейс Locker.
+func (l *ClickhouseLocker) Unlock(ctx context.Context) error {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.owner == "" {
+		return nil
+	}
+
+	close(l.stop)
+	<-l.done
+
+	owner := l.owner
+	l.owner, l.stop, l.done = "", nil, nil
+
+	return l.insert(ctx, owner, true)
+}
+
+func (l *ClickhouseLocker) refresh(owner string, stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), l.ttl/3)
+			_ = l.insert(ctx, owner, false)
+			cancel()
+		}
+	}
+}
+
+func (l *ClickhouseLocker) createTable(ctx context.Context) error {
+
+	query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		owner String,
+		released UInt8,
+		acquired_at DateTime64(3),
+		expires_at DateTime64(3)
+	) ENGINE = MergeTree
+	ORDER BY (acquired_at, owner)
+	TTL toDateTime(expires_at) + INTERVAL 1 DAY`, l.table)
+
+	if _, err := l.db.ExecContext(ctx, query); err != nil {
+		return errors.Default.Wrap(err).WithParams("table", l.table)
+	}
+
+	return nil
+}
+
+// insert добавляет строку заявки. Время берется с сервера, чтобы не зависеть от часов реплик
+func (l *ClickhouseLocker) insert(ctx context.Context, owner string, released bool) error {
+
+	query := fmt.Sprintf(`INSERT INTO %s (owner, released, acquired_at, expires_at)
+		SELECT ?, ?, now64(3), now64(3) + toIntervalMillisecond(?)`, l.table)
+
+	var releasedFlag uint8
+	if released {
+		releasedFlag = 1
+	}
+
+	if _, err := l.db.ExecContext(ctx, query, owner, releasedFlag, l.ttl.Milliseconds()); err != nil {
+		return errors.Default.Wrap(err).WithParams("table", l.table, "owner", owner)
+	}
+
+	return nil
+}
+
+// holder возвращает владельца самой ранней живой заявки или пустую строку, если блокировка свободна
+func (l *ClickhouseLocker) holder(ctx context.Context) (string, error) {
+
+	query := fmt.Sprintf(`SELECT owner FROM %s
+		GROUP BY owner
+		HAVING max(released) = 0 AND max(expires_at) > now64(3)
+		ORDER BY min(acquired_at), owner
+		LIMIT 1`, l.table)
+
+	var owner string
+	err := l.db.QueryRowContext(ctx, query).Scan(&owner)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Default.Wrap(err).WithParams("table", l.table)
+	}
+
+	return owner, nil
+}
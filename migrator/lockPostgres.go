@@ -0,0 +1,101 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync"
+
+	"pkg/errors"
+)
+
+// DefaultPostgresLockKey - ключ advisory блокировки по умолчанию
+const DefaultPostgresLockKey int64 = 5887940537704921958
+
+var _ Locker = new(PostgresLocker)
+
+// PostgresLocker - блокировка через сессионную advisory блокировку Postgres.
+// Блокировка держится на отдельном соединении и снимается сервером, если процесс упал
+type PostgresLocker struct {
+	db  *sql.DB
+	key int64
+
+	mu   sync.Mutex
+	conn *sql.Conn
+}
+
+// NewPostgresLocker создает блокировку. Если key равен 0, используется DefaultPostgresLockKey
+func NewPostgresLocker(db *sql.DB, key int64) *PostgresLocker {
+	if key == 0 {
+		key = DefaultPostgresLockKey
+	}
+	return &PostgresLocker{
+		db:   db,
+		key:  key,
+		mu:   sync.Mutex{},
+		conn: nil,
+	}
+}
+
+// TryLock реализует интерфейс Locker.
+func (l *PostgresLocker) TryLock(ctx context.Context) (bool, error) {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn != nil {
+		return false, errors.Default.New("postgres lock is already held")
+	}
+
+	// Advisory блокировка принадлежит сессии, поэтому берем отдельное соединение из пула
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return false, errors.Default.Wrap(err)
+	}
+
+	var locked bool
+	if err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", l.key).Scan(&locked); err != nil {
+		_ = conn.Close()
+		return false, errors.Default.Wrap(err)
+	}
+
+	if !locked {
+		_ = conn.Close()
+		return false, nil
+	}
+
+	l.conn = conn
+	return true, nil
+}
+
+// Unlock реализует интерфейс Locker.
+func (l *PostgresLocker) Unlock(ctx context.Context) error {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn == nil {
+		return nil
+	}
+	conn := l.conn
+	l.conn = nil
+
+	var unlocked bool
+	err := conn.QueryRowContext(ctx, "SELECT pg_advisory_unlock($1)", l.key).Scan(&unlocked)
+	if err == nil && unlocked {
+		if err = conn.Close(); err != nil {
+			return errors.Default.Wrap(err)
+		}
+		return nil
+	}
+
+	// Блокировка могла остаться на сессии, поэтому соединение нельзя возвращать в пул:
+	// закрываем его, чтобы сервер снял блокировку вместе с сессией
+	_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+	_ = conn.Close()
+
+	if err != nil {
+		return errors.Default.Wrap(err)
+	}
+	return errors.Default.New("postgres lock was not held").WithParams("key", l.key)
+}
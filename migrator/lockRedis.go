@@ -0,0 +1,121 @@
+package migrator
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"pkg/errors"
+)
+
+// DefaultRedisLockKey - ключ блокировки в Redis по умолчанию
+const DefaultRedisLockKey = "migrator:lock"
+
+var _ Locker = new(RedisLocker)
+
+// Скрипты продления и освобождения проверяют владельца, чтобы не снять чужую блокировку после истечения TTL
+var (
+	redisRefreshScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+	redisUnlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+// RedisLocker - блокировка через ключ Redis с TTL. Подходит для любой базы, если у нее нет своих блокировок.
+// Пока блокировка держится, TTL продлевается в фоне, поэтому долгие миграции не теряют блокировку
+type RedisLocker struct {
+	client redis.UniversalClient
+	key    string
+	ttl    time.Duration
+	owner  string
+
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewRedisLocker создает блокировку. Пустой key и нулевой ttl заменяются значениями по умолчанию
+func NewRedisLocker(client redis.UniversalClient, key string, ttl time.Duration) *RedisLocker {
+	if key == "" {
+		key = DefaultRedisLockKey
+	}
+	if ttl <= 0 {
+		ttl = defaultLockTTL
+	}
+	return &RedisLocker{
+		client: client,
+		key:    key,
+		ttl:    ttl,
+		owner:  lockOwner(),
+		mu:     sync.Mutex{},
+		stop:   nil,
+		done:   nil,
+	}
+}
+
+// TryLock реализует интерфейс Locker.
+func (l *RedisLocker) TryLock(ctx context.Context) (bool, error) {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	locked, err := l.client.SetNX(ctx, l.key, l.owner, l.ttl).Result()
+	if err != nil {
+		return false, errors.Default.Wrap(err)
+	}
+	if !locked {
+		return false, nil
+	}
+
+	// Продлеваем TTL, пока блокировка не освобождена
+	l.stop, l.done = make(chan struct{}), make(chan struct{})
+	go l.refresh(l.stop, l.done)
+
+	return true, nil
+}
+
+func (l *RedisLocker) refresh(stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), l.ttl/3)
+			_ = redisRefreshScript.Run(ctx, l.client, []string{l.key}, l.owner, l.ttl.Milliseconds()).Err()
+			cancel()
+		}
+	}
+}
+
+// Unlock реализует интерфейс Locker.
+func (l *RedisLocker) Unlock(ctx context.Context) error {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.stop != nil {
+		close(l.stop)
+		<-l.done
+		l.stop, l.done = nil, nil
+	}
+
+	if err := redisUnlockScript.Run(ctx, l.client, []string{l.key}, l.owner).Err(); err != nil {
+		return errors.Default.Wrap(err)
+	}
+
+	return nil
+}
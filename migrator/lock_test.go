@@ -0,0 +1,140 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pkg/errors"
+)
+
+type fakeLocker struct {
+	busyAttempts int
+	attempts     int
+	unlocked     bool
+}
+
+func (l *fakeLocker) TryLock(context.Context) (bool, error) {
+	l.attempts++
+	return l.attempts > l.busyAttempts, nil
+}
+
+func (l *fakeLocker) Unlock(context.Context) error {
+	l.unlocked = true
+	return nil
+}
+
+func TestAcquire(t *testing.T) {
+
+	t.Run("1. Блокировка свободна", func(t *testing.T) {
+		locker := &fakeLocker{busyAttempts: 0}
+		require.NoError(t, acquire(context.Background(), locker, time.Second, time.Millisecond))
+		assert.Equal(t, 1, locker.attempts)
+	})
+
+	t.Run("2. Блокировка освобождается во время ожидания", func(t *testing.T) {
+		locker := &fakeLocker{busyAttempts: 3}
+		require.NoError(t, acquire(context.Background(), locker, time.Second, time.Millisecond))
+		assert.Equal(t, 4, locker.attempts)
+	})
+
+	t.Run("3. Таймаут ожидания", func(t *testing.T) {
+		locker := &fakeLocker{busyAttempts: 1 << 30}
+		err := acquire(context.Background(), locker, 20*time.Millisecond, time.Millisecond)
+		assert.True(t, errors.Is(err, ErrLockTimeout))
+	})
+}
+
+func TestWithLock(t *testing.T) {
+
+	locker := &fakeLocker{busyAttempts: 0}
+	m := Migrator{locker: locker, lockTimeout: time.Second}
+
+	called := false
+	err := m.withLock(context.Background(), "up", func(context.Context) error {
+		called = true
+		assert.False(t, locker.unlocked)
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.True(t, called)
+	assert.True(t, locker.unlocked)
+}
+
+// Драйвер-заглушка: pg_advisory_unlock возвращает unlocked, закрытые соединения считаются в closed
+type advisoryDriver struct {
+	unlocked bool
+	closed   int
+}
+
+func (d *advisoryDriver) Open(string) (driver.Conn, error) { return &advisoryConn{driver: d}, nil }
+
+type advisoryConn struct{ driver *advisoryDriver }
+
+func (c *advisoryConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c *advisoryConn) Close() error                        { c.driver.closed++; return nil }
+func (c *advisoryConn) Begin() (driver.Tx, error)           { return nil, driver.ErrSkip }
+
+func (c *advisoryConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return &advisoryRows{value: c.driver.unlocked}, nil
+}
+
+type advisoryRows struct {
+	value bool
+	done  bool
+}
+
+func (r *advisoryRows) Columns() []string { return []string{"result"} }
+func (r *advisoryRows) Close() error      { return nil }
+
+func (r *advisoryRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.value
+	return nil
+}
+
+func TestPostgresLockerUnlock(t *testing.T) {
+
+	for name, tc := range map[string]struct {
+		unlocked   bool
+		wantErr    bool
+		wantClosed int
+	}{
+		"1. Блокировка снята, соединение возвращается в пул": {unlocked: true, wantErr: false, wantClosed: 0},
+		"2. Блокировка не снята, соединение закрывается":     {unlocked: false, wantErr: true, wantClosed: 1},
+	} {
+		t.Run(name, func(t *testing.T) {
+
+			drv := &advisoryDriver{unlocked: tc.unlocked, closed: 0}
+			db := sql.OpenDB(advisoryConnector{drv})
+			defer db.Close()
+
+			conn, err := db.Conn(context.Background())
+			require.NoError(t, err)
+
+			locker := NewPostgresLocker(db, 0)
+			locker.conn = conn
+
+			err = locker.Unlock(context.Background())
+			assert.Equal(t, tc.wantErr, err != nil)
+			assert.Nil(t, locker.conn)
+			assert.Equal(t, tc.wantClosed, drv.closed)
+			assert.Equal(t, 1-tc.wantClosed, db.Stats().Idle)
+		})
+	}
+}
+
+type advisoryConnector struct{ driver *advisoryDriver }
+
+func (c advisoryConnector) Connect(context.Context) (driver.Conn, error) { return c.driver.Open("") }
+func (c advisoryConnector) Driver() driver.Driver                        { return c.driver }
@@ -3,8 +3,9 @@ package migrator
 import (
 	"context"
 	"database/sql"
-	"embed"
 	"fmt"
+	"io/fs"
+	"time"
 
 	"pkg/errors"
 	"pkg/log"
@@ -14,40 +15,201 @@ import (
 
 type MigratorConfig struct {
 	Conn            *sql.DB            // Подключение к базе данных
-	EmbedMigrations embed.FS           // Встроенные файлы миграций
+	EmbedMigrations fs.FS              // Файлы миграций, обычно embed.FS
 	Dialect         goose.Dialect      // Драйвер
 	Dir             string             // Путь к миграциям, так как embedding сохраняет структуру директорий
 	Migrations      []*goose.Migration // Миграции
+
+	// Настройки ClickHouse: ON CLUSTER в шаблонах миграций и реплицируемая таблица версий. Используются только с диалектом clickhouse.
+	// Формат таблицы версий отличается от стандартного goose, поэтому для существующей базы нужна новая VersionTable
+	Clickhouse *ClickhouseConfig
+
+	// Распределенная блокировка на время применения миграций. Если не задана, миграции выполняются без блокировки
+	Locker Locker
+
+	// Сколько ждать блокировку, по умолчанию 5 минут
+	LockTimeout time.Duration
 }
 
 type Migrator struct {
 	provider *goose.Provider
+	fsys     fs.FS
+	config   MigratorConfig
+
+	locker      Locker
+	lockTimeout time.Duration
 }
 
 func NewMigrator(config MigratorConfig) (res Migrator, err error) {
-	provider, err := goose.NewProvider(config.Dialect, config.Conn, config.EmbedMigrations, goose.WithGoMigrations(config.Migrations...), goose.WithAllowOutofOrder(true))
+
+	dialect, fsys := config.Dialect, config.EmbedMigrations
+	options := []goose.ProviderOption{goose.WithGoMigrations(config.Migrations...), goose.WithAllowOutofOrder(true)}
+
+	// Для ClickHouse рендерим шаблоны миграций и используем свою таблицу версий, goose требует пустой диалект при своем хранилище
+	if config.Clickhouse != nil {
+		if config.Dialect != goose.DialectClickHouse {
+			return res, errors.Default.New("clickhouse config requires clickhouse dialect").WithParams("dialect", config.Dialect)
+		}
+		dialect = ""
+		fsys = newTemplateFS(fsys, config.Clickhouse.template())
+		options = append(options, goose.WithStore(newClickhouseStore(*config.Clickhouse)))
+	}
+
+	provider, err := goose.NewProvider(dialect, config.Conn, fsys, options...)
 	if err != nil {
 		return res, errors.Default.Wrap(err)
 	}
 
 	return Migrator{
-		provider: provider,
+		provider:    provider,
+		fsys:        fsys,
+		config:      config,
+		locker:      config.Locker,
+		lockTimeout: config.LockTimeout,
 	}, nil
 }
 
+// MigrationStatus - состояние миграции
+type MigrationStatus struct {
+	Version int64
+	Path    string
+
+	// Тип миграции: sql или go
+	Type string
+
+	// Применена ли миграция и когда
+	Applied   bool
+	AppliedAt time.Time
+}
+
 func (m Migrator) Up(ctx context.Context) error {
+	return m.withLock(ctx, "up", func(ctx context.Context) error {
+
+		result, err := m.provider.Up(ctx)
+		if err != nil {
+			return errors.Default.Wrap(err)
+		}
 
-	result, err := m.provider.Up(ctx)
+		return logResults(result...)
+	})
+}
+
+// UpTo применяет непримененные миграции до версии version включительно
+func (m Migrator) UpTo(ctx context.Context, version int64) error {
+	return m.withLock(ctx, "up-to", func(ctx context.Context) error {
+
+		result, err := m.provider.UpTo(ctx, version)
+		if err != nil {
+			return errors.Default.Wrap(err).WithParams("version", version)
+		}
+
+		return logResults(result...)
+	})
+}
+
+// Down откатывает последнюю примененную миграцию
+func (m Migrator) Down(ctx context.Context) error {
+	return m.withLock(ctx, "down", func(ctx context.Context) error {
+
+		result, err := m.provider.Down(ctx)
+		if err != nil {
+			return errors.Default.Wrap(err)
+		}
+
+		return logResults(result)
+	})
+}
+
+// DownTo откатывает миграции до версии version, не включая ее. DownTo(ctx, 0) откатывает все миграции
+func (m Migrator) DownTo(ctx context.Context, version int64) error {
+	return m.withLock(ctx, "down-to", func(ctx context.Context) error {
+
+		result, err := m.provider.DownTo(ctx, version)
+		if err != nil {
+			return errors.Default.Wrap(err).WithParams("version", version)
+		}
+
+		return logResults(result...)
+	})
+}
+
+// Redo откатывает и заново применяет последнюю примененную миграцию
+func (m Migrator) Redo(ctx context.Context) error {
+	return m.withLock(ctx, "redo", func(ctx context.Context) error {
+
+		down, err := m.provider.Down(ctx)
+		if err != nil {
+			return errors.Default.Wrap(err)
+		}
+		if err = logResults(down); err != nil {
+			return err
+		}
+
+		up, err := m.provider.ApplyVersion(ctx, down.Source.Version, true)
+		if err != nil {
+			return errors.Default.Wrap(err).WithParams("version", down.Source.Version)
+		}
+
+		return logResults(up)
+	})
+}
+
+// Reset откатывает все примененные миграции
+func (m Migrator) Reset(ctx context.Context) error {
+	return m.DownTo(ctx, 0)
+}
+
+// Status возвращает состояние всех миграций в порядке версий
+func (m Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+
+	statuses, err := m.provider.Status(ctx)
 	if err != nil {
-		return errors.Default.Wrap(err)
+		return nil, errors.Default.Wrap(err)
 	}
 
-	for _, r := range result {
+	res := make([]MigrationStatus, 0, len(statuses))
+	for _, status := range statuses {
+		res = append(res, MigrationStatus{
+			Version:   status.Source.Version,
+			Path:      status.Source.Path,
+			Type:      string(status.Source.Type),
+			Applied:   status.State == goose.StateApplied,
+			AppliedAt: status.AppliedAt,
+		})
+	}
+
+	return res, nil
+}
+
+// Version возвращает текущую версию схемы
+func (m Migrator) Version(ctx context.Context) (int64, error) {
+
+	version, err := m.provider.GetDBVersion(ctx)
+	if err != nil {
+		return 0, errors.Default.Wrap(err)
+	}
+
+	return version, nil
+}
+
+// logResults логирует результаты миграций и возвращает первую ошибку
+func logResults(results ...*goose.MigrationResult) error {
+
+	for _, r := range results {
+		if r == nil {
+			continue
+		}
+
 		if r.Error != nil {
 			return r.Error
 		}
 
-		log.Info(fmt.Sprintf("migration %d applied", r.Source.Version))
+		logger := log.WithParams("duration", r.Duration.String())
+		if r.Direction == "down" {
+			logger.Info(fmt.Sprintf("migration %d rolled back", r.Source.Version))
+		} else {
+			logger.Info(fmt.Sprintf("migration %d applied", r.Source.Version))
+		}
 	}
 
 	return nil
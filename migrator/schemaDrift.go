@@ -0,0 +1,302 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pressly/goose/v3"
+
+	"pkg/errors"
+	"pkg/log"
+)
+
+// ErrSchemaDrift - живая схема отличается от схемы, которую дают миграции
+var ErrSchemaDrift = errors.New("migrator: schema drift detected")
+
+// DiffKind - вид расхождения схемы
+type DiffKind string
+
+const (
+	DiffMissingTable  DiffKind = "missing_table"
+	DiffExtraTable    DiffKind = "extra_table"
+	DiffMissingColumn DiffKind = "missing_column"
+	DiffExtraColumn   DiffKind = "extra_column"
+	DiffTypeChanged   DiffKind = "type_changed"
+	DiffMissingIndex  DiffKind = "missing_index"
+	DiffExtraIndex    DiffKind = "extra_index"
+	DiffIndexChanged  DiffKind = "index_changed"
+)
+
+// SchemaDiff - одно расхождение между ожидаемой и живой схемой
+type SchemaDiff struct {
+	Kind   DiffKind
+	Table  string
+	Column string // Заполнен для расхождений колонок
+	Index  string // Заполнен для расхождений индексов
+
+	// Тип колонки или определение индекса в ожидаемой и живой схеме
+	Expected string
+	Actual   string
+}
+
+// String возвращает расхождение в виде одной строки для логов и CLI
+func (d SchemaDiff) String() string {
+
+	object := d.Table
+	switch {
+	case d.Column != "":
+		object += "." + d.Column
+	case d.Index != "":
+		object += " index " + d.Index
+	}
+
+	if d.Expected == "" && d.Actual == "" {
+		return fmt.Sprintf("%s %s", d.Kind, object)
+	}
+	return fmt.Sprintf("%s %s: expected %q, actual %q", d.Kind, object, d.Expected, d.Actual)
+}
+
+// Schema - колонки и индексы таблиц базы
+type Schema map[string]TableSchema
+
+// TableSchema - колонки и индексы одной таблицы
+type TableSchema struct {
+	Columns map[string]string // Колонка -> тип
+	Indexes map[string]string // Индекс -> определение
+}
+
+// CheckDrift применяет миграции к пустой базе scratch и сравнивает полученную схему с живой.
+// Таблица версий goose в сравнении не участвует. База scratch должна быть того же диалекта и остается мигрированной
+func (m Migrator) CheckDrift(ctx context.Context, scratch *sql.DB) ([]SchemaDiff, error) {
+
+	// Миграции рендерятся под scratch, иначе ON CLUSTER и {{ .Database }} указывали бы на живую базу
+	var scratchDatabase string
+	if m.config.Clickhouse != nil {
+		if err := scratch.QueryRowContext(ctx, "SELECT currentDatabase()").Scan(&scratchDatabase); err != nil {
+			return nil, errors.Default.Wrap(err).WithParams("database", "scratch")
+		}
+	}
+	config := scratchConfig(m.config, scratch, scratchDatabase)
+
+	scratchMigrator, err := NewMigrator(config)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = scratchMigrator.provider.Up(ctx); err != nil {
+		return nil, errors.Default.Wrap(err).WithParams("database", "scratch")
+	}
+
+	expected, err := LoadSchema(ctx, scratch, config.Dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	actual, err := LoadSchema(ctx, m.config.Conn, m.config.Dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	// Служебные таблицы мигратора
+	for _, table := range []string{goose.DefaultTablename, defaultClickhouseVersionTable, DefaultClickhouseLockTable} {
+		delete(expected, table)
+		delete(actual, table)
+	}
+	if config.Clickhouse != nil && config.Clickhouse.VersionTable != "" {
+		delete(expected, config.Clickhouse.VersionTable)
+		delete(actual, config.Clickhouse.VersionTable)
+	}
+
+	return DiffSchemas(expected, actual), nil
+}
+
+// scratchConfig возвращает настройки мигратора для базы scratch. Для ClickHouse миграции применяются к одному узлу
+// без ON CLUSTER, а в {{ .Database }} подставляется база scratch
+func scratchConfig(config MigratorConfig, scratch *sql.DB, database string) MigratorConfig {
+
+	config.Conn, config.Locker = scratch, nil
+
+	if config.Clickhouse != nil {
+		clickhouse := *config.Clickhouse
+		clickhouse.Cluster = ""
+		clickhouse.Database = database
+		clickhouse.ZooKeeperPath = ""
+		config.Clickhouse = &clickhouse
+	}
+
+	return config
+}
+
+// VerifySchema - проверка схемы при старте сервиса. Логирует каждое расхождение и возвращает ErrSchemaDrift, если они есть
+func (m Migrator) VerifySchema(ctx context.Context, scratch *sql.DB) error {
+
+	diffs, err := m.CheckDrift(ctx, scratch)
+	if err != nil {
+		return err
+	}
+
+	for _, diff := range diffs {
+		log.WithParams("kind", diff.Kind, "table", diff.Table, "column", diff.Column, "index", diff.Index, "expected", diff.Expected, "actual", diff.Actual).
+			Warning("schema drift")
+	}
+
+	if len(diffs) > 0 {
+		return errors.Default.Wrap(ErrSchemaDrift).WithParams("count", len(diffs))
+	}
+
+	return nil
+}
+
+// LoadSchema читает колонки и индексы таблиц текущей схемы Postgres или текущей базы ClickHouse
+func LoadSchema(ctx context.Context, db *sql.DB, dialect goose.Dialect) (Schema, error) {
+
+	var columnsQuery, indexesQuery string
+
+	switch dialect {
+	case goose.DialectPostgres:
+		columnsQuery = `SELECT c.relname, a.attname, format_type(a.atttypid, a.atttypmod) || CASE WHEN a.attnotnull THEN ' NOT NULL' ELSE '' END
+			FROM pg_attribute a
+			JOIN pg_class c ON c.oid = a.attrelid
+			JOIN pg_namespace n ON n.oid = c.relnamespace
+			WHERE n.nspname = current_schema() AND c.relkind IN ('r', 'p') AND a.attnum > 0 AND NOT a.attisdropped`
+		// Имя схемы убирается из определения, чтобы scratch база могла использовать другую схему
+		indexesQuery = `SELECT tablename, indexname, replace(indexdef, ' ON ' || schemaname || '.', ' ON ')
+			FROM pg_indexes
+			WHERE schemaname = current_schema()`
+	case goose.DialectClickHouse:
+		columnsQuery = `SELECT table, name, type FROM system.columns WHERE database = currentDatabase()`
+		indexesQuery = `SELECT table, name, type || ' ' || expr || ' GRANULARITY ' || toString(granularity)
+			FROM system.data_skipping_indices
+			WHERE database = currentDatabase()`
+	default:
+		return nil, errors.Default.New("schema drift is not supported for dialect").WithParams("dialect", dialect)
+	}
+
+	schema := make(Schema)
+
+	if err := scanSchema(ctx, db, columnsQuery, func(table, name, definition string) {
+		schema.table(table).Columns[name] = definition
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := scanSchema(ctx, db, indexesQuery, func(table, name, definition string) {
+		schema.table(table).Indexes[name] = definition
+	}); err != nil {
+		return nil, err
+	}
+
+	return schema, nil
+}
+
+func (s Schema) table(name string) TableSchema {
+	table, ok := s[name]
+	if !ok {
+		table = TableSchema{
+			Columns: make(map[string]string),
+			Indexes: make(map[string]string),
+		}
+		s[name] = table
+	}
+	return table
+}
+
+// scanSchema выполняет запрос, возвращающий таблицу, имя объекта и его определение
+func scanSchema(ctx context.Context, db *sql.DB, query string, fn func(table, name, definition string)) error {
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return errors.Default.Wrap(err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var table, name, definition string
+		if err = rows.Scan(&table, &name, &definition); err != nil {
+			return errors.Default.Wrap(err)
+		}
+		fn(table, name, definition)
+	}
+
+	if err = rows.Err(); err != nil {
+		return errors.Default.Wrap(err)
+	}
+
+	return nil
+}
+
+// DiffSchemas сравнивает ожидаемую и живую схему. Расхождения отсортированы по таблице, виду и имени
+func DiffSchemas(expected, actual Schema) []SchemaDiff {
+
+	var diffs []SchemaDiff
+
+	for table, expectedTable := range expected {
+		actualTable, ok := actual[table]
+		if !ok {
+			diffs = append(diffs, SchemaDiff{Kind: DiffMissingTable, Table: table, Column: "", Index: "", Expected: "", Actual: ""})
+			continue
+		}
+
+		diffs = append(diffs, diffObjects(expectedTable.Columns, actualTable.Columns, func(name, expected, actual string) SchemaDiff {
+			return SchemaDiff{Kind: "", Table: table, Column: name, Index: "", Expected: expected, Actual: actual}
+		}, DiffMissingColumn, DiffExtraColumn, DiffTypeChanged)...)
+
+		diffs = append(diffs, diffObjects(expectedTable.Indexes, actualTable.Indexes, func(name, expected, actual string) SchemaDiff {
+			return SchemaDiff{Kind: "", Table: table, Column: "", Index: name, Expected: expected, Actual: actual}
+		}, DiffMissingIndex, DiffExtraIndex, DiffIndexChanged)...)
+	}
+
+	for table := range actual {
+		if _, ok := expected[table]; !ok {
+			diffs = append(diffs, SchemaDiff{Kind: DiffExtraTable, Table: table, Column: "", Index: "", Expected: "", Actual: ""})
+		}
+	}
+
+	slices.SortFunc(diffs, func(a, b SchemaDiff) int {
+		if c := strings.Compare(a.Table, b.Table); c != 0 {
+			return c
+		}
+		if c := strings.Compare(string(a.Kind), string(b.Kind)); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Column+a.Index, b.Column+b.Index)
+	})
+
+	return diffs
+}
+
+// diffObjects сравнивает колонки или индексы одной таблицы
+func diffObjects(
+	expected, actual map[string]string,
+	newDiff func(name, expected, actual string) SchemaDiff,
+	missing, extra, changed DiffKind,
+) []SchemaDiff {
+
+	var diffs []SchemaDiff
+
+	add := func(kind DiffKind, name, expected, actual string) {
+		diff := newDiff(name, expected, actual)
+		diff.Kind = kind
+		diffs = append(diffs, diff)
+	}
+
+	for name, expectedDefinition := range expected {
+		actualDefinition, ok := actual[name]
+		switch {
+		case !ok:
+			add(missing, name, expectedDefinition, "")
+		case actualDefinition != expectedDefinition:
+			add(changed, name, expectedDefinition, actualDefinition)
+		}
+	}
+
+	for name, actualDefinition := range actual {
+		if _, ok := expected[name]; !ok {
+			add(extra, name, "", actualDefinition)
+		}
+	}
+
+	return diffs
+}
@@ -0,0 +1,74 @@
+package migrator
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/pressly/goose/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffSchemas(t *testing.T) {
+
+	expected := Schema{
+		"users": {
+			Columns: map[string]string{"id": "bigint NOT NULL", "name": "text", "email": "text"},
+			Indexes: map[string]string{"users_pkey": "CREATE UNIQUE INDEX users_pkey ON users USING btree (id)"},
+		},
+		"orders": {
+			Columns: map[string]string{"id": "bigint NOT NULL"},
+			Indexes: map[string]string{},
+		},
+	}
+
+	actual := Schema{
+		"users": {
+			Columns: map[string]string{"id": "integer NOT NULL", "name": "text", "nickname": "text"},
+			Indexes: map[string]string{
+				"users_pkey":     "CREATE UNIQUE INDEX users_pkey ON users USING btree (id)",
+				"users_name_idx": "CREATE INDEX users_name_idx ON users USING btree (name)",
+			},
+		},
+		"tmp": {
+			Columns: map[string]string{"id": "bigint"},
+			Indexes: map[string]string{},
+		},
+	}
+
+	assert.Equal(t, []SchemaDiff{
+		{Kind: DiffMissingTable, Table: "orders"},
+		{Kind: DiffExtraTable, Table: "tmp"},
+		{Kind: DiffExtraColumn, Table: "users", Column: "nickname", Actual: "text"},
+		{Kind: DiffExtraIndex, Table: "users", Index: "users_name_idx", Actual: "CREATE INDEX users_name_idx ON users USING btree (name)"},
+		{Kind: DiffMissingColumn, Table: "users", Column: "email", Expected: "text"},
+		{Kind: DiffTypeChanged, Table: "users", Column: "id", Expected: "bigint NOT NULL", Actual: "integer NOT NULL"},
+	}, DiffSchemas(expected, actual))
+}
+
+func TestScratchConfig(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"migrations/1_events.sql": {Data: []byte("DROP TABLE {{ .Database }}.events {{ .OnCluster }};\nCREATE TABLE {{ .Database }}.events {{ .OnCluster }} (id UInt64) ENGINE = {{ .Replicated \"MergeTree\" }} ORDER BY id")},
+	}
+
+	prod := MigratorConfig{
+		Dialect:    goose.DialectClickHouse,
+		Clickhouse: &ClickhouseConfig{Cluster: "main", Database: "prod", VersionTable: "versions", ZooKeeperPath: "/clickhouse/versions"},
+		Locker:     &fakeLocker{},
+	}
+
+	config := scratchConfig(prod, nil, "scratch")
+
+	// Настройки живого мигратора не меняются
+	assert.Equal(t, "main", prod.Clickhouse.Cluster)
+	assert.Equal(t, "prod", prod.Clickhouse.Database)
+
+	assert.Nil(t, config.Locker)
+	assert.Equal(t, "versions", config.Clickhouse.VersionTable)
+
+	content, err := fs.ReadFile(newTemplateFS(fsys, config.Clickhouse.template()), "migrations/1_events.sql")
+	require.NoError(t, err)
+	assert.Equal(t, "DROP TABLE IF EXISTS scratch.events ;\nCREATE TABLE IF NOT EXISTS scratch.events  (id UInt64) ENGINE = MergeTree() ORDER BY id", string(content))
+}
@@ -0,0 +1,104 @@
+package outbox
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pkg/promUtils"
+)
+
+// metrics - метрики Relay
+type metrics struct {
+	sent          *prometheus.CounterVec
+	failed        *prometheus.CounterVec
+	dead          *prometheus.CounterVec
+	batchDuration prometheus.Histogram
+	pending       prometheus.Gauge
+	oldestPending prometheus.Gauge
+	cleaned       prometheus.Counter
+}
+
+func newMetrics(namespace string, registerer prometheus.Registerer) (*metrics, error) {
+
+	m := &metrics{
+		sent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   "outbox",
+			Name:        "messages_sent_total",
+			Help:        "Total number of outbox messages produced to kafka.",
+			ConstLabels: nil,
+		}, []string{"topic"}),
+		failed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   "outbox",
+			Name:        "messages_failed_total",
+			Help:        "Total number of failed attempts to produce outbox messages.",
+			ConstLabels: nil,
+		}, []string{"topic"}),
+		dead: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   "outbox",
+			Name:        "messages_dead_total",
+			Help:        "Total number of outbox messages given up after too many failed attempts.",
+			ConstLabels: nil,
+		}, []string{"topic"}),
+		batchDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:                       namespace,
+			Subsystem:                       "outbox",
+			Name:                            "relay_batch_duration_seconds",
+			Help:                            "A histogram of the duration (seconds) of outbox relay batches.",
+			ConstLabels:                     nil,
+			Buckets:                         prometheus.DefBuckets,
+			NativeHistogramBucketFactor:     0,
+			NativeHistogramZeroThreshold:    0,
+			NativeHistogramMaxBucketNumber:  0,
+			NativeHistogramMinResetDuration: 0,
+			NativeHistogramMaxZeroThreshold: 0,
+		}),
+		pending: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   "outbox",
+			Name:        "pending_messages",
+			Help:        "Number of outbox messages waiting to be produced.",
+			ConstLabels: nil,
+		}),
+		oldestPending: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   "outbox",
+			Name:        "oldest_pending_message_age_seconds",
+			Help:        "Age (seconds) of the oldest outbox message waiting to be produced.",
+			ConstLabels: nil,
+		}),
+		cleaned: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   "outbox",
+			Name:        "messages_cleaned_total",
+			Help:        "Total number of sent outbox messages deleted by cleanup.",
+			ConstLabels: nil,
+		}),
+	}
+
+	var err error
+	if m.sent, err = promUtils.Register(registerer, m.sent); err != nil {
+		return nil, err
+	}
+	if m.failed, err = promUtils.Register(registerer, m.failed); err != nil {
+		return nil, err
+	}
+	if m.dead, err = promUtils.Register(registerer, m.dead); err != nil {
+		return nil, err
+	}
+	if m.batchDuration, err = promUtils.Register(registerer, m.batchDuration); err != nil {
+		return nil, err
+	}
+	if m.pending, err = promUtils.Register(registerer, m.pending); err != nil {
+		return nil, err
+	}
+	if m.oldestPending, err = promUtils.Register(registerer, m.oldestPending); err != nil {
+		return nil, err
+	}
+	if m.cleaned, err = promUtils.Register(registerer, m.cleaned); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
@@ -0,0 +1,119 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	sq "github.com/Masterminds/squirrel"
+
+	"pkg/errors"
+	"pkg/sql"
+)
+
+// DefaultTable - название таблицы outbox по умолчанию
+const DefaultTable = "outbox"
+
+var (
+	// ErrNoTx - сообщение пытаются записать вне транзакции
+	ErrNoTx = errors.New("outbox: transaction is not found in context")
+
+	// ErrMalformedMessage - строку outbox не удалось превратить в сообщение Kafka, повторять отправку бессмысленно
+	ErrMalformedMessage = errors.New("outbox: malformed message")
+)
+
+// CreateTableQuery возвращает запрос создания таблицы outbox для миграции.
+// Частичный индекс по неотправленным сообщениям ускоряет выборку в Relay.
+// Сообщения, которые Relay перестал отправлять после MaxAttempts попыток, помечаются dead_at и остаются в таблице
+func CreateTableQuery(table string) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %[1]s (
+	id          BIGSERIAL PRIMARY KEY,
+	topic       TEXT        NOT NULL,
+	message_key TEXT,
+	payload     BYTEA       NOT NULL,
+	headers     JSONB,
+	created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+	sent_at     TIMESTAMPTZ,
+	attempts    INT         NOT NULL DEFAULT 0,
+	last_error  TEXT,
+	dead_at     TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS %[1]s_unsent_idx ON %[1]s (id) WHERE sent_at IS NULL AND dead_at IS NULL;
+CREATE INDEX IF NOT EXISTS %[1]s_unsent_key_idx ON %[1]s (message_key, id) WHERE sent_at IS NULL AND dead_at IS NULL;
+CREATE INDEX IF NOT EXISTS %[1]s_sent_at_idx ON %[1]s (sent_at) WHERE sent_at IS NOT NULL;`, table)
+}
+
+// Message - сообщение для отправки в Kafka
+type Message struct {
+	Topic string
+
+	// Ключ партиционирования. Сообщения с одинаковым ключом отправляются в порядке записи
+	Key *string
+
+	Value   []byte
+	Headers map[string]string
+}
+
+// Outbox записывает сообщения в таблицу outbox в транзакции вместе с бизнес-данными
+type Outbox struct {
+	db    sql.SQL
+	table string
+}
+
+// New создает Outbox. Если table пустая, используется DefaultTable
+func New(db sql.SQL, table string) *Outbox {
+	if table == "" {
+		table = DefaultTable
+	}
+	return &Outbox{
+		db:    db,
+		table: table,
+	}
+}
+
+// Put записывает сообщения в outbox. Работает только в транзакции из контекста (sql.InjectTx или DB.InTx),
+// иначе сообщение может записаться без бизнес-данных или наоборот
+func (o *Outbox) Put(ctx context.Context, messages ...Message) error {
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	if sql.ExtractTx(ctx) == nil {
+		return errors.Default.Wrap(ErrNoTx)
+	}
+
+	q := sq.Insert(o.table).Columns("topic", "message_key", "payload", "headers")
+	for _, message := range messages {
+
+		var headers *string
+		if len(message.Headers) != 0 {
+			bytes, err := json.Marshal(message.Headers)
+			if err != nil {
+				return errors.Default.Wrap(err)
+			}
+			headersJSON := string(bytes)
+			headers = &headersJSON
+		}
+
+		q = q.Values(message.Topic, message.Key, message.Value, headers)
+	}
+
+	return o.db.Exec(ctx, q)
+}
+
+// PutJSON сериализует value в JSON и записывает в outbox
+func (o *Outbox) PutJSON(ctx context.Context, topic string, key *string, value any) error {
+
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return errors.Default.Wrap(err)
+	}
+
+	return o.Put(ctx, Message{
+		Topic:   topic,
+		Key:     key,
+		Value:   bytes,
+		Headers: nil,
+	})
+}
@@ -0,0 +1,497 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/Shopify/sarama"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pkg/backoff"
+	"pkg/errors"
+	"pkg/log"
+	"pkg/sql"
+)
+
+// RelayConfig - настройки Relay
+type RelayConfig struct {
+
+	// Название таблицы, по умолчанию DefaultTable
+	Table string
+
+	// Количество сообщений, которые забираются за один проход, по умолчанию 100
+	BatchSize uint64
+
+	// Пауза между проходами, если неотправленных сообщений не осталось, по умолчанию 1 секунда
+	PollInterval time.Duration
+
+	// После ошибок пауза между проходами растет от PollInterval до MaxBackoff, по умолчанию 1 минута
+	MaxBackoff time.Duration
+
+	// Количество попыток отправки сообщения, после которого оно помечается dead_at и больше не отправляется,
+	// чтобы не блокировать следующие сообщения ключа. По умолчанию 10
+	MaxAttempts int
+
+	// Период удаления отправленных сообщений, по умолчанию 1 час
+	CleanupInterval time.Duration
+
+	// Сколько хранить отправленные сообщения, по умолчанию 24 часа
+	Retention time.Duration
+
+	// Namespace метрик и реестр, в котором они регистрируются. Если реестр nil, используется глобальный
+	MetricsNamespace string
+	Registerer       prometheus.Registerer
+}
+
+// Relay забирает неотправленные сообщения из outbox, отправляет их в Kafka и помечает отправленными.
+// Доставка at-least-once: если транзакция не закоммитилась после отправки, сообщения будут отправлены повторно.
+// Несколько экземпляров Relay могут работать с одной таблицей одновременно: строки блокируются через FOR UPDATE SKIP LOCKED.
+// Сообщения с одинаковым ключом отправляются строго в порядке записи, даже если их забрали разные экземпляры
+type Relay struct {
+	db       sql.SQL
+	producer sarama.SyncProducer
+	cfg      RelayConfig
+	metrics  *metrics
+}
+
+// BatchResult - итог одного прохода Relay
+type BatchResult struct {
+
+	// Количество заблокированных сообщений
+	Locked int
+
+	// Количество отправленных сообщений
+	Sent int
+
+	// Количество неотправленных сообщений, которые будут отправлены повторно
+	Failed int
+
+	// Количество неотправленных сообщений, которые помечены dead_at и больше не отправляются
+	Dead int
+}
+
+// record - строка таблицы outbox
+type record struct {
+	ID       int64   `db:"id"`
+	Topic    string  `db:"topic"`
+	Key      *string `db:"message_key"`
+	Payload  []byte  `db:"payload"`
+	Headers  []byte  `db:"headers"`
+	Attempts int     `db:"attempts"`
+}
+
+// NewRelay создает Relay. Для сохранения порядка продюсер должен отправлять не больше одного запроса к брокеру
+// одновременно, как в sarama.NewSyncProducer из pkg/sarama
+func NewRelay(db sql.SQL, producer sarama.SyncProducer, cfg RelayConfig) (*Relay, error) {
+
+	if cfg.Table == "" {
+		cfg.Table = DefaultTable
+	}
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = time.Minute
+	}
+	cfg.MaxBackoff = max(cfg.MaxBackoff, cfg.PollInterval)
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 10
+	}
+	if cfg.CleanupInterval <= 0 {
+		cfg.CleanupInterval = time.Hour
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = 24 * time.Hour
+	}
+
+	m, err := newMetrics(cfg.MetricsNamespace, cfg.Registerer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Relay{
+		db:       db,
+		producer: producer,
+		cfg:      cfg,
+		metrics:  m,
+	}, nil
+}
+
+// Run отправляет сообщения, пока не отменен контекст. Ошибки отдельных проходов логируются и не прерывают работу
+func (r *Relay) Run(ctx context.Context) error {
+
+	pollTimer := time.NewTimer(0)
+	defer pollTimer.Stop()
+
+	// Количество проходов подряд, завершившихся ошибкой
+	failures := 0
+
+	cleanupTicker := time.NewTicker(r.cfg.CleanupInterval)
+	defer cleanupTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-cleanupTicker.C:
+			if err := r.Cleanup(ctx); err != nil && !errors.IsContextError(err) {
+				log.LogError(err)
+			}
+
+		case <-pollTimer.C:
+			result, err := r.RelayBatch(ctx)
+			if err != nil && !errors.IsContextError(err) {
+				log.LogError(err)
+			}
+
+			switch {
+
+			// Если отправили полную пачку, сразу идем за следующей
+			case err == nil && uint64(result.Sent) == r.cfg.BatchSize:
+				failures = 0
+				pollTimer.Reset(0)
+				continue
+
+			// После ошибок увеличиваем паузу, чтобы не нагружать недоступные брокер или базу
+			case err != nil || result.Failed != 0:
+				pollTimer.Reset(backoff.Delay(r.cfg.PollInterval, r.cfg.MaxBackoff, failures))
+				failures++
+
+			default:
+				failures = 0
+				pollTimer.Reset(r.cfg.PollInterval)
+			}
+
+			if err = r.updateQueueMetrics(ctx); err != nil && !errors.IsContextError(err) {
+				log.LogError(err)
+			}
+		}
+	}
+}
+
+// RelayBatch выполняет один проход: забирает до BatchSize сообщений, отправляет их и помечает отправленными.
+// Сообщения, которые не отправились MaxAttempts раз или не могут быть отправлены в принципе, помечаются dead_at
+func (r *Relay) RelayBatch(ctx context.Context) (result BatchResult, err error) {
+
+	start := time.Now()
+	defer func() { r.metrics.batchDuration.Observe(time.Since(start).Seconds()) }()
+
+	err = r.db.InTx(ctx, nil, func(ctx context.Context) error {
+
+		// Блокируем неотправленные сообщения, пропуская заблокированные другими экземплярами
+		var records []record
+		if err := r.db.Select(ctx, &records, sq.
+			Select("id", "topic", "message_key", "payload", "headers", "attempts").
+			From(r.cfg.Table).
+			Where(sq.Eq{"sent_at": nil, "dead_at": nil}).
+			OrderBy("id").
+			Limit(r.cfg.BatchSize).
+			Suffix("FOR UPDATE SKIP LOCKED"),
+		); err != nil {
+			return err
+		}
+		result = BatchResult{Locked: len(records), Sent: 0, Failed: 0, Dead: 0}
+		if len(records) == 0 {
+			return nil
+		}
+
+		// Убираем сообщения, перед которыми есть неотправленные сообщения с тем же ключом вне нашей пачки
+		heads, err := r.keyHeads(ctx, records)
+		if err != nil {
+			return err
+		}
+		records = filterKeyHeads(records, heads)
+
+		sent, failed := r.produce(records)
+
+		dead, err := r.markResults(ctx, records, sent, failed)
+		if err != nil {
+			return err
+		}
+		result.Sent, result.Failed, result.Dead = len(sent), len(failed)-dead, dead
+
+		return nil
+	})
+
+	return result, err
+}
+
+// keyHeads возвращает id самого раннего неотправленного сообщения для каждого ключа из пачки
+func (r *Relay) keyHeads(ctx context.Context, records []record) (map[string]int64, error) {
+
+	keys := make([]string, 0, len(records))
+	for _, rec := range records {
+		if rec.Key != nil {
+			keys = append(keys, *rec.Key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	var rows []struct {
+		Key   string `db:"message_key"`
+		MinID int64  `db:"min_id"`
+	}
+	if err := r.db.Select(ctx, &rows, sq.
+		Select("message_key", "MIN(id) AS min_id").
+		From(r.cfg.Table).
+		Where(sq.Eq{"sent_at": nil, "dead_at": nil, "message_key": keys}).
+		GroupBy("message_key"),
+	); err != nil {
+		return nil, err
+	}
+
+	heads := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		heads[row.Key] = row.MinID
+	}
+
+	return heads, nil
+}
+
+// filterKeyHeads оставляет сообщения без ключа и сообщения тех ключей, самое раннее неотправленное сообщение
+// которых попало в пачку. Остальные сообщения ключа ждут, пока другой экземпляр отправит предыдущие
+func filterKeyHeads(records []record, heads map[string]int64) []record {
+
+	ids := make(map[int64]struct{}, len(records))
+	for _, rec := range records {
+		ids[rec.ID] = struct{}{}
+	}
+
+	res := records[:0]
+	for _, rec := range records {
+		if rec.Key != nil {
+			if _, ok := ids[heads[*rec.Key]]; !ok {
+				continue
+			}
+		}
+		res = append(res, rec)
+	}
+
+	return res
+}
+
+// splitWaves раскладывает сообщения по волнам: в волну i попадает i-е сообщение каждого ключа.
+// Сообщения без ключа не упорядочены и отправляются в первой волне
+func splitWaves(records []record) [][]record {
+
+	var waves [][]record
+	position := make(map[string]int)
+
+	for _, rec := range records {
+
+		wave := 0
+		if rec.Key != nil {
+			wave = position[*rec.Key]
+			position[*rec.Key]++
+		}
+
+		for len(waves) <= wave {
+			waves = append(waves, nil)
+		}
+		waves[wave] = append(waves[wave], rec)
+	}
+
+	return waves
+}
+
+// produce отправляет сообщения волнами. Если сообщение ключа не отправилось, следующие сообщения этого ключа
+// не отправляются, чтобы не нарушить порядок. Возвращает id отправленных сообщений и ошибки неотправленных
+func (r *Relay) produce(records []record) (sent []int64, failed map[int64]error) {
+
+	failed = make(map[int64]error)
+	failedKeys := make(map[string]struct{})
+
+	for _, wave := range splitWaves(records) {
+
+		batch := make([]*sarama.ProducerMessage, 0, len(wave))
+		batchRecords := make(map[*sarama.ProducerMessage]record, len(wave))
+
+		for _, rec := range wave {
+			if rec.Key != nil {
+				if _, ok := failedKeys[*rec.Key]; ok {
+					continue
+				}
+			}
+
+			message, err := toProducerMessage(rec)
+			if err != nil {
+				failed[rec.ID] = err
+				if rec.Key != nil {
+					failedKeys[*rec.Key] = struct{}{}
+				}
+				continue
+			}
+
+			batch = append(batch, message)
+			batchRecords[message] = rec
+		}
+
+		if len(batch) == 0 {
+			continue
+		}
+
+		// Собираем ошибки отправки отдельных сообщений
+		batchErrors := make(map[*sarama.ProducerMessage]error)
+		if err := r.producer.SendMessages(batch); err != nil {
+			var producerErrors sarama.ProducerErrors
+			if errors.As(err, &producerErrors) {
+				for _, producerErr := range producerErrors {
+					batchErrors[producerErr.Msg] = producerErr.Err
+				}
+			} else {
+				for _, message := range batch {
+					batchErrors[message] = err
+				}
+			}
+		}
+
+		for _, message := range batch {
+			rec := batchRecords[message]
+			if err, ok := batchErrors[message]; ok {
+				failed[rec.ID] = err
+				if rec.Key != nil {
+					failedKeys[*rec.Key] = struct{}{}
+				}
+				r.metrics.failed.WithLabelValues(rec.Topic).Inc()
+				continue
+			}
+			sent = append(sent, rec.ID)
+			r.metrics.sent.WithLabelValues(rec.Topic).Inc()
+		}
+	}
+
+	return sent, failed
+}
+
+// markResults помечает отправленные сообщения и записывает ошибки неотправленных.
+// Возвращает количество сообщений, помеченных dead_at
+func (r *Relay) markResults(ctx context.Context, records []record, sent []int64, failed map[int64]error) (dead int, err error) {
+
+	if len(sent) != 0 {
+		if err = r.db.Exec(ctx, sq.
+			Update(r.cfg.Table).
+			Set("sent_at", sq.Expr("now()")).
+			Where(sq.Eq{"id": sent}),
+		); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, rec := range records {
+
+		produceErr, ok := failed[rec.ID]
+		if !ok {
+			continue
+		}
+
+		q := sq.
+			Update(r.cfg.Table).
+			Set("attempts", sq.Expr("attempts + 1")).
+			Set("last_error", produceErr.Error()).
+			Where(sq.Eq{"id": rec.ID})
+
+		isDead := r.isDead(rec, produceErr)
+		if isDead {
+			q = q.Set("dead_at", sq.Expr("now()"))
+		}
+
+		if err = r.db.Exec(ctx, q); err != nil {
+			return 0, err
+		}
+
+		if isDead {
+			dead++
+			r.metrics.dead.WithLabelValues(rec.Topic).Inc()
+			log.LogError(errors.Default.Wrap(produceErr).WithParams("id", rec.ID, "topic", rec.Topic, "attempts", rec.Attempts+1))
+		}
+	}
+
+	return dead, nil
+}
+
+// isDead проверяет, что сообщение больше не нужно отправлять: попытки кончились или повтор ничего не изменит
+func (r *Relay) isDead(rec record, produceErr error) bool {
+	return rec.Attempts+1 >= r.cfg.MaxAttempts ||
+		errors.Is(produceErr, ErrMalformedMessage) ||
+		errors.Is(produceErr, sarama.ErrMessageSizeTooLarge) ||
+		errors.Is(produceErr, sarama.ErrInvalidMessage)
+}
+
+// Cleanup удаляет отправленные сообщения старше Retention
+func (r *Relay) Cleanup(ctx context.Context) error {
+
+	deleted, err := r.db.ExecWithRowsAffected(ctx, sq.
+		Delete(r.cfg.Table).
+		Where(sq.Lt{"sent_at": time.Now().Add(-r.cfg.Retention)}),
+	)
+	if err != nil {
+		return err
+	}
+	r.metrics.cleaned.Add(float64(deleted))
+
+	return nil
+}
+
+// updateQueueMetrics обновляет метрики размера и возраста очереди неотправленных сообщений
+func (r *Relay) updateQueueMetrics(ctx context.Context) error {
+
+	var stats struct {
+		Pending   int64    `db:"pending"`
+		OldestAge *float64 `db:"oldest_age"`
+	}
+	if err := r.db.Get(ctx, &stats, sq.
+		Select("COUNT(*) AS pending", "EXTRACT(EPOCH FROM now() - MIN(created_at)) AS oldest_age").
+		From(r.cfg.Table).
+		Where(sq.Eq{"sent_at": nil, "dead_at": nil}),
+	); err != nil {
+		return err
+	}
+
+	r.metrics.pending.Set(float64(stats.Pending))
+	if stats.OldestAge != nil {
+		r.metrics.oldestPending.Set(*stats.OldestAge)
+	} else {
+		r.metrics.oldestPending.Set(0)
+	}
+
+	return nil
+}
+
+// toProducerMessage собирает сообщение Kafka из строки outbox
+func toProducerMessage(rec record) (*sarama.ProducerMessage, error) {
+
+	var headers []sarama.RecordHeader
+	if len(rec.Headers) != 0 {
+		var headersMap map[string]string
+		if err := json.Unmarshal(rec.Headers, &headersMap); err != nil {
+			return nil, errors.Default.Wrap(ErrMalformedMessage).WithAdditionalError(err).WithParams("id", rec.ID)
+		}
+		for key, value := range headersMap {
+			headers = append(headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+		}
+	}
+
+	var key sarama.Encoder
+	if rec.Key != nil {
+		key = sarama.StringEncoder(*rec.Key)
+	}
+
+	return &sarama.ProducerMessage{
+		Topic:     rec.Topic,
+		Key:       key,
+		Value:     sarama.ByteEncoder(rec.Payload),
+		Headers:   headers,
+		Metadata:  nil,
+		Offset:    0,
+		Partition: 0,
+		Timestamp: time.Now(),
+	}, nil
+}
@@ -0,0 +1,165 @@
+package outbox
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/Shopify/sarama"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/mock"
+
+	"pkg/errors"
+	"pkg/sql"
+)
+
+func key(k string) *string { return &k }
+
+func ids(records []record) []int64 {
+	res := make([]int64, 0, len(records))
+	for _, rec := range records {
+		res = append(res, rec.ID)
+	}
+	return res
+}
+
+func TestFilterKeyHeads(t *testing.T) {
+
+	records := []record{
+		{ID: 3, Key: key("a")},
+		{ID: 4, Key: key("b")},
+		{ID: 5, Key: nil},
+		{ID: 6, Key: key("a")},
+	}
+
+	// У ключа b есть более раннее неотправленное сообщение, заблокированное другим экземпляром
+	heads := map[string]int64{"a": 3, "b": 2}
+
+	if got := ids(filterKeyHeads(records, heads)); !reflect.DeepEqual(got, []int64{3, 5, 6}) {
+		t.Errorf("filterKeyHeads() = %v", got)
+	}
+}
+
+func TestSplitWaves(t *testing.T) {
+
+	records := []record{
+		{ID: 1, Key: key("a")},
+		{ID: 2, Key: key("b")},
+		{ID: 3, Key: key("a")},
+		{ID: 4, Key: nil},
+		{ID: 5, Key: key("a")},
+	}
+
+	var got [][]int64
+	for _, wave := range splitWaves(records) {
+		got = append(got, ids(wave))
+	}
+
+	want := [][]int64{{1, 2, 4}, {3}, {5}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("splitWaves() = %v, want %v", got, want)
+	}
+}
+
+// Продюсер-заглушка, который возвращает ошибку для сообщений из fail
+type fakeProducer struct {
+	sarama.SyncProducer
+	fail    map[string]bool
+	batches [][]string
+}
+
+func (p *fakeProducer) SendMessages(messages []*sarama.ProducerMessage) error {
+	var (
+		batch  []string
+		errors sarama.ProducerErrors
+	)
+	for _, message := range messages {
+		value, _ := message.Value.Encode()
+		batch = append(batch, string(value))
+		if p.fail[string(value)] {
+			errors = append(errors, &sarama.ProducerError{Msg: message, Err: sarama.ErrOutOfBrokers})
+		}
+	}
+	p.batches = append(p.batches, batch)
+	if len(errors) != 0 {
+		return errors
+	}
+	return nil
+}
+
+func TestRelay_produce(t *testing.T) {
+
+	producer := &fakeProducer{fail: map[string]bool{"b1": true}}
+
+	m, err := newMetrics("test", prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	relay := &Relay{db: nil, producer: producer, cfg: RelayConfig{}, metrics: m}
+
+	sent, failed := relay.produce([]record{
+		{ID: 1, Topic: "topic", Key: key("a"), Payload: []byte("a1")},
+		{ID: 2, Topic: "topic", Key: key("b"), Payload: []byte("b1")},
+		{ID: 3, Topic: "topic", Key: key("a"), Payload: []byte("a2")},
+		{ID: 4, Topic: "topic", Key: key("b"), Payload: []byte("b2")},
+	})
+
+	if !reflect.DeepEqual(sent, []int64{1, 3}) {
+		t.Errorf("sent = %v, want [1 3]", sent)
+	}
+	if _, ok := failed[2]; !ok || len(failed) != 1 {
+		t.Errorf("failed = %v, want только 2", failed)
+	}
+
+	// Первая волна: a1 и b1, b1 падает. Вторая волна: только a2, b2 не отправляется после ошибки b1
+	if want := [][]string{{"a1", "b1"}, {"a2"}}; !reflect.DeepEqual(producer.batches, want) {
+		t.Errorf("batches = %v, want %v", producer.batches, want)
+	}
+}
+
+func TestRelay_markResults(t *testing.T) {
+
+	m, err := newMetrics("test", prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Запоминаем id сообщений, которые помечаются dead_at
+	var deadIDs []any
+	db := sql.NewMockSQL(t)
+	db.On("Exec", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		query, queryArgs, err := args.Get(1).(sq.Sqlizer).ToSql()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(query, "dead_at") {
+			deadIDs = append(deadIDs, queryArgs[len(queryArgs)-1])
+		}
+	}).Return(nil)
+
+	relay := &Relay{db: db, producer: nil, cfg: RelayConfig{Table: DefaultTable, MaxAttempts: 3}, metrics: m}
+
+	records := []record{
+		{ID: 1, Topic: "topic", Attempts: 0},
+		{ID: 2, Topic: "topic", Attempts: 0},
+		{ID: 3, Topic: "topic", Attempts: 2},
+		{ID: 4, Topic: "topic", Attempts: 0},
+	}
+	failed := map[int64]error{
+		2: sarama.ErrOutOfBrokers,
+		3: sarama.ErrOutOfBrokers,
+		4: errors.Default.Wrap(ErrMalformedMessage),
+	}
+
+	dead, err := relay.markResults(context.Background(), records, []int64{1}, failed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2 - будет отправлено повторно, 3 - кончились попытки, 4 - повтор ничего не изменит
+	if dead != 2 || !reflect.DeepEqual(deadIDs, []any{int64(3), int64(4)}) {
+		t.Errorf("dead = %d, deadIDs = %v, want 2 [3 4]", dead, deadIDs)
+	}
+}
@@ -0,0 +1,32 @@
+package promUtils
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pkg/errors"
+)
+
+// Register регистрирует коллектор в registerer, если registerer nil - в глобальном реестре.
+// Если такой коллектор уже зарегистрирован, возвращает существующий, поэтому повторное создание клиента
+// с теми же метриками не считается ошибкой
+func Register[C prometheus.Collector](registerer prometheus.Registerer, collector C) (C, error) {
+
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+
+	if err := registerer.Register(collector); err != nil {
+		var alreadyRegistered prometheus.AlreadyRegisteredError
+		if !errors.As(err, &alreadyRegistered) {
+			return collector, errors.Default.Wrap(err)
+		}
+
+		existing, ok := alreadyRegistered.ExistingCollector.(C)
+		if !ok {
+			return collector, errors.Default.Wrap(err)
+		}
+		return existing, nil
+	}
+
+	return collector, nil
+}
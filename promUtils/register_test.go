@@ -0,0 +1,29 @@
+package promUtils
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegister(t *testing.T) {
+
+	registry := prometheus.NewRegistry()
+	opts := prometheus.CounterOpts{Namespace: "test", Subsystem: "", Name: "events_total", Help: "Events.", ConstLabels: nil}
+
+	t.Run("1. Повторная регистрация возвращает существующий коллектор", func(t *testing.T) {
+		first, err := Register(registry, prometheus.NewCounterVec(opts, []string{"status"}))
+		require.NoError(t, err)
+
+		second, err := Register(registry, prometheus.NewCounterVec(opts, []string{"status"}))
+		require.NoError(t, err)
+		assert.Same(t, first, second)
+	})
+
+	t.Run("2. Коллектор другого типа с тем же именем", func(t *testing.T) {
+		_, err := Register(registry, prometheus.NewGaugeVec(prometheus.GaugeOpts(opts), []string{"status"}))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,112 @@
+package redact
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Detector ищет чувствительные данные внутри значения
+type Detector struct {
+
+	// Название, которое подставляется в заглушку
+	Name string
+
+	// Шаблон кандидатов
+	Pattern *regexp.Regexp
+
+	// Дополнительная проверка кандидата, может быть nil
+	Validate func(match string) bool
+}
+
+var (
+	// DetectorJWT находит JWT-токены
+	DetectorJWT = Detector{
+		Name:     "jwt",
+		Pattern:  regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+		Validate: nil,
+	}
+
+	// DetectorCardNumber находит номера банковских карт, прошедшие проверку по алгоритму Луна.
+	// Номер без разделителей должен начинаться с префикса известной платежной системы,
+	// иначе под проверку попадает каждое десятое число, например идентификаторы и время в миллисекундах
+	DetectorCardNumber = Detector{
+		Name:     "card",
+		Pattern:  regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		Validate: cardNumberValid,
+	}
+
+	// DetectorEmail находит email-адреса
+	DetectorEmail = Detector{
+		Name:     "email",
+		Pattern:  regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+		Validate: nil,
+	}
+)
+
+// cardIINs - диапазоны префиксов (IIN) платежных систем и допустимая длина номера
+var cardIINs = []struct {
+	low, high      string
+	minLen, maxLen int
+}{
+	{low: "4", high: "4", minLen: 13, maxLen: 19},       // Visa
+	{low: "51", high: "55", minLen: 16, maxLen: 16},     // Mastercard
+	{low: "2221", high: "2720", minLen: 16, maxLen: 16}, // Mastercard
+	{low: "2200", high: "2204", minLen: 16, maxLen: 19}, // Мир
+	{low: "34", high: "34", minLen: 15, maxLen: 15},     // American Express
+	{low: "37", high: "37", minLen: 15, maxLen: 15},     // American Express
+	{low: "62", high: "62", minLen: 16, maxLen: 19},     // UnionPay
+	{low: "6011", high: "6011", minLen: 16, maxLen: 19}, // Discover
+	{low: "644", high: "649", minLen: 16, maxLen: 19},   // Discover
+	{low: "65", high: "65", minLen: 16, maxLen: 19},     // Discover
+	{low: "3528", high: "3589", minLen: 16, maxLen: 19}, // JCB
+	{low: "300", high: "305", minLen: 14, maxLen: 19},   // Diners Club
+	{low: "36", high: "36", minLen: 14, maxLen: 19},     // Diners Club
+	{low: "56", high: "58", minLen: 13, maxLen: 19},     // Maestro
+	{low: "6759", high: "6759", minLen: 13, maxLen: 19}, // Maestro
+}
+
+// cardNumberValid проверяет номер карты: контрольная сумма и либо разделители, либо префикс платежной системы
+func cardNumberValid(match string) bool {
+
+	if !luhnValid(match) {
+		return false
+	}
+	if strings.ContainsAny(match, " -") {
+		return true
+	}
+
+	for _, iin := range cardIINs {
+		if len(match) >= iin.minLen && len(match) <= iin.maxLen &&
+			match[:len(iin.low)] >= iin.low && match[:len(iin.high)] <= iin.high {
+			return true
+		}
+	}
+
+	return false
+}
+
+// luhnValid проверяет контрольную сумму номера карты, разделители пропускаются
+func luhnValid(number string) bool {
+	var sum, digits int
+	double := false
+
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+		double = !double
+	}
+
+	return digits >= 13 && sum%10 == 0
+}
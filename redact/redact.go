@@ -0,0 +1,296 @@
+package redact
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+)
+
+// Mode - способ скрытия чувствительного значения
+type Mode int
+
+const (
+	ModeMask Mode = iota + 1 // Значение заменяется на заглушку
+	ModeHash                 // Значение заменяется на HMAC-хэш, чтобы по нему можно было сопоставлять записи
+)
+
+// mask - заглушка, которой заменяется значение в режиме ModeMask
+const mask = "[REDACTED]"
+
+// hashLen - количество символов хэша, которое попадает в лог
+const hashLen = 16
+
+// DefaultKeys - шаблоны ключей, значения которых скрываются по умолчанию
+var DefaultKeys = []string{"password", "token", "secret", "authorization", "inn", "phone", "ifa", "ip"}
+
+// Config - настройки редактора
+type Config struct {
+
+	// Шаблоны ключей, значения которых скрываются целиком.
+	// Шаблон сравнивается со словами ключа, а не с подстрокой: "ip" скроет "clientIP" и "ip_address", но не "zip"
+	Keys []string
+
+	// Детекторы, которые ищут чувствительные данные внутри значений любых ключей
+	Detectors []Detector
+
+	// Способ скрытия значений
+	Mode Mode
+
+	// Соль для хэширования в режиме ModeHash
+	HashSalt string
+}
+
+// DefaultConfig возвращает конфигурацию с шаблонами ключей и детекторами по умолчанию
+func DefaultConfig() Config {
+	return Config{
+		Keys:      DefaultKeys,
+		Detectors: []Detector{DetectorJWT, DetectorCardNumber, DetectorEmail},
+		Mode:      ModeMask,
+		HashSalt:  "",
+	}
+}
+
+// Redactor скрывает чувствительные данные в параметрах логов и ошибок
+type Redactor struct {
+	keys      [][]string
+	detectors []Detector
+	mode      Mode
+	hashSalt  []byte
+}
+
+// New возвращает новый экземпляр Redactor
+func New(cfg Config) *Redactor {
+
+	keys := make([][]string, 0, len(cfg.Keys))
+	for _, key := range cfg.Keys {
+		if words := splitWords(key); len(words) != 0 {
+			keys = append(keys, words)
+		}
+	}
+
+	if cfg.Mode == 0 {
+		cfg.Mode = ModeMask
+	}
+
+	return &Redactor{
+		keys:      keys,
+		detectors: cfg.Detectors,
+		mode:      cfg.Mode,
+		hashSalt:  []byte(cfg.HashSalt),
+	}
+}
+
+// IsSensitiveKey проверяет, подпадает ли ключ под один из шаблонов
+func (r *Redactor) IsSensitiveKey(key string) bool {
+	words := splitWords(key)
+	for _, pattern := range r.keys {
+		if containsWords(words, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// Params возвращает копию параметров со скрытыми чувствительными значениями
+func (r *Redactor) Params(params map[string]any) map[string]any {
+	if params == nil {
+		return nil
+	}
+
+	redacted := make(map[string]any, len(params))
+	for key, value := range params {
+		redacted[key] = r.Value(key, value)
+	}
+	return redacted
+}
+
+// Value скрывает значение целиком, если ключ чувствительный, иначе ищет в значении чувствительные данные детекторами.
+// Детекторы применяются только к строковым значениям. В строках с JSON, например в теле сообщения Kafka,
+// а также во вложенных map, слайсах и структурах дополнительно скрываются значения чувствительных ключей
+func (r *Redactor) Value(key string, value any) any {
+
+	if r.IsSensitiveKey(key) {
+		if value == nil {
+			return nil
+		}
+		return r.replace(fmt.Sprintf("%v", value), "")
+	}
+
+	switch v := value.(type) {
+	case string:
+		return r.text(v)
+	case []byte:
+		return r.text(string(v))
+	default:
+		return r.composite(value)
+	}
+}
+
+// composite скрывает чувствительные данные во вложенных map, слайсах и структурах. Значение проходит через JSON,
+// поэтому учитываются json-теги полей. Если скрывать нечего, значение возвращается как есть, иначе - в виде map или слайса
+func (r *Redactor) composite(value any) any {
+
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return value
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct:
+	default:
+		return value
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var decoded any
+	if err = decoder.Decode(&decoded); err != nil {
+		return value
+	}
+
+	if redacted, changed := r.jsonValue(decoded); changed {
+		return redacted
+	}
+	return value
+}
+
+// text скрывает чувствительные данные в строке, которая может оказаться JSON
+func (r *Redactor) text(s string) string {
+	if redacted, ok := r.JSON(s); ok {
+		return redacted
+	}
+	return r.String(s)
+}
+
+// JSON скрывает значения чувствительных ключей на любой вложенности и данные, найденные детекторами в строках JSON.
+// Возвращает false, если s не JSON-объект или массив
+func (r *Redactor) JSON(s string) (string, bool) {
+
+	trimmed := strings.TrimSpace(s)
+	if trimmed == "" || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return "", false
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(trimmed))
+	decoder.UseNumber()
+
+	var data any
+	if err := decoder.Decode(&data); err != nil || decoder.More() {
+		return "", false
+	}
+
+	redacted, _ := r.jsonValue(data)
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(redacted); err != nil {
+		return "", false
+	}
+
+	return strings.TrimSuffix(buf.String(), "\n"), true
+}
+
+// jsonValue обходит разобранный JSON и скрывает чувствительные значения. changed сообщает, было ли что-то скрыто
+func (r *Redactor) jsonValue(value any) (redacted any, changed bool) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if r.IsSensitiveKey(key) {
+				if item != nil {
+					v[key] = r.replace(fmt.Sprintf("%v", item), "")
+					changed = true
+				}
+				continue
+			}
+			var itemChanged bool
+			v[key], itemChanged = r.jsonValue(item)
+			changed = changed || itemChanged
+		}
+		return v, changed
+	case []any:
+		for i, item := range v {
+			var itemChanged bool
+			v[i], itemChanged = r.jsonValue(item)
+			changed = changed || itemChanged
+		}
+		return v, changed
+	case string:
+		s := r.String(v)
+		return s, s != v
+	default:
+		return value, false
+	}
+}
+
+// String скрывает найденные детекторами чувствительные данные внутри строки
+func (r *Redactor) String(s string) string {
+	for _, detector := range r.detectors {
+		s = detector.Pattern.ReplaceAllStringFunc(s, func(match string) string {
+			if detector.Validate != nil && !detector.Validate(match) {
+				return match
+			}
+			return r.replace(match, detector.Name)
+		})
+	}
+	return s
+}
+
+func (r *Redactor) replace(value, detectorName string) string {
+	switch r.mode {
+	case ModeHash:
+		mac := hmac.New(sha256.New, r.hashSalt)
+		_, _ = mac.Write([]byte(value))
+		return "sha256:" + hex.EncodeToString(mac.Sum(nil))[:hashLen]
+	case ModeMask:
+		if detectorName != "" {
+			return "[REDACTED:" + detectorName + "]"
+		}
+		return mask
+	default:
+		return mask
+	}
+}
+
+// defaultRedactor - синглтон переменная редактора, по умолчанию данные не скрываются
+var defaultRedactor atomic.Pointer[Redactor]
+
+// Init конфигурирует глобальный редактор, который используют логгер и обработчик ошибок
+func Init(cfg Config) {
+	defaultRedactor.Store(New(cfg))
+}
+
+// Default возвращает глобальный редактор или nil, если он не сконфигурирован
+func Default() *Redactor {
+	return defaultRedactor.Load()
+}
+
+// Params скрывает чувствительные данные глобальным редактором. Если редактор не сконфигурирован, возвращает параметры как есть
+func Params(params map[string]any) map[string]any {
+	if r := Default(); r != nil {
+		return r.Params(params)
+	}
+	return params
+}
+
+// String скрывает чувствительные данные глобальным редактором. Если редактор не сконфигурирован, возвращает строку как есть
+func String(s string) string {
+	if r := Default(); r != nil {
+		return r.String(s)
+	}
+	return s
+}
@@ -0,0 +1,62 @@
+package redact
+
+import (
+	"strings"
+	"unicode"
+)
+
+// splitWords разбивает ключ на слова в нижнем регистре по разделителям и границам camelCase:
+// "userIPAddress" -> [user ip address], "access_token" -> [access token]
+func splitWords(key string) []string {
+
+	var words []string
+	var current []rune
+
+	flush := func() {
+		if len(current) != 0 {
+			words = append(words, strings.ToLower(string(current)))
+			current = current[:0]
+		}
+	}
+
+	runes := []rune(key)
+	for i, r := range runes {
+
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+
+		if unicode.IsUpper(r) && len(current) != 0 {
+			prev := runes[i-1]
+			nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+
+			// Граница слова: "userId" -> user|Id, "IPAddress" -> IP|Address
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextIsLower) {
+				flush()
+			}
+		}
+
+		current = append(current, r)
+	}
+	flush()
+
+	return words
+}
+
+// containsWords проверяет, что pattern входит в words непрерывной последовательностью
+func containsWords(words, pattern []string) bool {
+	for i := 0; i+len(pattern) <= len(words); i++ {
+		match := true
+		for j := range pattern {
+			if words[i+j] != pattern[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
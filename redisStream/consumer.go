@@ -0,0 +1,449 @@
+package redisStream
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+
+	"pkg/errors"
+	"pkg/log"
+)
+
+// Поля, которые добавляются к сообщению в dead-letter стриме
+const (
+	FieldSourceStream = "_source_stream"
+	FieldSourceID     = "_source_id"
+	FieldGroup        = "_group"
+	FieldDeliveries   = "_deliveries"
+	FieldError        = "_error"
+)
+
+// Message - сообщение стрима
+type Message struct {
+	ID     string
+	Stream string
+	Values map[string]any
+
+	// Сколько раз сообщение выдавалось консьюмерам группы, включая текущую попытку
+	Deliveries int64
+}
+
+// Handler обрабатывает сообщение. Сообщение подтверждается, только если обработчик вернул nil,
+// иначе оно остается в pending и после ClaimMinIdle выдается повторно
+type Handler func(ctx context.Context, msg Message) error
+
+// ConsumerConfig - настройки Consumer
+type ConsumerConfig struct {
+	Stream string
+	Group  string
+
+	// Имя консьюмера в группе, по умолчанию hostname-pid
+	Consumer string
+
+	// С какого ID группа начинает читать стрим при создании, по умолчанию "0" - с начала
+	StartID string
+
+	// Количество сообщений, обрабатываемых одновременно, по умолчанию 1
+	Concurrency int
+
+	// Сколько сообщений забирать за один XREADGROUP, по умолчанию равно Concurrency
+	BatchSize int64
+
+	// Сколько ждать новые сообщения в XREADGROUP, по умолчанию 5 секунд
+	Block time.Duration
+
+	// Как часто забирать зависшие сообщения у упавших консьюмеров через XAUTOCLAIM, по умолчанию 30 секунд
+	ClaimInterval time.Duration
+
+	// Сколько сообщение должно пролежать в pending без подтверждения, чтобы его забрали, по умолчанию 1 минута
+	ClaimMinIdle time.Duration
+
+	// После скольких выдач сообщение переносится в DeadLetterStream, по умолчанию 5
+	MaxDeliveries int64
+
+	// Стрим для сообщений, которые не удалось обработать, по умолчанию <Stream>:dead
+	DeadLetterStream string
+
+	// Namespace метрик и реестр, в котором они регистрируются. Если реестр nil, используется глобальный
+	MetricsNamespace string
+	Registerer       prometheus.Registerer
+}
+
+// Consumer читает стрим в группе консьюмеров и обрабатывает сообщения в нескольких горутинах.
+// Доставка at-least-once: обработчик должен быть идемпотентным
+type Consumer struct {
+	client  redis.UniversalClient
+	cfg     ConsumerConfig
+	handler Handler
+	metrics *metrics
+}
+
+// NewConsumer создает Consumer. Группа создается при запуске Run, если ее нет
+func NewConsumer(client redis.UniversalClient, cfg ConsumerConfig, handler Handler) (*Consumer, error) {
+
+	if cfg.Stream == "" || cfg.Group == "" {
+		return nil, errors.Default.New("stream and group are required")
+	}
+	if cfg.Consumer == "" {
+		hostname, _ := os.Hostname()
+		cfg.Consumer = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+	if cfg.StartID == "" {
+		cfg.StartID = "0"
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = int64(cfg.Concurrency)
+	}
+	if cfg.Block <= 0 {
+		cfg.Block = 5 * time.Second
+	}
+	if cfg.ClaimInterval <= 0 {
+		cfg.ClaimInterval = 30 * time.Second
+	}
+	if cfg.ClaimMinIdle <= 0 {
+		cfg.ClaimMinIdle = time.Minute
+	}
+	if cfg.MaxDeliveries <= 0 {
+		cfg.MaxDeliveries = 5
+	}
+	if cfg.DeadLetterStream == "" {
+		cfg.DeadLetterStream = cfg.Stream + ":dead"
+	}
+
+	m, err := newMetrics(cfg.MetricsNamespace, cfg.Registerer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Consumer{
+		client:  client,
+		cfg:     cfg,
+		handler: handler,
+		metrics: m,
+	}, nil
+}
+
+// Run читает и обрабатывает сообщения, пока не отменен контекст. После отмены новые сообщения не читаются,
+// а уже выданные обработчикам дообрабатываются и подтверждаются. Блокирующее чтение может задержать остановку на Block.
+// Ошибки чтения логируются и не прерывают работу
+func (c *Consumer) Run(ctx context.Context) error {
+
+	if err := c.createGroup(ctx); err != nil {
+		return err
+	}
+
+	// Обработчики не получают отмену контекста, чтобы корректно завершить начатую работу
+	handleCtx := context.WithoutCancel(ctx)
+
+	jobs := make(chan Message)
+	var wg sync.WaitGroup
+	for range c.cfg.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for msg := range jobs {
+				c.handle(handleCtx, msg)
+			}
+		}()
+	}
+
+	c.consume(ctx, jobs)
+
+	close(jobs)
+	wg.Wait()
+
+	return nil
+}
+
+// consume читает новые сообщения и периодически забирает зависшие, отдавая их обработчикам через jobs
+func (c *Consumer) consume(ctx context.Context, jobs chan<- Message) {
+
+	// Первым делом забираем свои и чужие зависшие сообщения, оставшиеся с прошлого запуска
+	claimTimer := time.NewTimer(0)
+	defer claimTimer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-claimTimer.C:
+			if err := c.claim(ctx, jobs); err != nil && !errors.IsContextError(err) {
+				log.LogError(err)
+			}
+			claimTimer.Reset(c.cfg.ClaimInterval)
+		default:
+		}
+
+		msgs, err := c.read(ctx)
+		if err != nil {
+			if errors.IsContextError(err) || ctx.Err() != nil {
+				return
+			}
+			log.LogError(err)
+
+			// Не долбим Redis, если он недоступен
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		if !dispatch(ctx, jobs, msgs) {
+			return
+		}
+	}
+}
+
+// read читает новые сообщения группы
+func (c *Consumer) read(ctx context.Context) ([]Message, error) {
+
+	streams, err := c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    c.cfg.Group,
+		Consumer: c.cfg.Consumer,
+		Streams:  []string{c.cfg.Stream, ">"},
+		Count:    c.cfg.BatchSize,
+		Block:    c.cfg.Block,
+		NoAck:    false,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Default.Wrap(err).WithParams("stream", c.cfg.Stream, "group", c.cfg.Group)
+	}
+
+	var msgs []Message
+	for _, stream := range streams {
+		for _, xmsg := range stream.Messages {
+			msgs = append(msgs, Message{ID: xmsg.ID, Stream: stream.Stream, Values: xmsg.Values, Deliveries: 1})
+		}
+	}
+
+	return msgs, nil
+}
+
+// claim забирает сообщения, которые дольше ClaimMinIdle не подтверждены, и переносит в dead-letter стрим те,
+// у которых закончились попытки
+func (c *Consumer) claim(ctx context.Context, jobs chan<- Message) error {
+
+	start := "0-0"
+	for {
+		xmsgs, next, err := c.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   c.cfg.Stream,
+			Group:    c.cfg.Group,
+			MinIdle:  c.cfg.ClaimMinIdle,
+			Start:    start,
+			Count:    c.cfg.BatchSize,
+			Consumer: c.cfg.Consumer,
+		}).Result()
+		if err != nil {
+			return errors.Default.Wrap(err).WithParams("stream", c.cfg.Stream, "group", c.cfg.Group)
+		}
+
+		if len(xmsgs) > 0 {
+			c.metrics.claimed.WithLabelValues(c.cfg.Stream, c.cfg.Group).Add(float64(len(xmsgs)))
+
+			msgs, err := c.withDeliveries(ctx, xmsgs)
+			if err != nil {
+				return err
+			}
+
+			var alive []Message
+			for _, msg := range msgs {
+				if msg.Deliveries > c.cfg.MaxDeliveries {
+					if err = c.deadLetter(ctx, msg, "max deliveries exceeded"); err != nil {
+						return err
+					}
+					continue
+				}
+				alive = append(alive, msg)
+			}
+
+			if !dispatch(ctx, jobs, alive) {
+				return nil
+			}
+		}
+
+		// XAUTOCLAIM возвращает 0-0, когда просмотрен весь pending список
+		if next == "0-0" || next == "" {
+			break
+		}
+		start = next
+	}
+
+	return c.updatePending(ctx)
+}
+
+// withDeliveries дополняет забранные сообщения количеством выдач из XPENDING.
+// Каждое сообщение ищется по точному ID: в диапазоне между забранными могут быть другие сообщения консьюмера
+func (c *Consumer) withDeliveries(ctx context.Context, xmsgs []redis.XMessage) ([]Message, error) {
+
+	cmds := make([]*redis.XPendingExtCmd, len(xmsgs))
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, xmsg := range xmsgs {
+			cmds[i] = pipe.XPendingExt(ctx, &redis.XPendingExtArgs{
+				Stream:   c.cfg.Stream,
+				Group:    c.cfg.Group,
+				Idle:     0,
+				Start:    xmsg.ID,
+				End:      xmsg.ID,
+				Count:    1,
+				Consumer: c.cfg.Consumer,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Default.Wrap(err).WithParams("stream", c.cfg.Stream, "group", c.cfg.Group)
+	}
+
+	msgs := make([]Message, 0, len(xmsgs))
+	for i, xmsg := range xmsgs {
+
+		// Без количества выдач сообщение никогда не попадет в dead-letter, поэтому не обрабатываем его вслепую
+		pending := cmds[i].Val()
+		if len(pending) == 0 || pending[0].ID != xmsg.ID {
+			return nil, errors.Default.New("claimed message is not pending").WithParams("stream", c.cfg.Stream, "group", c.cfg.Group, "id", xmsg.ID)
+		}
+
+		msgs = append(msgs, Message{ID: xmsg.ID, Stream: c.cfg.Stream, Values: xmsg.Values, Deliveries: pending[0].RetryCount})
+	}
+
+	return msgs, nil
+}
+
+// handle вызывает обработчик и подтверждает сообщение при успехе
+func (c *Consumer) handle(ctx context.Context, msg Message) {
+
+	start := time.Now()
+	err := c.handler(ctx, msg)
+	c.metrics.handleDuration.WithLabelValues(c.cfg.Stream, c.cfg.Group).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		c.metrics.handled.WithLabelValues(c.cfg.Stream, c.cfg.Group, statusError).Inc()
+		log.LogError(errors.Default.Wrap(err).WithParams("stream", c.cfg.Stream, "group", c.cfg.Group, "id", msg.ID, "deliveries", msg.Deliveries))
+
+		// Последняя попытка - сразу в dead-letter, не дожидаясь XAUTOCLAIM
+		if msg.Deliveries >= c.cfg.MaxDeliveries {
+			if err = c.deadLetter(ctx, msg, err.Error()); err != nil {
+				log.LogError(err)
+			}
+		}
+		return
+	}
+
+	if err = c.client.XAck(ctx, c.cfg.Stream, c.cfg.Group, msg.ID).Err(); err != nil {
+		log.LogError(errors.Default.Wrap(err).WithParams("stream", c.cfg.Stream, "group", c.cfg.Group, "id", msg.ID))
+		return
+	}
+	c.metrics.handled.WithLabelValues(c.cfg.Stream, c.cfg.Group, statusOK).Inc()
+}
+
+// deadLetter переносит сообщение в dead-letter стрим и подтверждает его в исходном.
+// Без MULTI, так как в кластере стримы могут быть в разных слотах: при сбое между командами сообщение попадет в dead-letter дважды
+func (c *Consumer) deadLetter(ctx context.Context, msg Message, reason string) error {
+
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream:     c.cfg.DeadLetterStream,
+			NoMkStream: false,
+			MaxLen:     0,
+			MinID:      "",
+			Approx:     false,
+			Limit:      0,
+			ID:         "",
+			Values:     deadLetterValues(msg, c.cfg.Group, reason),
+		})
+		pipe.XAck(ctx, c.cfg.Stream, c.cfg.Group, msg.ID)
+		return nil
+	})
+	if err != nil {
+		return errors.Default.Wrap(err).WithParams("stream", c.cfg.Stream, "group", c.cfg.Group, "id", msg.ID)
+	}
+
+	c.metrics.handled.WithLabelValues(c.cfg.Stream, c.cfg.Group, statusDeadLetter).Inc()
+	log.WithParams("stream", c.cfg.Stream, "group", c.cfg.Group, "id", msg.ID, "deliveries", msg.Deliveries, "reason", reason).
+		Warning("redis stream message moved to dead letter stream")
+
+	return nil
+}
+
+// deadLetterValues - поля исходного сообщения и служебные поля о том, откуда и почему оно пришло
+func deadLetterValues(msg Message, group, reason string) map[string]any {
+	values := make(map[string]any, len(msg.Values)+5)
+	for key, value := range msg.Values {
+		values[key] = value
+	}
+	values[FieldSourceStream] = msg.Stream
+	values[FieldSourceID] = msg.ID
+	values[FieldGroup] = group
+	values[FieldDeliveries] = strconv.FormatInt(msg.Deliveries, 10)
+	values[FieldError] = reason
+	return values
+}
+
+func (c *Consumer) updatePending(ctx context.Context) error {
+
+	pending, err := c.client.XPending(ctx, c.cfg.Stream, c.cfg.Group).Result()
+	if err != nil {
+		return errors.Default.Wrap(err).WithParams("stream", c.cfg.Stream, "group", c.cfg.Group)
+	}
+	c.metrics.pending.WithLabelValues(c.cfg.Stream, c.cfg.Group).Set(float64(pending.Count))
+
+	return nil
+}
+
+// createGroup создает группу и стрим, если их нет
+func (c *Consumer) createGroup(ctx context.Context) error {
+
+	err := c.client.XGroupCreateMkStream(ctx, c.cfg.Stream, c.cfg.Group, c.cfg.StartID).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return errors.Default.Wrap(err).WithParams("stream", c.cfg.Stream, "group", c.cfg.Group)
+	}
+
+	return nil
+}
+
+// dispatch отдает сообщения обработчикам. Возвращает false, если контекст отменен и отдать все не удалось
+func dispatch(ctx context.Context, jobs chan<- Message, msgs []Message) bool {
+	for _, msg := range msgs {
+		select {
+		case <-ctx.Done():
+			return false
+		case jobs <- msg:
+		}
+	}
+	return true
+}
+
+// Publish добавляет сообщение в стрим. maxLen > 0 ограничивает длину стрима примерно этим значением
+func Publish(ctx context.Context, client redis.UniversalClient, stream string, values map[string]any, maxLen int64) (string, error) {
+
+	id, err := client.XAdd(ctx, &redis.XAddArgs{
+		Stream:     stream,
+		NoMkStream: false,
+		MaxLen:     maxLen,
+		MinID:      "",
+		Approx:     maxLen > 0,
+		Limit:      0,
+		ID:         "",
+		Values:     values,
+	}).Result()
+	if err != nil {
+		return "", errors.Default.Wrap(err).WithParams("stream", stream)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,227 @@
+package redisStream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pkg/errors"
+)
+
+func TestNewConsumer(t *testing.T) {
+
+	t.Run("1. Значения по умолчанию", func(t *testing.T) {
+		c, err := NewConsumer(nil, ConsumerConfig{Stream: "jobs", Group: "workers", Concurrency: 4, Registerer: prometheus.NewRegistry()}, nil)
+		require.NoError(t, err)
+
+		assert.NotEmpty(t, c.cfg.Consumer)
+		assert.Equal(t, "0", c.cfg.StartID)
+		assert.Equal(t, int64(4), c.cfg.BatchSize)
+		assert.Equal(t, time.Minute, c.cfg.ClaimMinIdle)
+		assert.Equal(t, int64(5), c.cfg.MaxDeliveries)
+		assert.Equal(t, "jobs:dead", c.cfg.DeadLetterStream)
+	})
+
+	t.Run("2. Без стрима", func(t *testing.T) {
+		_, err := NewConsumer(nil, ConsumerConfig{Group: "workers"}, nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestDeadLetterValues(t *testing.T) {
+
+	values := deadLetterValues(Message{ID: "1-0", Stream: "jobs", Values: map[string]any{"payload": "x"}, Deliveries: 5}, "workers", "boom")
+
+	assert.Equal(t, map[string]any{
+		"payload":         "x",
+		FieldSourceStream: "jobs",
+		FieldSourceID:     "1-0",
+		FieldGroup:        "workers",
+		FieldDeliveries:   "5",
+		FieldError:        "boom",
+	}, values)
+}
+
+func TestDispatch(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	jobs := make(chan Message, 1)
+
+	assert.True(t, dispatch(ctx, jobs, []Message{{ID: "1-0"}}))
+
+	// Канал занят, после отмены контекста dispatch не блокируется
+	cancel()
+	assert.False(t, dispatch(ctx, jobs, []Message{{ID: "2-0"}}))
+}
+
+// fakeClient - заглушка Redis, которая хранит pending список группы в памяти
+type fakeClient struct {
+	redis.UniversalClient
+
+	// Количество выдач сообщений, которые числятся в pending за консьюмером
+	pending map[string]int64
+
+	// Сообщения, которые вернет XAUTOCLAIM
+	claimed []redis.XMessage
+
+	acked []string
+	dead  []map[string]any
+}
+
+type fakePipeline struct {
+	redis.Pipeliner
+	client *fakeClient
+}
+
+func (c *fakeClient) Pipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error) {
+	return nil, fn(&fakePipeline{Pipeliner: nil, client: c})
+}
+
+func (c *fakeClient) XAutoClaim(ctx context.Context, _ *redis.XAutoClaimArgs) *redis.XAutoClaimCmd {
+	cmd := redis.NewXAutoClaimCmd(ctx)
+	cmd.SetVal(c.claimed, "0-0")
+	return cmd
+}
+
+func (c *fakeClient) XPendingExt(ctx context.Context, args *redis.XPendingExtArgs) *redis.XPendingExtCmd {
+	cmd := redis.NewXPendingExtCmd(ctx)
+	var pending []redis.XPendingExt
+	for id, retryCount := range c.pending {
+		if id >= args.Start && id <= args.End && int64(len(pending)) < args.Count {
+			pending = append(pending, redis.XPendingExt{ID: id, Consumer: args.Consumer, Idle: 0, RetryCount: retryCount})
+		}
+	}
+	cmd.SetVal(pending)
+	return cmd
+}
+
+func (c *fakeClient) XPending(ctx context.Context, _, _ string) *redis.XPendingCmd {
+	cmd := redis.NewXPendingCmd(ctx)
+	cmd.SetVal(&redis.XPending{Count: int64(len(c.pending)), Lower: "", Higher: "", Consumers: nil})
+	return cmd
+}
+
+func (c *fakeClient) XAck(ctx context.Context, _, _ string, ids ...string) *redis.IntCmd {
+	for _, id := range ids {
+		delete(c.pending, id)
+	}
+	c.acked = append(c.acked, ids...)
+	cmd := redis.NewIntCmd(ctx)
+	cmd.SetVal(int64(len(ids)))
+	return cmd
+}
+
+func (p *fakePipeline) XPendingExt(ctx context.Context, args *redis.XPendingExtArgs) *redis.XPendingExtCmd {
+	return p.client.XPendingExt(ctx, args)
+}
+
+func (p *fakePipeline) XAck(ctx context.Context, stream, group string, ids ...string) *redis.IntCmd {
+	return p.client.XAck(ctx, stream, group, ids...)
+}
+
+func (p *fakePipeline) XAdd(ctx context.Context, args *redis.XAddArgs) *redis.StringCmd {
+	values, _ := args.Values.(map[string]any)
+	p.client.dead = append(p.client.dead, values)
+	return redis.NewStringCmd(ctx)
+}
+
+func newTestConsumer(t *testing.T, client *fakeClient, handler Handler) *Consumer {
+	c, err := NewConsumer(client, ConsumerConfig{Stream: "jobs", Group: "workers", Consumer: "worker-1", Registerer: prometheus.NewRegistry()}, handler)
+	require.NoError(t, err)
+	return c
+}
+
+func TestConsumerHandle(t *testing.T) {
+
+	failing := func(context.Context, Message) error { return errors.Default.New("boom") }
+
+	tests := []struct {
+		name       string
+		handler    Handler
+		deliveries int64
+		wantAcked  []string
+		wantDead   int
+	}{
+		{
+			name:       "1. Успешно обработанное сообщение подтверждается",
+			handler:    func(context.Context, Message) error { return nil },
+			deliveries: 1,
+			wantAcked:  []string{"1-0"},
+			wantDead:   0,
+		},
+		{
+			name:       "2. Сообщение с ошибкой остается в pending",
+			handler:    failing,
+			deliveries: 1,
+			wantAcked:  nil,
+			wantDead:   0,
+		},
+		{
+			name:       "3. Ошибка на последней попытке переносит сообщение в dead-letter",
+			handler:    failing,
+			deliveries: 5,
+			wantAcked:  []string{"1-0"},
+			wantDead:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeClient{pending: map[string]int64{"1-0": tt.deliveries}}
+			c := newTestConsumer(t, client, tt.handler)
+
+			c.handle(context.Background(), Message{ID: "1-0", Stream: "jobs", Values: map[string]any{"payload": "x"}, Deliveries: tt.deliveries})
+
+			assert.Equal(t, tt.wantAcked, client.acked)
+			assert.Len(t, client.dead, tt.wantDead)
+		})
+	}
+}
+
+func TestConsumerClaim(t *testing.T) {
+
+	t.Run("1. Зависшие сообщения выдаются повторно, исчерпавшие попытки переносятся в dead-letter", func(t *testing.T) {
+
+		// 2-0 консьюмер еще обрабатывает, оно лежит между забранными и не должно мешать поиску их выдач
+		client := &fakeClient{
+			pending: map[string]int64{"1-0": 2, "2-0": 1, "3-0": 6},
+			claimed: []redis.XMessage{
+				{ID: "1-0", Values: map[string]any{"payload": "a"}},
+				{ID: "3-0", Values: map[string]any{"payload": "c"}},
+			},
+		}
+		c := newTestConsumer(t, client, nil)
+
+		jobs := make(chan Message, 2)
+		require.NoError(t, c.claim(context.Background(), jobs))
+		close(jobs)
+
+		var reclaimed []Message
+		for msg := range jobs {
+			reclaimed = append(reclaimed, msg)
+		}
+		require.Len(t, reclaimed, 1)
+		assert.Equal(t, "1-0", reclaimed[0].ID)
+		assert.Equal(t, int64(2), reclaimed[0].Deliveries)
+
+		require.Len(t, client.dead, 1)
+		assert.Equal(t, "3-0", client.dead[0][FieldSourceID])
+		assert.Equal(t, "6", client.dead[0][FieldDeliveries])
+		assert.Equal(t, []string{"3-0"}, client.acked)
+	})
+
+	t.Run("2. Забранного сообщения нет в pending", func(t *testing.T) {
+		client := &fakeClient{
+			pending: map[string]int64{},
+			claimed: []redis.XMessage{{ID: "1-0", Values: nil}},
+		}
+		c := newTestConsumer(t, client, nil)
+
+		err := c.claim(context.Background(), make(chan Message, 1))
+		assert.Error(t, err)
+	})
+}
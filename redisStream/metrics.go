@@ -0,0 +1,78 @@
+package redisStream
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pkg/promUtils"
+)
+
+// Статусы обработки сообщения в метриках
+const (
+	statusOK         = "ok"
+	statusError      = "error"
+	statusDeadLetter = "dead_letter"
+)
+
+// metrics - метрики Consumer
+type metrics struct {
+	handled        *prometheus.CounterVec
+	handleDuration *prometheus.HistogramVec
+	claimed        *prometheus.CounterVec
+	pending        *prometheus.GaugeVec
+}
+
+func newMetrics(namespace string, registerer prometheus.Registerer) (*metrics, error) {
+
+	m := &metrics{
+		handled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   "redis_stream",
+			Name:        "messages_handled_total",
+			Help:        "Total number of redis stream messages handled by consumers.",
+			ConstLabels: nil,
+		}, []string{"stream", "group", "status"}),
+		handleDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:                       namespace,
+			Subsystem:                       "redis_stream",
+			Name:                            "handle_duration_seconds",
+			Help:                            "A histogram of the duration (seconds) of redis stream message handlers.",
+			ConstLabels:                     nil,
+			Buckets:                         prometheus.DefBuckets,
+			NativeHistogramBucketFactor:     0,
+			NativeHistogramZeroThreshold:    0,
+			NativeHistogramMaxBucketNumber:  0,
+			NativeHistogramMinResetDuration: 0,
+			NativeHistogramMaxZeroThreshold: 0,
+		}, []string{"stream", "group"}),
+		claimed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   "redis_stream",
+			Name:        "messages_claimed_total",
+			Help:        "Total number of pending redis stream messages reclaimed from idle consumers.",
+			ConstLabels: nil,
+		}, []string{"stream", "group"}),
+		pending: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   "redis_stream",
+			Name:        "pending_messages",
+			Help:        "Number of redis stream messages delivered to the group but not acknowledged.",
+			ConstLabels: nil,
+		}, []string{"stream", "group"}),
+	}
+
+	var err error
+	if m.handled, err = promUtils.Register(registerer, m.handled); err != nil {
+		return nil, err
+	}
+	if m.handleDuration, err = promUtils.Register(registerer, m.handleDuration); err != nil {
+		return nil, err
+	}
+	if m.claimed, err = promUtils.Register(registerer, m.claimed); err != nil {
+		return nil, err
+	}
+	if m.pending, err = promUtils.Register(registerer, m.pending); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
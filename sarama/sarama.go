@@ -73,6 +73,14 @@ type KafkaSettingsEnv struct {
 }
 
 func NewClient(conf KafkaSettingsEnv) (sarama.Client, error) {
+	client, err := sarama.NewClient(conf.Addrs, newConfig(conf))
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+func newConfig(conf KafkaSettingsEnv) *sarama.Config {
 	config := sarama.NewConfig()
 	config.Version = sarama.MaxVersion
 	config.Metadata.AllowAutoTopicCreation = true
@@ -81,12 +89,7 @@ func NewClient(conf KafkaSettingsEnv) (sarama.Client, error) {
 	config.Net.SASL.Enable = conf.Auth
 	config.Net.SASL.User = conf.User
 	config.Net.SASL.Password = conf.Pass
-
-	client, err := sarama.NewClient(conf.Addrs, config)
-	if err != nil {
-		return nil, err
-	}
-	return client, nil
+	return config
 }
 
 func NewAsyncProducer(conf KafkaSettingsEnv) (sarama.AsyncProducer, error) {
@@ -103,3 +106,20 @@ func NewAsyncProducer(conf KafkaSettingsEnv) (sarama.AsyncProducer, error) {
 
 	return producerKafka, nil
 }
+
+// NewSyncProducer создает синхронный продюсер, который дожидается подтверждения записи от всех реплик.
+// Одновременно отправляется только один запрос к брокеру, чтобы повторы не меняли порядок сообщений в партиции
+func NewSyncProducer(conf KafkaSettingsEnv) (sarama.SyncProducer, error) {
+
+	config := newConfig(conf)
+	config.Producer.Return.Successes = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Net.MaxOpenRequests = 1
+
+	producerKafka, err := sarama.NewSyncProducer(conf.Addrs, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return producerKafka, nil
+}
@@ -0,0 +1,364 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+
+	"pkg/errors"
+)
+
+// Названия драйверов, для которых есть быстрая вставка
+const (
+	driverPgx        = "pgx"
+	driverClickhouse = "clickhouse"
+)
+
+const (
+	// defaultBulkChunkSize - размер пачки по умолчанию
+	defaultBulkChunkSize = 1000
+
+	// maxPgParams - максимальное количество плейсхолдеров в одном запросе Postgres
+	maxPgParams = 65535
+)
+
+// Upsert - настройки ON CONFLICT для вставки в Postgres
+type Upsert struct {
+
+	// Колонки уникального индекса, по которому определяется конфликт
+	ConflictColumns []string
+
+	// Колонки, которые обновляются при конфликте. Если не заданы, обновляются все колонки, кроме ConflictColumns
+	UpdateColumns []string
+
+	// Не обновлять строку при конфликте (ON CONFLICT DO NOTHING)
+	DoNothing bool
+}
+
+// suffix формирует ON CONFLICT часть запроса для колонок вставки columns
+func (u Upsert) suffix(columns []string) (string, error) {
+
+	if len(u.ConflictColumns) == 0 {
+		return "", errors.Default.New("upsert conflict columns are empty")
+	}
+
+	conflict := fmt.Sprintf("ON CONFLICT (%s)", strings.Join(u.ConflictColumns, ", "))
+
+	if u.DoNothing {
+		return conflict + " DO NOTHING", nil
+	}
+
+	updateColumns := u.UpdateColumns
+	if len(updateColumns) == 0 {
+		for _, column := range columns {
+			if !slices.Contains(u.ConflictColumns, column) {
+				updateColumns = append(updateColumns, column)
+			}
+		}
+	}
+
+	if len(updateColumns) == 0 {
+		return conflict + " DO NOTHING", nil
+	}
+
+	set := make([]string, 0, len(updateColumns))
+	for _, column := range updateColumns {
+		set = append(set, fmt.Sprintf("%s = EXCLUDED.%s", column, column))
+	}
+
+	return conflict + " DO UPDATE SET " + strings.Join(set, ", "), nil
+}
+
+// BulkOptions - настройки массовой вставки
+type BulkOptions struct {
+
+	// Количество строк в одной пачке, по умолчанию 1000
+	ChunkSize int
+
+	// Настройки ON CONFLICT. Если заданы, вместо COPY используется INSERT ... ON CONFLICT
+	Upsert *Upsert
+
+	// Продолжать вставку следующих пачек после ошибки. Внутри транзакции игнорируется,
+	// так как после ошибки транзакция Postgres непригодна для дальнейших запросов
+	ContinueOnError bool
+}
+
+// ChunkError - ошибка вставки одной пачки
+type ChunkError struct {
+
+	// Индекс первой строки пачки в исходном слайсе и количество строк в пачке
+	Offset int
+	Count  int
+
+	Err error
+}
+
+// BulkResult - результат массовой вставки
+type BulkResult struct {
+
+	// Количество вставленных или обновленных строк
+	RowsAffected int64
+
+	// Пачки, которые не удалось вставить
+	Failed []ChunkError
+}
+
+// BulkInsert вставляет rows в таблицу table пачками. Колонки берутся из тегов db структуры T.
+//
+// Для Postgres без Upsert используется COPY FROM, а внутри транзакции из контекста - многострочный INSERT,
+// так как COPY требует соединения, которое database/sql не отдает из транзакции.
+// Для ClickHouse используется нативная пакетная вставка, Upsert не поддерживается.
+//
+// Если часть пачек не вставилась, возвращается ошибка, а в BulkResult.Failed - список неудачных пачек
+func BulkInsert[T any](ctx context.Context, db *DB, table string, rows []T, opts BulkOptions) (BulkResult, error) {
+
+	result := BulkResult{RowsAffected: 0, Failed: nil}
+
+	if len(rows) == 0 {
+		return result, nil
+	}
+
+	columns, err := structColumns(reflect.TypeFor[T]())
+	if err != nil {
+		return result, err
+	}
+
+	driverName := db.DB.DriverName()
+	inTx := ExtractTx(ctx) != nil
+
+	if driverName == driverClickhouse && opts.Upsert != nil {
+		return result, errors.Default.New("upsert is not supported for clickhouse")
+	}
+
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultBulkChunkSize
+	}
+
+	// Определяем способ вставки
+	var insertChunk func(ctx context.Context, chunk []T) (int64, error)
+	switch {
+	case driverName == driverPgx && opts.Upsert == nil && !inTx:
+		insertChunk = func(ctx context.Context, chunk []T) (int64, error) {
+			return db.copyFrom(ctx, table, columns, structValues(chunk))
+		}
+	case driverName == driverClickhouse:
+		insertChunk = func(ctx context.Context, chunk []T) (int64, error) {
+			return db.batchInsert(ctx, table, columns, structValues(chunk))
+		}
+	default:
+		// Многострочный INSERT ограничен количеством плейсхолдеров
+		chunkSize = min(chunkSize, maxPgParams/len(columns))
+		insertChunk = func(ctx context.Context, chunk []T) (int64, error) {
+			q, err := InsertBuilder(table, chunk, opts.Upsert)
+			if err != nil {
+				return 0, err
+			}
+			affected, err := db.ExecWithRowsAffected(ctx, q)
+			return int64(affected), err
+		}
+	}
+
+	for offset := 0; offset < len(rows); offset += chunkSize {
+
+		chunk := rows[offset:min(offset+chunkSize, len(rows))]
+
+		affected, err := insertChunk(ctx, chunk)
+		if err != nil {
+			result.Failed = append(result.Failed, ChunkError{Offset: offset, Count: len(chunk), Err: err})
+			if !opts.ContinueOnError || inTx {
+				break
+			}
+			continue
+		}
+
+		result.RowsAffected += affected
+	}
+
+	if len(result.Failed) != 0 {
+		return result, errors.Default.Wrap(result.Failed[0].Err).WithParams(
+			"table", table,
+			"failedChunks", len(result.Failed),
+			"rowsAffected", result.RowsAffected,
+		)
+	}
+
+	return result, nil
+}
+
+// InsertBuilder формирует многострочный INSERT для rows с колонками из тегов db структуры T.
+// Если upsert не nil, добавляется ON CONFLICT
+func InsertBuilder[T any](table string, rows []T, upsert *Upsert) (sq.InsertBuilder, error) {
+
+	columns, err := structColumns(reflect.TypeFor[T]())
+	if err != nil {
+		return sq.InsertBuilder{}, err
+	}
+
+	q := sq.Insert(table).Columns(columns...)
+	for _, values := range structValues(rows) {
+		q = q.Values(values...)
+	}
+
+	if upsert != nil {
+		suffix, err := upsert.suffix(columns)
+		if err != nil {
+			return q, err
+		}
+		q = q.Suffix(suffix)
+	}
+
+	return q, nil
+}
+
+// copyFrom вставляет строки через COPY FROM на отдельном соединении pgx
+func (s *DB) copyFrom(ctx context.Context, table string, columns []string, rows [][]any) (affected int64, err error) {
+
+	query := fmt.Sprintf("COPY %s (%s) FROM STDIN", table, strings.Join(columns, ", "))
+
+	// Вызываем хуки перед выполнением запроса
+	ctx, event := s.beforeQuery(ctx, MethodCopyFrom, query, nil)
+	defer func() {
+		// Вызываем хуки после выполнения запроса
+		s.afterQuery(event, affected, err)
+	}()
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return 0, wrapSQLError(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	err = conn.Raw(func(driverConn any) error {
+		stdlibConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return errors.Default.New("connection is not pgx").WithParams("type", fmt.Sprintf("%T", driverConn))
+		}
+
+		affected, err = stdlibConn.Conn().CopyFrom(ctx, pgx.Identifier(strings.Split(table, ".")), columns, pgx.CopyFromRows(rows))
+		return err
+	})
+	if err != nil {
+		return 0, wrapSQLError(err)
+	}
+
+	return affected, nil
+}
+
+// batchInsert вставляет строки нативной пакетной вставкой ClickHouse.
+// Драйвер clickhouse-go собирает строки, добавленные через подготовленный запрос в транзакции, в один блок
+func (s *DB) batchInsert(ctx context.Context, table string, columns []string, rows [][]any) (affected int64, err error) {
+
+	query := fmt.Sprintf("INSERT INTO %s (%s)", table, strings.Join(columns, ", "))
+
+	// Вызываем хуки перед выполнением запроса
+	ctx, event := s.beforeQuery(ctx, MethodBatchInsert, query, nil)
+	defer func() {
+		// Вызываем хуки после выполнения запроса
+		s.afterQuery(event, affected, err)
+	}()
+
+	batch, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, wrapSQLError(err)
+	}
+	defer func() {
+		if err != nil {
+			_ = batch.Rollback()
+		}
+	}()
+
+	stmt, err := batch.PrepareContext(ctx, query)
+	if err != nil {
+		return 0, wrapSQLError(err)
+	}
+	defer func() { _ = stmt.Close() }()
+
+	for _, values := range rows {
+		if _, err = stmt.ExecContext(ctx, values...); err != nil {
+			return 0, wrapSQLError(err)
+		}
+	}
+
+	// Отправляем блок на сервер
+	if err = batch.Commit(); err != nil {
+		return 0, wrapSQLError(err)
+	}
+
+	return int64(len(rows)), nil
+}
+
+// structColumns возвращает названия колонок из тегов db структуры.
+// Поля без тега и с тегом "-" пропускаются, встроенные структуры без тега раскрываются
+func structColumns(t reflect.Type) ([]string, error) {
+
+	if t.Kind() != reflect.Struct {
+		return nil, errors.Default.New("bulk insert row must be a struct").WithParams("type", t.String())
+	}
+
+	var columns []string
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := columnTag(field)
+
+		if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct && !isScannable(field.Type) {
+			embedded, err := structColumns(field.Type)
+			if err != nil {
+				return nil, err
+			}
+			columns = append(columns, embedded...)
+			continue
+		}
+
+		if tag == "" || tag == "-" || !field.IsExported() {
+			continue
+		}
+		columns = append(columns, tag)
+	}
+
+	if len(columns) == 0 {
+		return nil, errors.Default.New("struct has no db tags").WithParams("type", t.String())
+	}
+
+	return columns, nil
+}
+
+// structValues возвращает значения полей с тегами db для каждой строки в порядке structColumns
+func structValues[T any](rows []T) [][]any {
+	res := make([][]any, 0, len(rows))
+	for _, row := range rows {
+		res = append(res, appendStructValues(nil, reflect.ValueOf(row)))
+	}
+	return res
+}
+
+func appendStructValues(values []any, v reflect.Value) []any {
+	t := v.Type()
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := columnTag(field)
+
+		if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct && !isScannable(field.Type) {
+			values = appendStructValues(values, v.Field(i))
+			continue
+		}
+
+		if tag == "" || tag == "-" || !field.IsExported() {
+			continue
+		}
+		values = append(values, v.Field(i).Interface())
+	}
+	return values
+}
+
+// columnTag возвращает название колонки из тега db без опций
+func columnTag(field reflect.StructField) string {
+	tag, _, _ := strings.Cut(field.Tag.Get("db"), ",")
+	return tag
+}
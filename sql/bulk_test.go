@@ -0,0 +1,73 @@
+package sql
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type bulkBase struct {
+	ID int `db:"id"`
+}
+
+type bulkRow struct {
+	bulkBase
+	Name      string    `db:"name"`
+	Email     string    `db:"email,omitempty"`
+	CreatedAt time.Time `db:"created_at"`
+	Ignored   string    `db:"-"`
+	NoTag     string
+}
+
+func TestInsertBuilder(t *testing.T) {
+
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rows := []bulkRow{
+		{bulkBase: bulkBase{ID: 1}, Name: "a", Email: "a@a", CreatedAt: createdAt, Ignored: "x", NoTag: "y"},
+		{bulkBase: bulkBase{ID: 2}, Name: "b", Email: "b@b", CreatedAt: createdAt, Ignored: "x", NoTag: "y"},
+	}
+
+	tests := []struct {
+		name      string
+		upsert    *Upsert
+		wantQuery string
+	}{
+		{
+			name:      "1. Обычная вставка",
+			upsert:    nil,
+			wantQuery: "INSERT INTO users (id,name,email,created_at) VALUES (?,?,?,?),(?,?,?,?)",
+		},
+		{
+			name:      "2. Обновление всех колонок кроме ключа",
+			upsert:    &Upsert{ConflictColumns: []string{"id"}, UpdateColumns: nil, DoNothing: false},
+			wantQuery: "INSERT INTO users (id,name,email,created_at) VALUES (?,?,?,?),(?,?,?,?) ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, email = EXCLUDED.email, created_at = EXCLUDED.created_at",
+		},
+		{
+			name:      "3. Пропуск конфликтующих строк",
+			upsert:    &Upsert{ConflictColumns: []string{"email"}, UpdateColumns: nil, DoNothing: true},
+			wantQuery: "INSERT INTO users (id,name,email,created_at) VALUES (?,?,?,?),(?,?,?,?) ON CONFLICT (email) DO NOTHING",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			q, err := InsertBuilder("users", rows, tt.upsert)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			query, args, err := q.ToSql()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if query != tt.wantQuery {
+				t.Errorf("query = %s, want %s", query, tt.wantQuery)
+			}
+
+			wantArgs := []any{1, "a", "a@a", createdAt, 2, "b", "b@b", createdAt}
+			if !reflect.DeepEqual(args, wantArgs) {
+				t.Errorf("args = %v, want %v", args, wantArgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package sql
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+
+	"pkg/errors"
+	"pkg/log"
+)
+
+var _ SQL = new(ClusterDB)
+
+// RoutingPolicy - способ выбора реплики для чтения
+type RoutingPolicy int
+
+const (
+	// RoundRobin - реплики выбираются по очереди
+	RoundRobin RoutingPolicy = iota
+
+	// LeastLatency - выбирается реплика с наименьшим временем ответа на проверку здоровья
+	LeastLatency
+)
+
+// replicationLagQuery возвращает отставание реплики в секундах.
+// Если реплика применила все полученные изменения, отставание считается нулевым,
+// иначе при отсутствии записей на мастере pg_last_xact_replay_timestamp перестает обновляться и отставание растет
+const replicationLagQuery = `SELECT CASE
+	WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+END`
+
+// ClusterConfig - настройки ClusterDB
+type ClusterConfig struct {
+
+	// Способ выбора реплики для чтения
+	Policy RoutingPolicy
+
+	// Период проверки здоровья реплик, по умолчанию 5 секунд
+	HealthCheckInterval time.Duration
+
+	// Максимально допустимое отставание реплики, по умолчанию 10 секунд
+	MaxReplicationLag time.Duration
+}
+
+// ClusterDB - подключение к мастеру и репликам Postgres с тем же интерфейсом SQL, что и DB.
+// Чтение (Select, Get, Query, QueryRow) идет на здоровые реплики, если в контексте нет транзакции
+// и контекст не помечен через WithReadYourWrites. Запись и транзакции идут на мастер.
+// Если здоровых реплик нет, чтение тоже идет на мастер
+type ClusterDB struct {
+	primary  *DB
+	replicas []*replica
+	cfg      ClusterConfig
+
+	// Счетчик для RoundRobin
+	next atomic.Uint64
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// replica - реплика и результат ее последней проверки здоровья
+type replica struct {
+	db      *DB
+	healthy atomic.Bool
+	latency atomic.Int64
+}
+
+// NewClusterDB создает ClusterDB, синхронно проверяет реплики и запускает фоновую проверку здоровья
+func NewClusterDB(ctx context.Context, primary *DB, replicas []*DB, cfg ClusterConfig) *ClusterDB {
+
+	if cfg.HealthCheckInterval <= 0 {
+		cfg.HealthCheckInterval = 5 * time.Second
+	}
+	if cfg.MaxReplicationLag <= 0 {
+		cfg.MaxReplicationLag = 10 * time.Second
+	}
+
+	c := &ClusterDB{
+		primary:   primary,
+		replicas:  make([]*replica, 0, len(replicas)),
+		cfg:       cfg,
+		next:      atomic.Uint64{},
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+		closeOnce: sync.Once{},
+	}
+	for _, db := range replicas {
+		c.replicas = append(c.replicas, &replica{db: db, healthy: atomic.Bool{}, latency: atomic.Int64{}})
+	}
+
+	c.checkReplicas(ctx)
+	go c.healthCheckLoop()
+
+	return c
+}
+
+type readYourWritesKey struct{}
+
+// WithReadYourWrites помечает контекст, чтобы чтение шло на мастер.
+// Используется после записи, когда нужно сразу прочитать записанное, не дожидаясь репликации
+func WithReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readYourWritesKey{}, true)
+}
+
+// Primary возвращает подключение к мастеру
+func (c *ClusterDB) Primary() *DB {
+	return c.primary
+}
+
+// reader выбирает подключение для чтения
+func (c *ClusterDB) reader(ctx context.Context) *DB {
+
+	// Транзакция открыта на мастере, поэтому читаем оттуда же
+	if ExtractTx(ctx) != nil {
+		return c.primary
+	}
+	if readYourWrites, _ := ctx.Value(readYourWritesKey{}).(bool); readYourWrites {
+		return c.primary
+	}
+
+	var (
+		healthy []*replica
+		fastest *replica
+	)
+	for _, r := range c.replicas {
+		if !r.healthy.Load() {
+			continue
+		}
+		healthy = append(healthy, r)
+		if fastest == nil || r.latency.Load() < fastest.latency.Load() {
+			fastest = r
+		}
+	}
+
+	if len(healthy) == 0 {
+		return c.primary
+	}
+
+	if c.cfg.Policy == LeastLatency {
+		return fastest.db
+	}
+
+	return healthy[c.next.Add(1)%uint64(len(healthy))].db
+}
+
+func (c *ClusterDB) healthCheckLoop() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.cfg.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), c.cfg.HealthCheckInterval)
+			c.checkReplicas(ctx)
+			cancel()
+		}
+	}
+}
+
+// checkReplicas проверяет все реплики параллельно
+func (c *ClusterDB) checkReplicas(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i, r := range c.replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.checkReplica(ctx, i, r)
+		}()
+	}
+	wg.Wait()
+}
+
+// checkReplica запрашивает отставание реплики и обновляет ее состояние
+func (c *ClusterDB) checkReplica(ctx context.Context, index int, r *replica) {
+
+	start := time.Now()
+
+	var lagSeconds float64
+	err := r.db.DB.QueryRowxContext(ctx, replicationLagQuery).Scan(&lagSeconds)
+
+	latency := time.Since(start)
+	lag := time.Duration(lagSeconds * float64(time.Second))
+	healthy := err == nil && lag <= c.cfg.MaxReplicationLag
+
+	r.latency.Store(int64(latency))
+
+	// Логируем только изменение состояния, чтобы не засорять логи
+	if wasHealthy := r.healthy.Swap(healthy); wasHealthy == healthy {
+		return
+	}
+
+	logger := log.WithParams("replica", index, "lag", lag.String(), "latency", latency.String())
+	switch {
+	case healthy:
+		logger.Info("sql replica is healthy")
+	case err != nil:
+		logger.WithParams("error", err.Error()).Warning("sql replica is unavailable")
+	default:
+		logger.Warning("sql replica is lagging")
+	}
+}
+
+// Unsafe возвращает Unsafe подключение к мастеру. Для Unsafe чтения с реплик ClusterDB нужно создавать над Unsafe подключениями
+func (c *ClusterDB) Unsafe() *DB {
+	return c.primary.Unsafe()
+}
+
+func (c *ClusterDB) Begin(ctx context.Context) (*Tx, error) {
+	return c.primary.Begin(ctx)
+}
+
+func (c *ClusterDB) InTx(ctx context.Context, opts *TxOptions, fn func(ctx context.Context) error) error {
+	return c.primary.InTx(ctx, opts, fn)
+}
+
+func (c *ClusterDB) Ping(ctx context.Context) error {
+	return c.primary.Ping(ctx)
+}
+
+func (c *ClusterDB) Get(ctx context.Context, dest any, q sq.Sqlizer) error {
+	return c.reader(ctx).Get(ctx, dest, q)
+}
+
+func (c *ClusterDB) Select(ctx context.Context, dest any, q sq.Sqlizer) error {
+	return c.reader(ctx).Select(ctx, dest, q)
+}
+
+func (c *ClusterDB) Query(ctx context.Context, q sq.Sqlizer) (*Rows, error) {
+	return c.reader(ctx).Query(ctx, q)
+}
+
+func (c *ClusterDB) QueryRow(ctx context.Context, q sq.Sqlizer) (*Row, error) {
+	return c.reader(ctx).QueryRow(ctx, q)
+}
+
+func (c *ClusterDB) Exec(ctx context.Context, q sq.Sqlizer) error {
+	return c.primary.Exec(ctx, q)
+}
+
+func (c *ClusterDB) ExecWithLastInsertID(ctx context.Context, q sq.Sqlizer) (uint32, error) {
+	return c.primary.ExecWithLastInsertID(ctx, q)
+}
+
+func (c *ClusterDB) ExecWithRowsAffected(ctx context.Context, q sq.Sqlizer) (uint32, error) {
+	return c.primary.ExecWithRowsAffected(ctx, q)
+}
+
+func (c *ClusterDB) Prepare(ctx context.Context, q sq.Sqlizer) (*Stmt, error) {
+	return c.primary.Prepare(ctx, q)
+}
+
+// Close останавливает проверку здоровья и закрывает все подключения
+func (c *ClusterDB) Close() error {
+
+	c.closeOnce.Do(func() {
+		close(c.stop)
+		<-c.done
+	})
+
+	var firstErr error
+	for _, db := range append([]*DB{c.primary}, c.replicaDBs()...) {
+		if err := db.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return errors.Default.Wrap(firstErr)
+	}
+
+	return nil
+}
+
+func (c *ClusterDB) replicaDBs() []*DB {
+	dbs := make([]*DB, 0, len(c.replicas))
+	for _, r := range c.replicas {
+		dbs = append(dbs, r.db)
+	}
+	return dbs
+}
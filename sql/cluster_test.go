@@ -0,0 +1,66 @@
+package sql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestClusterDB_reader(t *testing.T) {
+
+	primary := &DB{DB: nil, hooks: nil, stmts: nil}
+	first := &DB{DB: nil, hooks: nil, stmts: nil}
+	second := &DB{DB: nil, hooks: nil, stmts: nil}
+
+	newCluster := func(policy RoutingPolicy) *ClusterDB {
+		c := &ClusterDB{
+			primary:  primary,
+			replicas: []*replica{{db: first}, {db: second}},
+			cfg:      ClusterConfig{Policy: policy, HealthCheckInterval: time.Second, MaxReplicationLag: time.Second},
+		}
+		for _, r := range c.replicas {
+			r.healthy.Store(true)
+		}
+		return c
+	}
+
+	ctx := context.Background()
+
+	t.Run("1. Round-robin чередует реплики", func(t *testing.T) {
+		c := newCluster(RoundRobin)
+		if a, b := c.reader(ctx), c.reader(ctx); a == b || a == primary || b == primary {
+			t.Errorf("Ожидались разные реплики")
+		}
+	})
+
+	t.Run("2. Least-latency выбирает самую быструю реплику", func(t *testing.T) {
+		c := newCluster(LeastLatency)
+		c.replicas[0].latency.Store(int64(10 * time.Millisecond))
+		c.replicas[1].latency.Store(int64(time.Millisecond))
+		if got := c.reader(ctx); got != second {
+			t.Errorf("Ожидалась вторая реплика")
+		}
+	})
+
+	t.Run("3. Транзакция и read-your-writes идут на мастер", func(t *testing.T) {
+		c := newCluster(RoundRobin)
+		if got := c.reader(WithReadYourWrites(ctx)); got != primary {
+			t.Errorf("read-your-writes: ожидался мастер")
+		}
+		if got := c.reader(InjectTx(ctx, &Tx{Tx: new(sqlx.Tx), savepoints: 0})); got != primary {
+			t.Errorf("tx: ожидался мастер")
+		}
+	})
+
+	t.Run("4. Без здоровых реплик чтение идет на мастер", func(t *testing.T) {
+		c := newCluster(RoundRobin)
+		for _, r := range c.replicas {
+			r.healthy.Store(false)
+		}
+		if got := c.reader(ctx); got != primary {
+			t.Errorf("Ожидался мастер")
+		}
+	})
+}
@@ -10,7 +10,7 @@ import (
 	"pkg/errors"
 )
 
-var _ SQL = &DB{DB: nil}
+var _ SQL = &DB{DB: nil, hooks: nil, stmts: nil}
 
 type SQL interface {
 	Unsafe() *DB
@@ -24,11 +24,18 @@ type SQL interface {
 	ExecWithLastInsertID(ctx context.Context, q sq.Sqlizer) (uint32, error)
 	ExecWithRowsAffected(ctx context.Context, q sq.Sqlizer) (uint32, error)
 	Prepare(ctx context.Context, q sq.Sqlizer) (*Stmt, error)
+	InTx(ctx context.Context, opts *TxOptions, fn func(ctx context.Context) error) error
 	closer
 }
 
 type DB struct {
 	DB *sqlx.DB
+
+	// Перехватчики запросов, добавляются через AddHooks
+	hooks []Hook
+
+	// Кэш подготовленных запросов, nil если кэш отключен
+	stmts *stmtCache
 }
 
 func Open(driverName string, url string) (*DB, error) {
@@ -36,10 +43,18 @@ func Open(driverName string, url string) (*DB, error) {
 	if err != nil {
 		return nil, wrapSQLError(err)
 	}
-	return &DB{db}, nil
+	return &DB{DB: db, hooks: nil, stmts: newStmtCache(defaultStmtCacheSize)}, nil
+}
+
+// NewDB оборачивает уже открытое подключение database/sql, например из clickhouse.OpenDB
+func NewDB(db *sql.DB, driverName string) *DB {
+	return &DB{DB: sqlx.NewDb(db, driverName), hooks: nil, stmts: newStmtCache(defaultStmtCacheSize)}
 }
 
 func (s *DB) Close() error {
+	if s.stmts != nil {
+		s.stmts.purge()
+	}
 	if err := s.DB.Close(); err != nil {
 		return wrapSQLError(err)
 	}
@@ -51,7 +66,7 @@ func (s *DB) Begin(ctx context.Context) (*Tx, error) {
 	if err != nil {
 		return nil, wrapSQLError(err)
 	}
-	return &Tx{tx}, nil
+	return newTx(tx, s.stmtCacheSize()), nil
 }
 
 func (s *DB) Ping(ctx context.Context) error {
@@ -62,7 +77,12 @@ func (s *DB) Ping(ctx context.Context) error {
 }
 
 func (s *DB) Unsafe() *DB {
-	return &DB{s.DB.Unsafe()}
+	// Запросы sqlx.Stmt помнят режим Unsafe, поэтому у Unsafe подключения свой кэш
+	var stmts *stmtCache
+	if s.stmts != nil {
+		stmts = newStmtCache(s.stmts.capacity)
+	}
+	return &DB{DB: s.DB.Unsafe(), hooks: s.hooks, stmts: stmts}
 }
 
 func (s *DB) Select(ctx context.Context, dest any, q sq.Sqlizer) (err error) {
@@ -73,6 +93,9 @@ func (s *DB) Select(ctx context.Context, dest any, q sq.Sqlizer) (err error) {
 		return errors.Default.Wrap(err)
 	}
 
+	// Вызываем хуки перед выполнением запроса
+	ctx, event := s.beforeQuery(ctx, MethodSelect, query, args)
+
 	// Извлекаем транзакцию из контекста
 	if tx := ExtractTx(ctx); tx != nil {
 
@@ -84,6 +107,9 @@ func (s *DB) Select(ctx context.Context, dest any, q sq.Sqlizer) (err error) {
 		err = s.DB.SelectContext(ctx, dest, query, args...)
 	}
 
+	// Вызываем хуки после выполнения запроса
+	s.afterQuery(event, destLen(dest), err)
+
 	// Обрабатываем ошибки
 	if err != nil {
 		return wrapSQLError(err)
@@ -100,6 +126,9 @@ func (s *DB) Get(ctx context.Context, dest any, q sq.Sqlizer) (err error) {
 		return errors.Default.Wrap(err)
 	}
 
+	// Вызываем хуки перед выполнением запроса
+	ctx, event := s.beforeQuery(ctx, MethodGet, query, args)
+
 	// Извлекаем транзакцию из контекста
 	if tx := ExtractTx(ctx); tx != nil {
 
@@ -111,6 +140,9 @@ func (s *DB) Get(ctx context.Context, dest any, q sq.Sqlizer) (err error) {
 		err = s.DB.GetContext(ctx, dest, query, args...)
 	}
 
+	// Вызываем хуки после выполнения запроса
+	s.afterQuery(event, rowsFound(err), err)
+
 	// Обрабатываем ошибки
 	if err != nil {
 		return wrapSQLError(err)
@@ -119,6 +151,9 @@ func (s *DB) Get(ctx context.Context, dest any, q sq.Sqlizer) (err error) {
 	return nil
 }
 
+// Query выполняет запрос и возвращает строки, которые нужно закрыть.
+// Хуки после выполнения запроса вызываются, когда Next вернул false или строки закрыты,
+// поэтому для незакрытых и недочитанных строк метрики не записываются, а спан трейса не завершается
 func (s *DB) Query(ctx context.Context, q sq.Sqlizer) (_ *Rows, err error) {
 
 	// Формируем запрос из билдера
@@ -127,7 +162,10 @@ func (s *DB) Query(ctx context.Context, q sq.Sqlizer) (_ *Rows, err error) {
 		return nil, errors.Default.Wrap(err)
 	}
 
-	rows := &Rows{Rows: nil}
+	rows := &Rows{Rows: nil, after: nil, count: 0}
+
+	// Вызываем хуки перед выполнением запроса
+	ctx, event := s.beforeQuery(ctx, MethodQuery, query, args)
 
 	// Извлекаем транзакцию из контекста
 	if tx := ExtractTx(ctx); tx != nil {
@@ -142,9 +180,13 @@ func (s *DB) Query(ctx context.Context, q sq.Sqlizer) (_ *Rows, err error) {
 
 	// Обрабатываем ошибки
 	if err != nil {
+		s.afterQuery(event, unknownRowsAffected, err)
 		return nil, wrapSQLError(err)
 	}
 
+	// Запрос завершается при закрытии строк, тогда же вызываем хуки после выполнения запроса
+	rows.after = func(rowsAffected int64, err error) { s.afterQuery(event, rowsAffected, err) }
+
 	return rows, nil
 }
 
@@ -158,6 +200,9 @@ func (s *DB) QueryRow(ctx context.Context, q sq.Sqlizer) (*Row, error) {
 
 	row := &Row{Row: nil}
 
+	// Вызываем хуки перед выполнением запроса
+	ctx, event := s.beforeQuery(ctx, MethodQueryRow, query, args)
+
 	// Извлекаем транзакцию из контекста
 	if tx := ExtractTx(ctx); tx != nil {
 
@@ -169,28 +214,43 @@ func (s *DB) QueryRow(ctx context.Context, q sq.Sqlizer) (*Row, error) {
 		row.Row = s.DB.QueryRowxContext(ctx, query, args...)
 	}
 
+	// Вызываем хуки после выполнения запроса, ошибка строки станет известна только при сканировании
+	s.afterQuery(event, unknownRowsAffected, row.Row.Err())
+
 	return row, nil
 }
 
+// Prepare подготавливает запрос из билдера, аргументы билдера используются по умолчанию при вызове методов Stmt.
+// Запросы кэшируются по тексту SQL: без транзакции в кэше подключения, с транзакцией из контекста - в кэше транзакции.
+// Запрос из кэша нужно закрывать так же, как и обычный, Close освобождает его для вытеснения
 func (s *DB) Prepare(ctx context.Context, q sq.Sqlizer) (_ *Stmt, err error) {
 
 	// Формируем запрос из билдера
-	query, _, err := ConvertBuilderToSQL(q)
+	query, args, err := ConvertBuilderToSQL(q)
 	if err != nil {
 		return nil, errors.Default.Wrap(err)
 	}
 
-	var stmt = &Stmt{Stmt: nil}
+	var stmt = &Stmt{Stmt: nil, db: s, query: query, args: args, tx: nil, release: nil}
 
 	// Извлекаем транзакцию из контекста
 	if tx := ExtractTx(ctx); tx != nil {
 
 		// Подготавливаем запрос в рамках транзакции
-		stmt.Stmt, err = tx.Tx.PreparexContext(ctx, query)
+		stmt.tx = tx
+		if s.stmts != nil {
+			stmt.Stmt, stmt.release, err = tx.stmts.acquire(ctx, query, tx.Tx.PreparexContext)
+		} else {
+			stmt.Stmt, err = tx.Tx.PreparexContext(ctx, query)
+		}
 	} else {
 
 		// Подготавливаем запрос
-		stmt.Stmt, err = s.DB.PreparexContext(ctx, query)
+		if s.stmts != nil {
+			stmt.Stmt, stmt.release, err = s.stmts.acquire(ctx, query, s.DB.PreparexContext)
+		} else {
+			stmt.Stmt, err = s.DB.PreparexContext(ctx, query)
+		}
 	}
 
 	// Обрабатываем ошибки
@@ -201,6 +261,27 @@ func (s *DB) Prepare(ctx context.Context, q sq.Sqlizer) (_ *Stmt, err error) {
 	return stmt, nil
 }
 
+// SetStmtCacheSize меняет размер кэша подготовленных запросов, 0 отключает кэш.
+// Метод не потокобезопасен, размер меняется при инициализации
+func (s *DB) SetStmtCacheSize(size int) {
+	if s.stmts != nil {
+		s.stmts.purge()
+	}
+	if size <= 0 {
+		s.stmts = nil
+		return
+	}
+	s.stmts = newStmtCache(size)
+}
+
+// stmtCacheSize возвращает размер кэша запросов транзакции: как у подключения или по умолчанию, если кэш отключен
+func (s *DB) stmtCacheSize() int {
+	if s.stmts != nil {
+		return s.stmts.capacity
+	}
+	return defaultStmtCacheSize
+}
+
 func (s *DB) Exec(ctx context.Context, q sq.Sqlizer) (err error) {
 
 	// Формируем запрос из билдера
@@ -209,17 +290,25 @@ func (s *DB) Exec(ctx context.Context, q sq.Sqlizer) (err error) {
 		return errors.Default.Wrap(err)
 	}
 
+	var result sql.Result
+
+	// Вызываем хуки перед выполнением запроса
+	ctx, event := s.beforeQuery(ctx, MethodExec, query, args)
+
 	// Извлекаем транзакцию из контекста
 	if tx := ExtractTx(ctx); tx != nil {
 
 		// Исполняем запрос в рамках транзакции
-		_, err = tx.Tx.ExecContext(ctx, query, args...)
+		result, err = tx.Tx.ExecContext(ctx, query, args...)
 	} else {
 
 		// Исполняем запрос
-		_, err = s.DB.ExecContext(ctx, query, args...)
+		result, err = s.DB.ExecContext(ctx, query, args...)
 	}
 
+	// Вызываем хуки после выполнения запроса
+	s.afterQuery(event, resultRowsAffected(result), err)
+
 	// Обрабатываем ошибки
 	if err != nil {
 		return wrapSQLError(err)
@@ -238,6 +327,9 @@ func (s *DB) ExecWithLastInsertID(ctx context.Context, q sq.Sqlizer) (id uint32,
 
 	query += " RETURNING id"
 
+	// Вызываем хуки перед выполнением запроса
+	ctx, event := s.beforeQuery(ctx, MethodExecWithLastInsertID, query, args)
+
 	// Извлекаем транзакцию из контекста
 	if tx := ExtractTx(ctx); tx != nil {
 
@@ -249,6 +341,9 @@ func (s *DB) ExecWithLastInsertID(ctx context.Context, q sq.Sqlizer) (id uint32,
 		err = s.DB.GetContext(ctx, &id, query, args...)
 	}
 
+	// Вызываем хуки после выполнения запроса
+	s.afterQuery(event, rowsFound(err), err)
+
 	// Обрабатываем ошибки
 	if err != nil {
 		return 0, wrapSQLError(err)
@@ -267,6 +362,9 @@ func (s *DB) ExecWithRowsAffected(ctx context.Context, q sq.Sqlizer) (_ uint32,
 
 	var result sql.Result
 
+	// Вызываем хуки перед выполнением запроса
+	ctx, event := s.beforeQuery(ctx, MethodExecWithRowsAffected, query, args)
+
 	// Извлекаем транзакцию из контекста
 	if tx := ExtractTx(ctx); tx != nil {
 
@@ -278,6 +376,9 @@ func (s *DB) ExecWithRowsAffected(ctx context.Context, q sq.Sqlizer) (_ uint32,
 		result, err = s.DB.ExecContext(ctx, query, args...)
 	}
 
+	// Вызываем хуки после выполнения запроса
+	s.afterQuery(event, resultRowsAffected(result), err)
+
 	// Обрабатываем ошибки
 	if err != nil {
 		return 0, wrapSQLError(err)
@@ -298,10 +399,17 @@ func wrapSQLError(err error) error {
 	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
 		return errors.Default.Wrap(err).SkipPreviousCaller()
 	case errors.Is(err, sql.ErrNoRows):
-		return errors.Default.Wrap(err).SkipPreviousCaller()
-	default:
-		return errors.Default.Wrap(err).SkipPreviousCaller()
+		return NotFound.Wrap(err).SkipPreviousCaller()
+	}
+
+	// Классифицируем ошибку по коду драйвера
+	if class, ok := classifySQLError(err); ok {
+		return class.errorType.Wrap(err).SkipPreviousCaller().
+			WithAdditionalError(class.sentinel).
+			WithParams(class.params...)
 	}
+
+	return errors.Default.Wrap(err).SkipPreviousCaller()
 }
 
 func ConvertBuilderToSQL(q sq.Sqlizer) (string, []any, error) {
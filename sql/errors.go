@@ -0,0 +1,164 @@
+package sql
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"pkg/errors"
+)
+
+// Типы ошибок базы данных, в которые wrapSQLError оборачивает ошибки драйверов
+var (
+	NotFound = errors.ErrorType{
+		Name:      "NotFound",
+		HTTPCode:  http.StatusNotFound,
+		LogAs:     errors.LogAsWarning,
+		HumanText: "",
+	}
+	Conflict = errors.ErrorType{
+		Name:      "Conflict",
+		HTTPCode:  http.StatusConflict,
+		LogAs:     errors.LogAsWarning,
+		HumanText: "",
+	}
+	ConstraintViolation = errors.ErrorType{
+		Name:      "ConstraintViolation",
+		HTTPCode:  http.StatusUnprocessableEntity,
+		LogAs:     errors.LogAsWarning,
+		HumanText: "",
+	}
+	Retryable = errors.ErrorType{
+		Name:      "Retryable",
+		HTTPCode:  http.StatusServiceUnavailable,
+		LogAs:     errors.LogAsWarning,
+		HumanText: "",
+	}
+)
+
+// Ошибки для проверки через errors.Is(err, sql.ErrUniqueViolation)
+var (
+	ErrRetryable = errors.New("retryable sql error")
+
+	ErrUniqueViolation      = errors.New("unique violation")
+	ErrForeignKeyViolation  = errors.New("foreign key violation")
+	ErrCheckViolation       = errors.New("check violation")
+	ErrNotNullViolation     = errors.New("not null violation")
+	ErrSerializationFailure = fmt.Errorf("serialization failure: %w", ErrRetryable)
+	ErrDeadlockDetected     = fmt.Errorf("deadlock detected: %w", ErrRetryable)
+	ErrTooManyQueries       = fmt.Errorf("too many simultaneous queries: %w", ErrRetryable)
+	ErrTimeoutExceeded      = fmt.Errorf("timeout exceeded: %w", ErrRetryable)
+)
+
+// SQLSTATE Postgres https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	sqlStateNotNullViolation     = "23502"
+	sqlStateForeignKeyViolation  = "23503"
+	sqlStateUniqueViolation      = "23505"
+	sqlStateCheckViolation       = "23514"
+	sqlStateExclusionViolation   = "23P01"
+	sqlStateSerializationFailure = "40001"
+	sqlStateDeadlockDetected     = "40P01"
+)
+
+// Коды исключений ClickHouse https://github.com/ClickHouse/ClickHouse/blob/master/src/Common/ErrorCodes.cpp
+const (
+	clickhouseTimeoutExceeded            = 159
+	clickhouseTooManySimultaneousQueries = 202
+	clickhouseSocketTimeout              = 209
+	clickhouseTooManyParts               = 252
+	clickhouseViolatedConstraint         = 469
+)
+
+// sqlErrorClass - результат классификации ошибки драйвера
+type sqlErrorClass struct {
+	errorType errors.ErrorType
+	sentinel  error
+	params    []any
+}
+
+// classifySQLError определяет тип ошибки по SQLSTATE Postgres или коду исключения ClickHouse.
+// Возвращает false, если ошибка не распознана
+func classifySQLError(err error) (sqlErrorClass, bool) {
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return classifyPgError(pgErr)
+	}
+
+	var chErr *proto.Exception
+	if errors.As(err, &chErr) {
+		return classifyClickhouseException(chErr)
+	}
+
+	return sqlErrorClass{errorType: errors.Default, sentinel: nil, params: nil}, false
+}
+
+func classifyPgError(pgErr *pgconn.PgError) (sqlErrorClass, bool) {
+
+	params := []any{"sqlState", pgErr.Code}
+	if pgErr.TableName != "" {
+		params = append(params, "table", pgErr.TableName)
+	}
+	if pgErr.ColumnName != "" {
+		params = append(params, "column", pgErr.ColumnName)
+	}
+	if pgErr.ConstraintName != "" {
+		params = append(params, "constraint", pgErr.ConstraintName)
+	}
+
+	class := sqlErrorClass{errorType: errors.Default, sentinel: nil, params: params}
+
+	switch pgErr.Code {
+	case sqlStateUniqueViolation, sqlStateExclusionViolation:
+		class.errorType, class.sentinel = Conflict, ErrUniqueViolation
+	case sqlStateForeignKeyViolation:
+		class.errorType, class.sentinel = ConstraintViolation, ErrForeignKeyViolation
+	case sqlStateCheckViolation:
+		class.errorType, class.sentinel = ConstraintViolation, ErrCheckViolation
+	case sqlStateNotNullViolation:
+		class.errorType, class.sentinel = ConstraintViolation, ErrNotNullViolation
+	case sqlStateSerializationFailure:
+		class.errorType, class.sentinel = Retryable, ErrSerializationFailure
+	case sqlStateDeadlockDetected:
+		class.errorType, class.sentinel = Retryable, ErrDeadlockDetected
+	default:
+		return class, false
+	}
+
+	return class, true
+}
+
+func classifyClickhouseException(chErr *proto.Exception) (sqlErrorClass, bool) {
+
+	class := sqlErrorClass{
+		errorType: errors.Default,
+		sentinel:  nil,
+		params:    []any{"clickhouseCode", chErr.Code, "clickhouseName", chErr.Name},
+	}
+
+	switch chErr.Code {
+	case clickhouseViolatedConstraint:
+		class.errorType, class.sentinel = ConstraintViolation, ErrCheckViolation
+	case clickhouseTooManySimultaneousQueries, clickhouseTooManyParts:
+		class.errorType, class.sentinel = Retryable, ErrTooManyQueries
+	case clickhouseTimeoutExceeded, clickhouseSocketTimeout:
+		class.errorType, class.sentinel = Retryable, ErrTimeoutExceeded
+	default:
+		return class, false
+	}
+
+	return class, true
+}
+
+// IsRetryable проверяет, можно ли повторить запрос или транзакцию после ошибки.
+// Работает как для ошибок, обернутых в wrapSQLError, так и для необернутых ошибок драйверов
+func IsRetryable(err error) bool {
+	if errors.Is(err, ErrRetryable) {
+		return true
+	}
+	class, ok := classifySQLError(err)
+	return ok && errors.Is(class.sentinel, ErrRetryable)
+}
@@ -0,0 +1,109 @@
+package sql
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"pkg/errors"
+)
+
+func TestWrapSQLError(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		err        error
+		target     error
+		httpCode   int
+		constraint string
+	}{
+		{
+			name:     "1. Строка не найдена",
+			err:      ErrNoRows,
+			target:   ErrNoRows,
+			httpCode: http.StatusNotFound,
+		},
+		{
+			name:       "2. Нарушение уникальности",
+			err:        &pgconn.PgError{Code: "23505", ConstraintName: "users_email_key"},
+			target:     ErrUniqueViolation,
+			httpCode:   http.StatusConflict,
+			constraint: "users_email_key",
+		},
+		{
+			name:       "3. Нарушение внешнего ключа",
+			err:        &pgconn.PgError{Code: "23503", ConstraintName: "orders_user_id_fkey"},
+			target:     ErrForeignKeyViolation,
+			httpCode:   http.StatusUnprocessableEntity,
+			constraint: "orders_user_id_fkey",
+		},
+		{
+			name:     "4. Ошибка сериализации",
+			err:      &pgconn.PgError{Code: "40001"},
+			target:   ErrRetryable,
+			httpCode: http.StatusServiceUnavailable,
+		},
+		{
+			name:     "5. Нарушение ограничения ClickHouse",
+			err:      &proto.Exception{Code: 469, Name: "VIOLATED_CONSTRAINT"},
+			target:   ErrCheckViolation,
+			httpCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "6. Неизвестная ошибка",
+			err:      &pgconn.PgError{Code: "42601"},
+			target:   nil,
+			httpCode: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			var customErr errors.Error
+			if !errors.As(wrapSQLError(tt.err), &customErr) {
+				t.Fatalf("Ошибка не обернута")
+			}
+
+			if customErr.ErrorType.HTTPCode != tt.httpCode {
+				t.Errorf("HTTPCode = %d, want %d", customErr.ErrorType.HTTPCode, tt.httpCode)
+			}
+			if tt.target != nil && !errors.Is(customErr, tt.target) {
+				t.Errorf("errors.Is(%v, %v) = false", customErr, tt.target)
+			}
+			if tt.constraint != "" && customErr.Params["constraint"] != tt.constraint {
+				t.Errorf("constraint = %v, want %s", customErr.Params["constraint"], tt.constraint)
+			}
+
+			// Исходная ошибка драйвера остается доступной
+			if !errors.Is(customErr, tt.err) && !errors.As(customErr, new(*pgconn.PgError)) {
+				t.Errorf("Исходная ошибка потеряна")
+			}
+		})
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"1. Ошибка сериализации", &pgconn.PgError{Code: "40001"}, true},
+		{"2. Дедлок в обертке", errors.Default.Wrap(&pgconn.PgError{Code: "40P01"}), true},
+		{"3. Классифицированная ошибка", wrapSQLError(&pgconn.PgError{Code: "40001"}), true},
+		{"4. Слишком много запросов в ClickHouse", &proto.Exception{Code: 202}, true},
+		{"5. Нарушение уникальности", &pgconn.PgError{Code: "23505"}, false},
+		{"6. Обычная ошибка", errors.Default.New("error"), false},
+		{"7. Нет ошибки", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"iter"
+	"reflect"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// SelectT выполняет запрос и возвращает слайс строк типа T.
+// T - структура с тегами db или скалярный тип для выборки одной колонки
+func SelectT[T any](ctx context.Context, db SQL, q sq.Sqlizer) ([]T, error) {
+	res := make([]T, 0)
+	if err := db.Select(ctx, &res, q); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// GetT выполняет запрос и возвращает одну строку типа T. Если строк нет, возвращается ошибка ErrNoRows
+func GetT[T any](ctx context.Context, db SQL, q sq.Sqlizer) (T, error) {
+	var res T
+	if err := db.Get(ctx, &res, q); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+// QuerySeq выполняет запрос и возвращает итератор по строкам типа T без загрузки всей выборки в память.
+// Ошибка выполнения запроса возвращается первым элементом итератора
+func QuerySeq[T any](ctx context.Context, db SQL, q sq.Sqlizer) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+
+		rows, err := db.Query(ctx, q)
+		if err != nil {
+			var zero T
+			yield(zero, err)
+			return
+		}
+
+		for item, err := range RowsSeq[T](rows) {
+			if !yield(item, err) {
+				return
+			}
+		}
+	}
+}
+
+// RowsSeq возвращает итератор по строкам rows, сканируя каждую строку в T.
+// Rows закрываются после окончания итерации, в том числе при выходе из цикла через break.
+// После первой ошибки итерация прекращается
+func RowsSeq[T any](rows *Rows) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		defer func() { _ = rows.Close() }()
+
+		scannable := isScannable(reflect.TypeFor[T]())
+
+		for rows.Next() {
+
+			var (
+				item T
+				err  error
+			)
+			if scannable {
+				err = rows.Scan(&item)
+			} else {
+				err = rows.Rows.StructScan(&item)
+			}
+			if err != nil {
+				yield(item, wrapSQLError(err))
+				return
+			}
+
+			if !yield(item, nil) {
+				return
+			}
+		}
+
+		if err := rows.Err(); err != nil {
+			var zero T
+			yield(zero, wrapSQLError(err))
+		}
+	}
+}
+
+var scannerType = reflect.TypeFor[sql.Scanner]()
+
+// isScannable проверяет, сканируется ли тип целиком в одну колонку, а не по полям структуры.
+// Повторяет логику sqlx: скаляры, типы с sql.Scanner и структуры без экспортируемых полей вроде time.Time
+func isScannable(t reflect.Type) bool {
+
+	if reflect.PointerTo(t).Implements(scannerType) {
+		return true
+	}
+
+	if t.Kind() != reflect.Struct {
+		return true
+	}
+
+	for i := range t.NumField() {
+		if t.Field(i).IsExported() {
+			return false
+		}
+	}
+
+	return true
+}
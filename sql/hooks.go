@@ -0,0 +1,175 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"regexp"
+	"slices"
+	"time"
+)
+
+// Названия методов DB, которые передаются в хуки
+const (
+	MethodSelect               = "Select"
+	MethodGet                  = "Get"
+	MethodQuery                = "Query"
+	MethodQueryRow             = "QueryRow"
+	MethodExec                 = "Exec"
+	MethodExecWithLastInsertID = "ExecWithLastInsertID"
+	MethodExecWithRowsAffected = "ExecWithRowsAffected"
+	MethodCopyFrom             = "CopyFrom"
+	MethodBatchInsert          = "BatchInsert"
+)
+
+// unknownRowsAffected - значение RowsAffected, когда количество строк неизвестно, например для QueryRow
+const unknownRowsAffected = -1
+
+// QueryEvent - данные о запросе, которые передаются в хуки
+type QueryEvent struct {
+
+	// Название запроса из контекста (WithQueryName) или из комментария в SQL ("-- name: GetUser")
+	Name string
+
+	// Метод DB, через который выполняется запрос
+	Method string
+
+	// Текст запроса и аргументы после подстановки плейсхолдеров
+	Query string
+	Args  []any
+
+	// Выполняется ли запрос в транзакции из контекста
+	InTx bool
+
+	// Время начала выполнения запроса
+	StartedAt time.Time
+
+	// Поля ниже заполняются только для After
+
+	// Длительность выполнения запроса
+	Duration time.Duration
+
+	// Количество затронутых или полученных строк, -1 если количество неизвестно
+	RowsAffected int64
+
+	// Ошибка выполнения запроса
+	Err error
+
+	// Контексты, которые вернул Before каждого хука, After получает контекст своего Before
+	contexts []context.Context
+}
+
+// Hook - перехватчик запросов DB.
+//
+// Before вызывается перед выполнением запроса и может вернуть дочерний контекст, который уйдет в драйвер и в After
+type Hook interface {
+	Before(ctx context.Context, event *QueryEvent) context.Context
+	After(ctx context.Context, event *QueryEvent)
+}
+
+// AddHooks добавляет хуки, которые вызываются в порядке добавления.
+// Метод не потокобезопасен, хуки добавляются при инициализации.
+// Слайс всегда копируется, так как копии DB, например из Unsafe, разделяют его с исходным подключением
+func (s *DB) AddHooks(hooks ...Hook) {
+	s.hooks = slices.Concat(s.hooks, hooks)
+}
+
+type queryNameKey struct{}
+
+// WithQueryName кладет в контекст название запроса для хуков
+func WithQueryName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, queryNameKey{}, name)
+}
+
+// queryNameCommentRegexp ищет название запроса в комментарии вида "-- name: GetUser" или "/* name: GetUser */"
+var queryNameCommentRegexp = regexp.MustCompile(`(?:--|/\*)\s*name:\s*([\w.-]+)`)
+
+// QueryName возвращает название запроса из контекста, а если его там нет - из комментария в SQL
+func QueryName(ctx context.Context, query string) string {
+	if name, ok := ctx.Value(queryNameKey{}).(string); ok && name != "" {
+		return name
+	}
+
+	if match := queryNameCommentRegexp.FindStringSubmatch(query); match != nil {
+		return match[1]
+	}
+
+	return ""
+}
+
+// beforeQuery вызывает Before у всех хуков. Если хуков нет, событие не создается
+func (s *DB) beforeQuery(ctx context.Context, method, query string, args []any) (context.Context, *QueryEvent) {
+
+	if len(s.hooks) == 0 {
+		return ctx, nil
+	}
+
+	event := &QueryEvent{
+		Name:         QueryName(ctx, query),
+		Method:       method,
+		Query:        query,
+		Args:         args,
+		InTx:         ExtractTx(ctx) != nil,
+		StartedAt:    time.Now(),
+		Duration:     0,
+		RowsAffected: unknownRowsAffected,
+		Err:          nil,
+		contexts:     make([]context.Context, len(s.hooks)),
+	}
+
+	for i, hook := range s.hooks {
+		ctx = hook.Before(ctx, event)
+		event.contexts[i] = ctx
+	}
+
+	return ctx, event
+}
+
+// afterQuery вызывает After у всех хуков в обратном порядке, чтобы вложенность совпадала с Before.
+// Каждый хук получает контекст, который вернул его Before
+func (s *DB) afterQuery(event *QueryEvent, rowsAffected int64, err error) {
+
+	if event == nil {
+		return
+	}
+
+	event.Duration = time.Since(event.StartedAt)
+	event.RowsAffected = rowsAffected
+	event.Err = err
+
+	for i := len(s.hooks) - 1; i >= 0; i-- {
+		s.hooks[i].After(event.contexts[i], event)
+	}
+}
+
+// destLen возвращает количество полученных строк для слайса-приемника Select
+func destLen(dest any) int64 {
+	v := reflect.ValueOf(dest)
+	for v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice {
+		return unknownRowsAffected
+	}
+	return int64(v.Len())
+}
+
+// rowsFound возвращает количество полученных строк для Get, который получает ровно одну строку
+func rowsFound(err error) int64 {
+	if err != nil {
+		return 0
+	}
+	return 1
+}
+
+// resultRowsAffected возвращает количество затронутых строк из результата Exec
+func resultRowsAffected(result sql.Result) int64 {
+	if result == nil {
+		return unknownRowsAffected
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return unknownRowsAffected
+	}
+	return affected
+}
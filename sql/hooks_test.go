@@ -0,0 +1,206 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"reflect"
+	"testing"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+func TestQueryName(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		query string
+		want  string
+	}{
+		{
+			name:  "1. Название из однострочного комментария",
+			ctx:   context.Background(),
+			query: "-- name: GetUser\nSELECT * FROM users WHERE id = $1",
+			want:  "GetUser",
+		},
+		{
+			name:  "2. Название из многострочного комментария",
+			ctx:   context.Background(),
+			query: "SELECT /* name: users.list */ * FROM users",
+			want:  "users.list",
+		},
+		{
+			name:  "3. Название из контекста приоритетнее комментария",
+			ctx:   WithQueryName(context.Background(), "FromContext"),
+			query: "-- name: GetUser\nSELECT 1",
+			want:  "FromContext",
+		},
+		{
+			name:  "4. Название не указано",
+			ctx:   context.Background(),
+			query: "SELECT 1",
+			want:  "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := QueryName(tt.ctx, tt.query); got != tt.want {
+				t.Errorf("QueryName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// Драйвер-заглушка, который на любой запрос возвращает две строки
+type rowsDriver struct{}
+
+type rowsConn struct{}
+
+type rowsStmt struct{}
+
+type rowsResult struct{ left int }
+
+func (rowsDriver) Open(string) (driver.Conn, error) { return rowsConn{}, nil }
+
+func (rowsConn) Prepare(string) (driver.Stmt, error) { return rowsStmt{}, nil }
+func (rowsConn) Close() error                        { return nil }
+func (rowsConn) Begin() (driver.Tx, error)           { return countingTx{}, nil }
+
+func (rowsStmt) Close() error                               { return nil }
+func (rowsStmt) NumInput() int                              { return -1 }
+func (rowsStmt) Exec([]driver.Value) (driver.Result, error) { return driver.ResultNoRows, nil }
+func (rowsStmt) Query([]driver.Value) (driver.Rows, error)  { return &rowsResult{left: 2}, nil }
+
+func (r *rowsResult) Columns() []string { return []string{"id"} }
+func (r *rowsResult) Close() error      { return nil }
+func (r *rowsResult) Next(dest []driver.Value) error {
+	if r.left == 0 {
+		return io.EOF
+	}
+	dest[0] = int64(r.left)
+	r.left--
+	return nil
+}
+
+type hookNameKey struct{}
+
+// recordingHook кладет свое название в контекст и запоминает, какой контекст пришел в After
+type recordingHook struct {
+	name  string
+	calls *[]string
+	rows  *int64
+}
+
+func (h recordingHook) Before(ctx context.Context, _ *QueryEvent) context.Context {
+	return context.WithValue(ctx, hookNameKey{}, h.name)
+}
+
+func (h recordingHook) After(ctx context.Context, event *QueryEvent) {
+	name, _ := ctx.Value(hookNameKey{}).(string)
+	*h.calls = append(*h.calls, h.name+":"+name)
+	*h.rows = event.RowsAffected
+}
+
+func TestHooksQuery(t *testing.T) {
+
+	sql.Register("hooksRows", rowsDriver{})
+	db, err := sql.Open("hooksRows", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+
+	var calls []string
+	var rowsAffected int64
+	sqlDB := NewDB(db, "hooksRows")
+	sqlDB.AddHooks(
+		recordingHook{name: "first", calls: &calls, rows: &rowsAffected},
+		recordingHook{name: "second", calls: &calls, rows: &rowsAffected},
+	)
+
+	t.Run("1. Хуки завершаются, когда строки прочитаны до конца", func(t *testing.T) {
+		calls, rowsAffected = nil, 0
+
+		rows, err := sqlDB.Query(context.Background(), sq.Select("id").From("t"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Пока строки читаются, запрос не завершен
+		if !rows.Next() || len(calls) != 0 {
+			t.Fatalf("After called before rows are read: %v", calls)
+		}
+		for rows.Next() {
+		}
+
+		// Каждый хук получает контекст своего Before, After вызывается один раз в обратном порядке
+		if want := []string{"second:second", "first:first"}; !reflect.DeepEqual(calls, want) {
+			t.Errorf("After calls = %v, want %v", calls, want)
+		}
+		if rowsAffected != 2 {
+			t.Errorf("RowsAffected = %d, want 2", rowsAffected)
+		}
+
+		if err = rows.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if len(calls) != 2 {
+			t.Errorf("After called again on Rows.Close: %v", calls)
+		}
+	})
+
+	t.Run("2. Хуки завершаются при закрытии недочитанных строк", func(t *testing.T) {
+		calls, rowsAffected = nil, 0
+
+		rows, err := sqlDB.Query(context.Background(), sq.Select("id").From("t"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows.Next()
+		if err = rows.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err = rows.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(calls) != 2 || rowsAffected != 1 {
+			t.Errorf("After calls = %v, RowsAffected = %d, want 2 calls and 1 row", calls, rowsAffected)
+		}
+	})
+}
+
+func TestAddHooks(t *testing.T) {
+
+	var calls []string
+	var rows int64
+	hook := func(name string) Hook { return recordingHook{name: name, calls: &calls, rows: &rows} }
+
+	sqlDB := sql.OpenDB(txConnector{driver: &txDriver{log: nil}})
+	defer func() { _ = sqlDB.Close() }()
+
+	db := NewDB(sqlDB, "postgres")
+	db.AddHooks(hook("a"), hook("b"), hook("c"))
+	db.AddHooks(hook("d"))
+
+	// Копия из Unsafe не должна перезаписывать хуки исходного подключения и наоборот
+	unsafe := db.Unsafe()
+	db.AddHooks(hook("e"))
+	unsafe.AddHooks(hook("f"))
+
+	names := func(hooks []Hook) []string {
+		res := make([]string, 0, len(hooks))
+		for _, h := range hooks {
+			res = append(res, h.(recordingHook).name)
+		}
+		return res
+	}
+	if got := names(db.hooks); !reflect.DeepEqual(got, []string{"a", "b", "c", "d", "e"}) {
+		t.Errorf("db hooks = %v", got)
+	}
+	if got := names(unsafe.hooks); !reflect.DeepEqual(got, []string{"a", "b", "c", "d", "f"}) {
+		t.Errorf("unsafe hooks = %v", got)
+	}
+}
@@ -0,0 +1,150 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"pkg/backoff"
+	"pkg/errors"
+)
+
+// Уровни изоляции транзакций
+const (
+	LevelDefault        = sql.LevelDefault
+	LevelReadCommitted  = sql.LevelReadCommitted
+	LevelRepeatableRead = sql.LevelRepeatableRead
+	LevelSerializable   = sql.LevelSerializable
+)
+
+// TxOptions - настройки транзакции для InTx
+type TxOptions struct {
+
+	// Уровень изоляции и режим только для чтения. Для вложенных вызовов игнорируются,
+	// так как точка сохранения работает в рамках внешней транзакции
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+
+	// Количество повторов транзакции при ошибках сериализации и дедлоках, 0 - без повторов
+	MaxRetries int
+
+	// Задержка перед первым повтором, далее растет экспоненциально до MaxBackoff
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultTxOptions возвращает настройки по умолчанию: уровень изоляции базы и 3 повтора
+func DefaultTxOptions() TxOptions {
+	return TxOptions{
+		Isolation:  LevelDefault,
+		ReadOnly:   false,
+		MaxRetries: 3,
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: time.Second,
+	}
+}
+
+// InTx выполняет fn в транзакции, которая передается в fn через контекст.
+// Если fn вернула ошибку или запаниковала, транзакция откатывается, иначе коммитится.
+// Если в контексте уже есть транзакция, fn выполняется внутри точки сохранения этой транзакции.
+// При ошибках сериализации и дедлоках транзакция повторяется целиком, поэтому fn должна быть идемпотентной
+// вне базы данных. opts может быть nil, тогда используются DefaultTxOptions
+func (s *DB) InTx(ctx context.Context, opts *TxOptions, fn func(ctx context.Context) error) error {
+
+	if opts == nil {
+		defaultOpts := DefaultTxOptions()
+		opts = &defaultOpts
+	}
+
+	// Если транзакция уже есть, используем точку сохранения.
+	// Повторять вложенный вызов бессмысленно, ошибка сериализации откатывает всю транзакцию
+	if tx := ExtractTx(ctx); tx != nil {
+		return tx.inSavepoint(ctx, fn)
+	}
+
+	for attempt := 0; ; attempt++ {
+
+		err := s.inTx(ctx, opts, fn)
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= opts.MaxRetries || !IsRetryable(err) {
+			return err
+		}
+
+		// Ждем перед повтором
+		if err = backoff.Sleep(ctx, opts.MinBackoff, opts.MaxBackoff, attempt); err != nil {
+			return err
+		}
+	}
+}
+
+// inTx выполняет одну попытку транзакции
+func (s *DB) inTx(ctx context.Context, opts *TxOptions, fn func(ctx context.Context) error) (err error) {
+
+	// Открываем транзакцию
+	sqlxTx, err := s.DB.BeginTxx(ctx, &sql.TxOptions{
+		Isolation: opts.Isolation,
+		ReadOnly:  opts.ReadOnly,
+	})
+	if err != nil {
+		return wrapSQLError(err)
+	}
+	tx := newTx(sqlxTx, s.stmtCacheSize())
+
+	// Откатываем транзакцию при панике и пробрасываем панику дальше
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	// Выполняем функцию
+	if err = fn(InjectTx(ctx, tx)); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return errors.Default.Wrap(err).WithParams("rollbackError", rollbackErr.Error())
+		}
+		return err
+	}
+
+	// Коммитим транзакцию
+	return tx.Commit()
+}
+
+// inSavepoint выполняет fn внутри точки сохранения
+func (s *Tx) inSavepoint(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+
+	s.savepoints++
+	savepoint := fmt.Sprintf("sp_%d", s.savepoints)
+
+	// Создаем точку сохранения
+	if _, err = s.Tx.ExecContext(ctx, "SAVEPOINT "+savepoint); err != nil {
+		return wrapSQLError(err)
+	}
+
+	// Откатываемся к точке сохранения при панике и пробрасываем панику дальше
+	defer func() {
+		if p := recover(); p != nil {
+			_, _ = s.Tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+savepoint)
+			panic(p)
+		}
+	}()
+
+	// Выполняем функцию
+	if err = fn(ctx); err != nil {
+		if _, rollbackErr := s.Tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+savepoint); rollbackErr != nil {
+			return errors.Default.Wrap(err).WithParams("rollbackError", rollbackErr.Error())
+		}
+		return err
+	}
+
+	// Освобождаем точку сохранения
+	if _, err = s.Tx.ExecContext(ctx, "RELEASE SAVEPOINT "+savepoint); err != nil {
+		return wrapSQLError(err)
+	}
+
+	return nil
+}
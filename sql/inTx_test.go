@@ -0,0 +1,187 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pkg/errors"
+)
+
+// txDriver - драйвер-заглушка, который записывает команды управления транзакцией и выполненные запросы
+type txDriver struct {
+	log []string
+}
+
+type txConn struct{ driver *txDriver }
+
+type txStmt struct {
+	driver *txDriver
+	query  string
+}
+
+type txTx struct{ driver *txDriver }
+
+func (c *txConn) Prepare(query string) (driver.Stmt, error) {
+	return &txStmt{driver: c.driver, query: query}, nil
+}
+func (c *txConn) Close() error { return nil }
+func (c *txConn) Begin() (driver.Tx, error) {
+	c.driver.log = append(c.driver.log, "BEGIN")
+	return &txTx{driver: c.driver}, nil
+}
+
+func (s *txStmt) Close() error  { return nil }
+func (s *txStmt) NumInput() int { return -1 }
+func (s *txStmt) Exec([]driver.Value) (driver.Result, error) {
+	s.driver.log = append(s.driver.log, s.query)
+	return driver.ResultNoRows, nil
+}
+func (s *txStmt) Query([]driver.Value) (driver.Rows, error) { return nil, driver.ErrSkip }
+
+func (t *txTx) Commit() error {
+	t.driver.log = append(t.driver.log, "COMMIT")
+	return nil
+}
+
+func (t *txTx) Rollback() error {
+	t.driver.log = append(t.driver.log, "ROLLBACK")
+	return nil
+}
+
+type txConnector struct{ driver *txDriver }
+
+func (c txConnector) Connect(context.Context) (driver.Conn, error) {
+	return &txConn{driver: c.driver}, nil
+}
+func (c txConnector) Driver() driver.Driver { return nil }
+
+func newTxTestDB(t *testing.T) (*DB, *txDriver) {
+	drv := &txDriver{log: nil}
+	db := sql.OpenDB(txConnector{driver: drv})
+	t.Cleanup(func() { _ = db.Close() })
+	return NewDB(db, "postgres"), drv
+}
+
+func TestDBInTx(t *testing.T) {
+
+	errFn := errors.Default.New("fn error")
+	opts := &TxOptions{Isolation: LevelDefault, ReadOnly: false, MaxRetries: 1, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	tests := []struct {
+		name    string
+		fn      func(db *DB, calls *int) func(ctx context.Context) error
+		wantErr bool
+		wantLog []string
+	}{
+		{
+			name: "1. Успешная транзакция коммитится",
+			fn: func(*DB, *int) func(ctx context.Context) error {
+				return func(context.Context) error { return nil }
+			},
+			wantErr: false,
+			wantLog: []string{"BEGIN", "COMMIT"},
+		},
+		{
+			name: "2. Ошибка откатывает транзакцию",
+			fn: func(*DB, *int) func(ctx context.Context) error {
+				return func(context.Context) error { return errFn }
+			},
+			wantErr: true,
+			wantLog: []string{"BEGIN", "ROLLBACK"},
+		},
+		{
+			name: "3. Вложенный вызов освобождает точку сохранения",
+			fn: func(db *DB, _ *int) func(ctx context.Context) error {
+				return func(ctx context.Context) error {
+					return db.InTx(ctx, opts, func(context.Context) error { return nil })
+				}
+			},
+			wantErr: false,
+			wantLog: []string{"BEGIN", "SAVEPOINT sp_1", "RELEASE SAVEPOINT sp_1", "COMMIT"},
+		},
+		{
+			name: "4. Ошибка вложенного вызова откатывает только точку сохранения",
+			fn: func(db *DB, _ *int) func(ctx context.Context) error {
+				return func(ctx context.Context) error {
+					if err := db.InTx(ctx, opts, func(context.Context) error { return errFn }); !errors.Is(err, errFn) {
+						return errors.Default.New("unexpected nested error")
+					}
+					return nil
+				}
+			},
+			wantErr: false,
+			wantLog: []string{"BEGIN", "SAVEPOINT sp_1", "ROLLBACK TO SAVEPOINT sp_1", "COMMIT"},
+		},
+		{
+			name: "5. Ошибка сериализации повторяет транзакцию",
+			fn: func(_ *DB, calls *int) func(ctx context.Context) error {
+				return func(context.Context) error {
+					*calls++
+					if *calls == 1 {
+						return &pgconn.PgError{Code: "40001"}
+					}
+					return nil
+				}
+			},
+			wantErr: false,
+			wantLog: []string{"BEGIN", "ROLLBACK", "BEGIN", "COMMIT"},
+		},
+		{
+			name: "6. Повторы закончились",
+			fn: func(*DB, *int) func(ctx context.Context) error {
+				return func(context.Context) error { return &pgconn.PgError{Code: "40001"} }
+			},
+			wantErr: true,
+			wantLog: []string{"BEGIN", "ROLLBACK", "BEGIN", "ROLLBACK"},
+		},
+		{
+			name: "7. Обычная ошибка не повторяется",
+			fn: func(*DB, *int) func(ctx context.Context) error {
+				return func(context.Context) error { return errFn }
+			},
+			wantErr: true,
+			wantLog: []string{"BEGIN", "ROLLBACK"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, drv := newTxTestDB(t)
+
+			var calls int
+			err := db.InTx(context.Background(), opts, tt.fn(db, &calls))
+
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.wantLog, drv.log)
+		})
+	}
+}
+
+func TestDBInTxPanic(t *testing.T) {
+
+	t.Run("1. Паника откатывает транзакцию и пробрасывается дальше", func(t *testing.T) {
+		db, drv := newTxTestDB(t)
+
+		assert.PanicsWithValue(t, "boom", func() {
+			_ = db.InTx(context.Background(), nil, func(context.Context) error { panic("boom") })
+		})
+		assert.Equal(t, []string{"BEGIN", "ROLLBACK"}, drv.log)
+	})
+
+	t.Run("2. Паника во вложенном вызове откатывает точку сохранения и транзакцию", func(t *testing.T) {
+		db, drv := newTxTestDB(t)
+
+		assert.PanicsWithValue(t, "boom", func() {
+			_ = db.InTx(context.Background(), nil, func(ctx context.Context) error {
+				return db.InTx(ctx, nil, func(context.Context) error { panic("boom") })
+			})
+		})
+		require.Equal(t, []string{"BEGIN", "SAVEPOINT sp_1", "ROLLBACK TO SAVEPOINT sp_1", "ROLLBACK"}, drv.log)
+	})
+}
@@ -0,0 +1,110 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+
+	"pkg/errors"
+)
+
+// Keyset - настройки постраничного обхода по ключу (keyset pagination).
+// В отличие от OFFSET, каждая страница выбирается по индексу с условия "(columns) > (значения последней строки)",
+// поэтому скорость не падает на дальних страницах
+type Keyset struct {
+
+	// Колонки ключа в порядке сортировки. Комбинация значений должна быть уникальной, например (created_at, id)
+	Columns []string
+
+	// Размер страницы
+	Limit uint64
+
+	// Обход в порядке убывания
+	Desc bool
+}
+
+// Apply добавляет к запросу условие на ключ, сортировку и лимит.
+// after - значения колонок ключа последней строки предыдущей страницы, для первой страницы передается nil
+func (k Keyset) Apply(q sq.SelectBuilder, after []any) (sq.SelectBuilder, error) {
+
+	if len(k.Columns) == 0 {
+		return q, errors.Default.New("keyset columns are empty")
+	}
+
+	if after != nil {
+		if len(after) != len(k.Columns) {
+			return q, errors.Default.New("keyset values count mismatch").
+				WithParams("columns", len(k.Columns), "values", len(after))
+		}
+
+		operator := ">"
+		if k.Desc {
+			operator = "<"
+		}
+
+		// Сравнение кортежей работает и в Postgres, и в ClickHouse
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(after)), ", ")
+		q = q.Where(sq.Expr(fmt.Sprintf("(%s) %s (%s)", strings.Join(k.Columns, ", "), operator, placeholders), after...))
+	}
+
+	orderBy := make([]string, 0, len(k.Columns))
+	for _, column := range k.Columns {
+		if k.Desc {
+			orderBy = append(orderBy, column+" DESC")
+		} else {
+			orderBy = append(orderBy, column)
+		}
+	}
+
+	q = q.OrderBy(orderBy...)
+	if k.Limit > 0 {
+		q = q.Limit(k.Limit)
+	}
+
+	return q, nil
+}
+
+// KeysetSeq обходит всю выборку страницами по k.Limit строк и возвращает итератор по строкам.
+// key возвращает значения колонок ключа строки в порядке k.Columns.
+// В запросе q не должно быть ORDER BY и LIMIT, они добавляются для каждой страницы
+func KeysetSeq[T any](ctx context.Context, db SQL, q sq.SelectBuilder, k Keyset, key func(T) []any) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+
+		var after []any
+
+		for {
+
+			// Формируем запрос очередной страницы
+			pageQuery, err := k.Apply(q, after)
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+
+			// Получаем страницу
+			page, err := SelectT[T](ctx, db, pageQuery)
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+
+			for _, item := range page {
+				if !yield(item, nil) {
+					return
+				}
+			}
+
+			// Если страница неполная, значит она последняя
+			if len(page) == 0 || k.Limit == 0 || uint64(len(page)) < k.Limit {
+				return
+			}
+
+			after = key(page[len(page)-1])
+		}
+	}
+}
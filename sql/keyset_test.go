@@ -0,0 +1,89 @@
+package sql
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestKeyset_Apply(t *testing.T) {
+
+	q := sq.Select("id", "created_at").From("events").Where(sq.Eq{"type": "click"})
+
+	tests := []struct {
+		name      string
+		keyset    Keyset
+		after     []any
+		wantQuery string
+		wantArgs  []any
+	}{
+		{
+			name:      "1. Первая страница",
+			keyset:    Keyset{Columns: []string{"created_at", "id"}, Limit: 100, Desc: false},
+			after:     nil,
+			wantQuery: "SELECT id, created_at FROM events WHERE type = ? ORDER BY created_at, id LIMIT 100",
+			wantArgs:  []any{"click"},
+		},
+		{
+			name:      "2. Следующая страница по убыванию",
+			keyset:    Keyset{Columns: []string{"created_at", "id"}, Limit: 100, Desc: true},
+			after:     []any{"2024-01-01", 5},
+			wantQuery: "SELECT id, created_at FROM events WHERE type = ? AND (created_at, id) < (?, ?) ORDER BY created_at DESC, id DESC LIMIT 100",
+			wantArgs:  []any{"click", "2024-01-01", 5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			pageQuery, err := tt.keyset.Apply(q, tt.after)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			query, args, err := pageQuery.ToSql()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if query != tt.wantQuery {
+				t.Errorf("query = %s, want %s", query, tt.wantQuery)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestKeysetSeq(t *testing.T) {
+
+	type item struct {
+		ID int `db:"id"`
+	}
+
+	// Три страницы: полная, полная и неполная
+	pages := [][]item{{{1}, {2}}, {{3}, {4}}, {{5}}}
+
+	db := NewMockSQL(t)
+	for _, page := range pages {
+		db.On("Select", mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			*args.Get(1).(*[]item) = page
+		}).Return(nil).Once()
+	}
+
+	keyset := Keyset{Columns: []string{"id"}, Limit: 2, Desc: false}
+
+	var got []int
+	for row, err := range KeysetSeq(context.Background(), db, sq.Select("id").From("items"), keyset, func(i item) []any { return []any{i.ID} }) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, row.ID)
+	}
+
+	if !reflect.DeepEqual(got, []int{1, 2, 3, 4, 5}) {
+		t.Errorf("KeysetSeq() = %v", got)
+	}
+}
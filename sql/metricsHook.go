@@ -0,0 +1,83 @@
+package sql
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pkg/errors"
+	"pkg/promUtils"
+)
+
+const unknownQueryName = "unknown"
+
+var _ Hook = new(MetricsHook)
+
+// MetricsHook - хук, который пишет длительность запросов в гистограмму Prometheus с разбивкой по названию запроса
+type MetricsHook struct {
+	queryDuration *prometheus.HistogramVec
+}
+
+// NewMetricsHook создает хук и регистрирует гистограмму в registerer. Если registerer nil, используется глобальный реестр.
+// Повторная регистрация с тем же namespace переиспользует уже зарегистрированную гистограмму
+func NewMetricsHook(namespace string, registerer prometheus.Registerer) (*MetricsHook, error) {
+
+	// Метрика времени выполнения запросов
+	queryDuration := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace:                       namespace,
+			Subsystem:                       "",
+			Name:                            "sql_query_duration_seconds",
+			Help:                            "A histogram of the duration (seconds) of sql queries.",
+			ConstLabels:                     nil,
+			Buckets:                         []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+			NativeHistogramBucketFactor:     0,
+			NativeHistogramZeroThreshold:    0,
+			NativeHistogramMaxBucketNumber:  0,
+			NativeHistogramMinResetDuration: 0,
+			NativeHistogramMaxZeroThreshold: 0,
+		}, []string{"query_name", "method", "in_tx", "status"},
+	)
+
+	queryDuration, err := promUtils.Register(registerer, queryDuration)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MetricsHook{
+		queryDuration: queryDuration,
+	}, nil
+}
+
+// Before реализует интерфейс Hook.
+func (h *MetricsHook) Before(ctx context.Context, _ *QueryEvent) context.Context {
+	return ctx
+}
+
+// After реализует интерфейс Hook.
+func (h *MetricsHook) After(_ context.Context, event *QueryEvent) {
+
+	name := event.Name
+	if name == "" {
+		name = unknownQueryName
+	}
+
+	inTx := "false"
+	if event.InTx {
+		inTx = "true"
+	}
+
+	h.queryDuration.WithLabelValues(name, event.Method, inTx, queryStatus(event.Err)).Observe(event.Duration.Seconds())
+}
+
+// queryStatus возвращает статус запроса для метрик
+func queryStatus(err error) string {
+	switch {
+	case err == nil, errors.Is(err, ErrNoRows):
+		return "ok"
+	case errors.IsContextError(err):
+		return "canceled"
+	default:
+		return "error"
+	}
+}
@@ -154,6 +154,24 @@ func (_m *MockSQL) Get(ctx context.Context, dest any, q squirrel.Sqlizer) error
 	return r0
 }
 
+// InTx provides a mock function with given fields: ctx, opts, fn
+func (_m *MockSQL) InTx(ctx context.Context, opts *TxOptions, fn func(context.Context) error) error {
+	ret := _m.Called(ctx, opts, fn)
+
+	if len(ret) == 0 {
+		panic("no return value specified for InTx")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *TxOptions, func(context.Context) error) error); ok {
+		r0 = rf(ctx, opts, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // Ping provides a mock function with given fields: ctx
 func (_m *MockSQL) Ping(ctx context.Context) error {
 	ret := _m.Called(ctx)
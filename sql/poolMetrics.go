@@ -0,0 +1,32 @@
+package sql
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+
+	"pkg/errors"
+)
+
+// RegisterPoolMetrics регистрирует метрики пула соединений (go_sql_*) с меткой db_name = name.
+// Если registerer nil, используется глобальный реестр. Повторная регистрация с тем же name заменяет прежний коллектор,
+// чтобы метрики отдавал последний открытый пул, а не закрытый, например после переподключения
+func (s *DB) RegisterPoolMetrics(registerer prometheus.Registerer, name string) error {
+
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+
+	collector := collectors.NewDBStatsCollector(s.DB.DB, name)
+
+	err := registerer.Register(collector)
+	var alreadyRegistered prometheus.AlreadyRegisteredError
+	if errors.As(err, &alreadyRegistered) {
+		registerer.Unregister(alreadyRegistered.ExistingCollector)
+		err = registerer.Register(collector)
+	}
+	if err != nil {
+		return errors.Default.Wrap(err).WithParams("name", name)
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package sql
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterPoolMetrics(t *testing.T) {
+
+	registry := prometheus.NewRegistry()
+
+	maxOpenConns := func() float64 {
+		families, err := registry.Gather()
+		require.NoError(t, err)
+		for _, family := range families {
+			if family.GetName() == "go_sql_max_open_connections" {
+				return family.GetMetric()[0].GetGauge().GetValue()
+			}
+		}
+		t.Fatal("go_sql_max_open_connections not found")
+		return 0
+	}
+
+	first := sql.OpenDB(txConnector{driver: &txDriver{log: nil}})
+	first.SetMaxOpenConns(1)
+	require.NoError(t, NewDB(first, "postgres").RegisterPoolMetrics(registry, "main"))
+	assert.Equal(t, 1.0, maxOpenConns())
+
+	// Пул с тем же названием заменяет прежний
+	second := sql.OpenDB(txConnector{driver: &txDriver{log: nil}})
+	second.SetMaxOpenConns(2)
+	require.NoError(t, NewDB(second, "postgres").RegisterPoolMetrics(registry, "main"))
+	assert.Equal(t, 2.0, maxOpenConns())
+
+	_ = first.Close()
+	_ = second.Close()
+}
@@ -6,6 +6,13 @@ import (
 
 type Rows struct {
 	*sqlx.Rows
+
+	// after вызывает хуки после выполнения запроса, запрос считается завершенным,
+	// когда строки прочитаны до конца или закрыты
+	after func(rowsAffected int64, err error)
+
+	// Количество прочитанных строк
+	count int64
 }
 
 type RowsInterface interface {
@@ -35,9 +42,34 @@ func (s *Rows) StructScan(dest any) error {
 	return nil
 }
 
+// Next переходит к следующей строке и считает прочитанные строки для хуков.
+// Когда строки закончились, вызывает хуки после выполнения запроса, не дожидаясь Close
+func (s *Rows) Next() bool {
+	if !s.Rows.Next() {
+		s.finish(s.Rows.Err())
+		return false
+	}
+	s.count++
+	return true
+}
+
+// Close закрывает строки и вызывает хуки после выполнения запроса, если строки не дочитаны до конца
 func (s *Rows) Close() error {
-	if err := s.Rows.Close(); err != nil {
+	err := s.Rows.Close()
+	if err != nil {
+		s.finish(err)
 		return wrapSQLError(err)
 	}
+	s.finish(s.Rows.Err())
 	return nil
 }
+
+// finish один раз вызывает хуки после выполнения запроса
+func (s *Rows) finish(err error) {
+	if s.after == nil {
+		return
+	}
+	after := s.after
+	s.after = nil
+	after(s.count, err)
+}
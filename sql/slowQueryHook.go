@@ -0,0 +1,56 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"pkg/log"
+)
+
+var _ Hook = new(SlowQueryHook)
+
+// SlowQueryHook - хук, который логирует запросы дольше порога через pkg/log
+type SlowQueryHook struct {
+	threshold time.Duration
+	logArgs   bool
+}
+
+// NewSlowQueryHook создает хук с порогом threshold.
+// Аргументы запроса логируются только при logArgs, так как в них могут быть персональные данные
+func NewSlowQueryHook(threshold time.Duration, logArgs bool) *SlowQueryHook {
+	return &SlowQueryHook{
+		threshold: threshold,
+		logArgs:   logArgs,
+	}
+}
+
+// Before реализует интерфейс Hook.
+func (h *SlowQueryHook) Before(ctx context.Context, _ *QueryEvent) context.Context {
+	return ctx
+}
+
+// After реализует интерфейс Hook.
+func (h *SlowQueryHook) After(ctx context.Context, event *QueryEvent) {
+
+	if event.Duration < h.threshold {
+		return
+	}
+
+	params := []any{
+		"queryName", event.Name,
+		"method", event.Method,
+		"query", event.Query,
+		"duration", event.Duration.String(),
+		"rowsAffected", event.RowsAffected,
+		"inTx", event.InTx,
+	}
+	if h.logArgs {
+		params = append(params, "args", fmt.Sprintf("%v", event.Args))
+	}
+	if event.Err != nil {
+		params = append(params, "error", event.Err.Error())
+	}
+
+	log.WithContextParams(ctx).WithParams(params...).Warning("slow sql query")
+}
@@ -2,7 +2,10 @@ package sql
 
 import (
 	"context"
+	"database/sql"
+	"reflect"
 
+	sq "github.com/Masterminds/squirrel"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -16,36 +19,138 @@ type StmtInterface interface {
 	closer
 }
 
+// Stmt - подготовленный запрос.
+// Если методы вызываются без аргументов, используются аргументы билдера, переданного в Prepare.
+// Если в контексте есть транзакция, запрос выполняется в ней. Запрос, подготовленный в транзакции,
+// можно использовать и после ее завершения: вне транзакции он выполняется через подключение
 type Stmt struct {
 	Stmt *sqlx.Stmt
+
+	// Подключение, через которое вызываются хуки
+	db *DB
+
+	// Текст запроса и аргументы билдера
+	query string
+	args  []any
+
+	// Транзакция, в которой подготовлен запрос
+	tx *Tx
+
+	// Освобождение запроса в кэше, nil если запрос не из кэша
+	release func() error
+}
+
+// stmt возвращает запрос для транзакции из контекста:
+//   - в транзакции, в которой запрос подготовлен, или без транзакции для запроса подключения - сам запрос;
+//   - в другой транзакции - запрос из кэша этой транзакции, он подготавливается в ней один раз и закрывается при ее завершении;
+//   - без транзакции для запроса, подготовленного в транзакции, - запрос подключения, так как после завершения
+//     транзакции ее запросы недействительны.
+//
+// Функцию release нужно вызвать после выполнения запроса
+func (s *Stmt) stmt(ctx context.Context) (stmt *sqlx.Stmt, release func() error, err error) {
+
+	tx := ExtractTx(ctx)
+	switch {
+	case tx == s.tx || s.db == nil:
+		return s.Stmt, noRelease, nil
+	case tx != nil:
+		return tx.stmts.acquire(ctx, s.query, tx.Tx.PreparexContext)
+	case s.db.stmts != nil:
+		return s.db.stmts.acquire(ctx, s.query, s.db.DB.PreparexContext)
+	}
+
+	// Кэш отключен: подготавливаем запрос подключения на один вызов
+	if stmt, err = s.db.DB.PreparexContext(ctx, s.query); err != nil {
+		return nil, nil, err
+	}
+	return stmt, stmt.Close, nil
+}
+
+func noRelease() error { return nil }
+
+// callArgs возвращает аргументы вызова или аргументы билдера, если при вызове аргументы не переданы
+func (s *Stmt) callArgs(args []any) []any {
+	if len(args) == 0 {
+		return s.args
+	}
+	return args
+}
+
+// beforeQuery вызывает хуки подключения, если запрос подготовлен через DB
+func (s *Stmt) beforeQuery(ctx context.Context, method string, args []any) (context.Context, *QueryEvent) {
+	if s.db == nil {
+		return ctx, nil
+	}
+	return s.db.beforeQuery(ctx, method, s.query, args)
+}
+
+func (s *Stmt) afterQuery(event *QueryEvent, rowsAffected int64, err error) {
+	if s.db == nil {
+		return
+	}
+	s.db.afterQuery(event, rowsAffected, err)
 }
 
 func (s *Stmt) Select(ctx context.Context, dest any, args ...any) error {
-	if err := s.Stmt.SelectContext(ctx, dest, args...); err != nil {
+	args = s.callArgs(args)
+	stmt, release, err := s.stmt(ctx)
+	if err != nil {
+		return wrapSQLError(err)
+	}
+	defer func() { _ = release() }()
+
+	ctx, event := s.beforeQuery(ctx, MethodSelect, args)
+	err = stmt.SelectContext(ctx, dest, args...)
+	s.afterQuery(event, destLen(dest), err)
+	if err != nil {
 		return wrapSQLError(err)
 	}
 	return nil
 }
 
 func (s *Stmt) Get(ctx context.Context, dest any, args ...any) error {
-	if err := s.Stmt.GetContext(ctx, dest, args...); err != nil {
+	args = s.callArgs(args)
+	stmt, release, err := s.stmt(ctx)
+	if err != nil {
 		return wrapSQLError(err)
 	}
-	return nil
-}
+	defer func() { _ = release() }()
 
-func (s *Stmt) Exec(ctx context.Context, args ...any) error {
-	_, err := s.Stmt.ExecContext(ctx, args...)
+	ctx, event := s.beforeQuery(ctx, MethodGet, args)
+	err = stmt.GetContext(ctx, dest, args...)
+	s.afterQuery(event, rowsFound(err), err)
 	if err != nil {
 		return wrapSQLError(err)
 	}
 	return nil
 }
 
+func (s *Stmt) exec(ctx context.Context, method string, args []any) (sql.Result, error) {
+	args = s.callArgs(args)
+	stmt, release, err := s.stmt(ctx)
+	if err != nil {
+		return nil, wrapSQLError(err)
+	}
+	defer func() { _ = release() }()
+
+	ctx, event := s.beforeQuery(ctx, method, args)
+	res, err := stmt.ExecContext(ctx, args...)
+	s.afterQuery(event, resultRowsAffected(res), err)
+	if err != nil {
+		return nil, wrapSQLError(err)
+	}
+	return res, nil
+}
+
+func (s *Stmt) Exec(ctx context.Context, args ...any) error {
+	_, err := s.exec(ctx, MethodExec, args)
+	return err
+}
+
 func (s *Stmt) ExecWithLastInsertID(ctx context.Context, args ...any) (uint32, error) {
-	res, err := s.Stmt.ExecContext(ctx, args...)
+	res, err := s.exec(ctx, MethodExecWithLastInsertID, args)
 	if err != nil {
-		return 0, wrapSQLError(err)
+		return 0, err
 	}
 	id, err := res.LastInsertId()
 	if err != nil {
@@ -55,9 +160,9 @@ func (s *Stmt) ExecWithLastInsertID(ctx context.Context, args ...any) (uint32, e
 }
 
 func (s *Stmt) ExecWithAffectedRows(ctx context.Context, args ...any) (uint32, error) {
-	res, err := s.Stmt.ExecContext(ctx, args...)
+	res, err := s.exec(ctx, MethodExecWithRowsAffected, args)
 	if err != nil {
-		return 0, wrapSQLError(err)
+		return 0, err
 	}
 	rows, err := res.RowsAffected()
 	if err != nil {
@@ -67,20 +172,116 @@ func (s *Stmt) ExecWithAffectedRows(ctx context.Context, args ...any) (uint32, e
 }
 
 func (s *Stmt) QueryRow(ctx context.Context, args ...any) *Row {
-	return &Row{s.Stmt.QueryRowxContext(ctx, args...)}
+	args = s.callArgs(args)
+
+	// sqlx.Row нельзя создать с ошибкой, поэтому если запрос не подготовился, выполняем его текст напрямую,
+	// и ошибка вернется из Scan
+	stmt, release, err := s.stmt(ctx)
+	if err != nil {
+		return s.queryRowUnprepared(ctx, args)
+	}
+	defer func() { _ = release() }()
+
+	ctx, event := s.beforeQuery(ctx, MethodQueryRow, args)
+	row := &Row{stmt.QueryRowxContext(ctx, args...)}
+	s.afterQuery(event, unknownRowsAffected, row.Row.Err())
+	return row
 }
 
+// Query выполняет запрос и возвращает строки, которые нужно закрыть. Хуки завершаются так же, как в DB.Query
 func (s *Stmt) Query(ctx context.Context, args ...any) (*Rows, error) {
-	rows, err := s.Stmt.QueryxContext(ctx, args...)
+	args = s.callArgs(args)
+	stmt, release, err := s.stmt(ctx)
+	if err != nil {
+		return nil, wrapSQLError(err)
+	}
+
+	// database/sql не закрывает запрос, пока по нему открыты строки
+	defer func() { _ = release() }()
+
+	ctx, event := s.beforeQuery(ctx, MethodQuery, args)
+	rows, err := stmt.QueryxContext(ctx, args...)
 	if err != nil {
+		s.afterQuery(event, unknownRowsAffected, err)
 		return nil, wrapSQLError(err)
 	}
-	return &Rows{rows}, nil
+
+	// Запрос завершается при закрытии строк, тогда же вызываем хуки после выполнения запроса
+	after := func(rowsAffected int64, err error) { s.afterQuery(event, rowsAffected, err) }
+	return &Rows{Rows: rows, after: after, count: 0}, nil
+}
+
+// queryRowUnprepared выполняет текст запроса без подготовки в транзакции из контекста или в подключении
+func (s *Stmt) queryRowUnprepared(ctx context.Context, args []any) *Row {
+	ctx, event := s.beforeQuery(ctx, MethodQueryRow, args)
+	var row *Row
+	if tx := ExtractTx(ctx); tx != nil {
+		row = &Row{tx.Tx.QueryRowxContext(ctx, s.query, args...)}
+	} else {
+		row = &Row{s.db.DB.QueryRowxContext(ctx, s.query, args...)}
+	}
+	s.afterQuery(event, unknownRowsAffected, row.Row.Err())
+	return row
 }
 
+// Close закрывает запрос. Запрос из кэша только освобождается, закрывает его кэш при вытеснении
 func (s *Stmt) Close() error {
+	if s.release != nil {
+		if err := s.release(); err != nil {
+			return wrapSQLError(err)
+		}
+		return nil
+	}
 	if err := s.Stmt.Close(); err != nil {
 		return wrapSQLError(err)
 	}
 	return nil
 }
+
+// TypedStmt - подготовленный запрос с типизированными аргументами.
+// A - структура, поля с тегами db которой передаются в запрос в порядке объявления,
+// или скалярный тип для запроса с одним аргументом
+type TypedStmt[A any] struct {
+	*Stmt
+}
+
+// PrepareT подготавливает запрос с типизированными аргументами
+func PrepareT[A any](ctx context.Context, db SQL, q sq.Sqlizer) (*TypedStmt[A], error) {
+	stmt, err := db.Prepare(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return &TypedStmt[A]{Stmt: stmt}, nil
+}
+
+func (s *TypedStmt[A]) Select(ctx context.Context, dest any, args A) error {
+	return s.Stmt.Select(ctx, dest, typedArgs(args)...)
+}
+
+func (s *TypedStmt[A]) Get(ctx context.Context, dest any, args A) error {
+	return s.Stmt.Get(ctx, dest, typedArgs(args)...)
+}
+
+func (s *TypedStmt[A]) Exec(ctx context.Context, args A) error {
+	return s.Stmt.Exec(ctx, typedArgs(args)...)
+}
+
+func (s *TypedStmt[A]) ExecWithAffectedRows(ctx context.Context, args A) (uint32, error) {
+	return s.Stmt.ExecWithAffectedRows(ctx, typedArgs(args)...)
+}
+
+func (s *TypedStmt[A]) QueryRow(ctx context.Context, args A) *Row {
+	return s.Stmt.QueryRow(ctx, typedArgs(args)...)
+}
+
+func (s *TypedStmt[A]) Query(ctx context.Context, args A) (*Rows, error) {
+	return s.Stmt.Query(ctx, typedArgs(args)...)
+}
+
+// typedArgs раскладывает аргументы в слайс
+func typedArgs[A any](args A) []any {
+	if isScannable(reflect.TypeFor[A]()) {
+		return []any{args}
+	}
+	return appendStructValues(nil, reflect.ValueOf(args))
+}
@@ -0,0 +1,125 @@
+package sql
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// defaultStmtCacheSize - размер кэша подготовленных запросов по умолчанию
+const defaultStmtCacheSize = 128
+
+// stmtCache - LRU кэш подготовленных запросов по тексту SQL.
+// Вытесненный запрос закрывается только после того, как его освободят все, кто получил его из кэша
+type stmtCache struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List
+}
+
+// cachedStmt - запрос в кэше и счетчик его использований
+type cachedStmt struct {
+	query   string
+	stmt    *sqlx.Stmt
+	refs    int
+	evicted bool
+}
+
+func newStmtCache(capacity int) *stmtCache {
+	return &stmtCache{
+		mu:       sync.Mutex{},
+		capacity: capacity,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// acquire возвращает запрос из кэша или подготавливает новый через prepare.
+// Возвращаемую функцию release нужно вызвать, когда запрос больше не используется
+func (c *stmtCache) acquire(ctx context.Context, query string, prepare func(ctx context.Context, query string) (*sqlx.Stmt, error)) (*sqlx.Stmt, func() error, error) {
+
+	c.mu.Lock()
+	if element, ok := c.items[query]; ok {
+		c.order.MoveToFront(element)
+		entry := element.Value.(*cachedStmt) //nolint:forcetypeassert // В списке хранится только *cachedStmt
+		entry.refs++
+		c.mu.Unlock()
+		return entry.stmt, c.releaseFunc(entry), nil
+	}
+	c.mu.Unlock()
+
+	// Подготавливаем запрос без блокировки, чтобы не задерживать остальные запросы
+	stmt, err := prepare(ctx, query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Пока запрос подготавливался, его мог добавить другой вызов
+	if element, ok := c.items[query]; ok {
+		_ = stmt.Close()
+		c.order.MoveToFront(element)
+		entry := element.Value.(*cachedStmt) //nolint:forcetypeassert // В списке хранится только *cachedStmt
+		entry.refs++
+		return entry.stmt, c.releaseFunc(entry), nil
+	}
+
+	entry := &cachedStmt{query: query, stmt: stmt, refs: 1, evicted: false}
+	c.items[query] = c.order.PushFront(entry)
+
+	// Вытесняем самые давние запросы
+	for c.order.Len() > c.capacity {
+		c.evict(c.order.Back())
+	}
+
+	return entry.stmt, c.releaseFunc(entry), nil
+}
+
+// releaseFunc возвращает функцию освобождения запроса, которая срабатывает только один раз
+func (c *stmtCache) releaseFunc(entry *cachedStmt) func() error {
+	var once sync.Once
+	return func() (err error) {
+		once.Do(func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+
+			entry.refs--
+			if entry.evicted && entry.refs == 0 {
+				err = entry.stmt.Close()
+			}
+		})
+		return err
+	}
+}
+
+// evict удаляет запрос из кэша и закрывает его, если он не используется. Вызывается под блокировкой
+func (c *stmtCache) evict(element *list.Element) {
+	entry := element.Value.(*cachedStmt) //nolint:forcetypeassert // В списке хранится только *cachedStmt
+	c.order.Remove(element)
+	delete(c.items, entry.query)
+	entry.evicted = true
+	if entry.refs == 0 {
+		_ = entry.stmt.Close()
+	}
+}
+
+// purge удаляет из кэша все запросы
+func (c *stmtCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.order.Len() > 0 {
+		c.evict(c.order.Back())
+	}
+}
+
+// len возвращает количество запросов в кэше
+func (c *stmtCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
@@ -0,0 +1,184 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+)
+
+// Драйвер-заглушка, который считает подготовленные и закрытые запросы
+type countingDriver struct {
+	prepared atomic.Int32
+	closed   atomic.Int32
+}
+
+type countingConn struct{ driver *countingDriver }
+
+type countingStmt struct{ driver *countingDriver }
+
+func (d *countingDriver) Open(string) (driver.Conn, error) { return &countingConn{driver: d}, nil }
+
+func (c *countingConn) Prepare(string) (driver.Stmt, error) {
+	c.driver.prepared.Add(1)
+	return &countingStmt{driver: c.driver}, nil
+}
+func (c *countingConn) Close() error              { return nil }
+func (c *countingConn) Begin() (driver.Tx, error) { return countingTx{}, nil }
+
+type countingTx struct{}
+
+func (countingTx) Commit() error   { return nil }
+func (countingTx) Rollback() error { return nil }
+
+func (s *countingStmt) Close() error {
+	s.driver.closed.Add(1)
+	return nil
+}
+func (s *countingStmt) NumInput() int                              { return -1 }
+func (s *countingStmt) Exec([]driver.Value) (driver.Result, error) { return driver.ResultNoRows, nil }
+func (s *countingStmt) Query([]driver.Value) (driver.Rows, error)  { return nil, driver.ErrSkip }
+
+func TestStmtCache(t *testing.T) {
+
+	countingDrv := new(countingDriver)
+	sql.Register("counting", countingDrv)
+
+	db, err := sql.Open("counting", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlxDB := sqlx.NewDb(db, "counting")
+
+	ctx := context.Background()
+	cache := newStmtCache(2)
+
+	first, releaseFirst, err := cache.acquire(ctx, "SELECT 1", sqlxDB.PreparexContext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Повторный запрос берется из кэша
+	again, releaseAgain, _ := cache.acquire(ctx, "SELECT 1", sqlxDB.PreparexContext)
+	if again != first {
+		t.Errorf("Ожидался запрос из кэша")
+	}
+	_ = releaseAgain()
+
+	_, releaseSecond, _ := cache.acquire(ctx, "SELECT 2", sqlxDB.PreparexContext)
+	_ = releaseSecond()
+
+	// Третий запрос вытесняет первый, но первый еще используется и не закрывается
+	_, releaseThird, _ := cache.acquire(ctx, "SELECT 3", sqlxDB.PreparexContext)
+	_ = releaseThird()
+
+	if cache.len() != 2 {
+		t.Errorf("len = %d, want 2", cache.len())
+	}
+	if got := countingDrv.closed.Load(); got != 0 {
+		t.Errorf("Закрыто %d запросов до освобождения, want 0", got)
+	}
+
+	// После освобождения вытесненный запрос закрывается, повторное освобождение ничего не делает
+	_ = releaseFirst()
+	_ = releaseFirst()
+	if got := countingDrv.closed.Load(); got != 1 {
+		t.Errorf("Закрыто %d запросов, want 1", got)
+	}
+
+	cache.purge()
+	if got := countingDrv.closed.Load(); got != 3 {
+		t.Errorf("Закрыто %d запросов после очистки, want 3", got)
+	}
+}
+
+func TestStmtInOtherTx(t *testing.T) {
+
+	countingDrv := new(countingDriver)
+	sql.Register("countingStmt", countingDrv)
+
+	conn, err := sql.Open("countingStmt", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetMaxOpenConns(1)
+	db := NewDB(conn, "countingStmt")
+
+	ctx := context.Background()
+
+	// Запрос подключения в транзакции подготавливается один раз и берется из кэша транзакции
+	stmt, err := db.Prepare(ctx, sq.Expr("UPDATE t SET a = ?", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = stmt.Close() }()
+	preparedBefore := countingDrv.prepared.Load()
+
+	err = db.InTx(ctx, nil, func(ctx context.Context) error {
+		for range 3 {
+			if err := stmt.Exec(ctx); err != nil {
+				return err
+			}
+		}
+		if tx := ExtractTx(ctx); tx.stmts == nil || tx.stmts.len() != 1 {
+			t.Errorf("Запрос не сохранен в кэше транзакции")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := countingDrv.prepared.Load() - preparedBefore; got > 1 {
+		t.Errorf("В транзакции подготовлено %d запросов, want не больше 1", got)
+	}
+
+	// Запрос, подготовленный в транзакции, после ее завершения выполняется через запрос подключения
+	var txStmt *Stmt
+	err = db.InTx(ctx, nil, func(ctx context.Context) error {
+		txStmt, err = db.Prepare(ctx, sq.Expr("UPDATE t SET b = ?", 1))
+		if err != nil {
+			return err
+		}
+		return txStmt.Exec(ctx)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = txStmt.Close() }()
+
+	if err = txStmt.Exec(ctx); err != nil {
+		t.Errorf("Запрос после завершения транзакции: %v", err)
+	}
+
+	// Одну транзакцию можно использовать из нескольких горутин
+	err = db.InTx(ctx, nil, func(ctx context.Context) error {
+		var wg sync.WaitGroup
+		errs := make(chan error, 4)
+		for range 4 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- stmt.Exec(ctx)
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+		if tx := ExtractTx(ctx); tx.stmts.len() != 1 {
+			t.Errorf("В кэше транзакции %d запросов, want 1", tx.stmts.len())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Запросы из нескольких горутин в транзакции: %v", err)
+	}
+}
@@ -0,0 +1,256 @@
+package sql
+
+import (
+	"reflect"
+	"slices"
+
+	sq "github.com/Masterminds/squirrel"
+
+	"pkg/ddlHelper"
+	"pkg/errors"
+)
+
+// Column - имя колонки таблицы без префикса. Константы колонок генерирует cmd/tablegen
+type Column string
+
+// String возвращает имя колонки
+func (c Column) String() string {
+	return string(c)
+}
+
+// ErrUnknownColumn - колонки нет в таблице
+var ErrUnknownColumn = errors.New("unknown table column")
+
+// TableRef - таблица, к которой можно присоединиться через Table.Join
+type TableRef interface {
+	From() string
+	Col(column Column) string
+}
+
+var _ TableRef = Table[struct{}]{}
+
+// Table - метаданные таблицы, построенные по тегам db структуры T: колонки, алиас и построители запросов:
+//
+//	var Users = sql.NewTable[User]("users").As("u")
+//	q := Users.Select().Where(sq.Eq{Users.Col(UserID): id})
+//
+// Встроенные структуры без тега раскрываются, как в BulkInsert, в том числе из других пакетов.
+// Встроенные указатели на структуры и типы, реализующие sql.Scanner, не раскрываются
+type Table[T any] struct {
+	name    string
+	alias   string
+	columns []Column
+	fields  map[Column][]int // Индекс поля в структуре для reflect.Value.FieldByIndex
+}
+
+// NewTable создает метаданные таблицы. Паникует, если T не структура или в ней нет тегов db,
+// так как таблицы объявляются в переменных пакета и ошибка видна при старте
+func NewTable[T any](name string) Table[T] {
+
+	t := Table[T]{
+		name:    name,
+		alias:   "",
+		columns: nil,
+		fields:  make(map[Column][]int),
+	}
+
+	typ := reflect.TypeFor[T]()
+	if typ.Kind() != reflect.Struct {
+		panic(errors.Default.New("table model must be a struct").WithParams("type", typ.String()))
+	}
+
+	t.collectFields(typ, nil)
+	if len(t.columns) == 0 && typ.NumField() > 0 {
+		panic(errors.Default.New("struct has no db tags").WithParams("type", typ.String()))
+	}
+
+	return t
+}
+
+// collectFields собирает колонки в порядке полей структуры, раскрывая встроенные структуры
+func (t *Table[T]) collectFields(typ reflect.Type, index []int) {
+	for i := range typ.NumField() {
+		field := typ.Field(i)
+		tag := columnTag(field)
+		fieldIndex := append(index[:len(index):len(index)], i)
+
+		if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct && !isScannable(field.Type) {
+			t.collectFields(field.Type, fieldIndex)
+			continue
+		}
+
+		if tag == "" || tag == "-" || !field.IsExported() {
+			continue
+		}
+
+		column := Column(tag)
+		if _, ok := t.fields[column]; ok {
+			continue
+		}
+		t.columns = append(t.columns, column)
+		t.fields[column] = fieldIndex
+	}
+}
+
+// As возвращает копию таблицы с алиасом. Колонки в Col и SelectAll получают префикс алиаса
+func (t Table[T]) As(alias string) Table[T] {
+	t.alias = alias
+	return t
+}
+
+// Name возвращает имя таблицы
+func (t Table[T]) Name() string {
+	return t.name
+}
+
+// Alias возвращает алиас таблицы или пустую строку
+func (t Table[T]) Alias() string {
+	return t.alias
+}
+
+// From возвращает таблицу для FROM: "users u" или "users" без алиаса
+func (t Table[T]) From() string {
+	if t.alias == "" {
+		return t.name
+	}
+	return ddlHelper.WithCustomAlias(t.name, t.alias)
+}
+
+// Col возвращает колонку с префиксом алиаса, если он задан
+func (t Table[T]) Col(column Column) string {
+	if t.alias == "" {
+		return string(column)
+	}
+	return ddlHelper.WithCustomPrefix(string(column), t.alias)
+}
+
+// Cols возвращает колонки с префиксом алиаса
+func (t Table[T]) Cols(columns ...Column) []string {
+	res := make([]string, 0, len(columns))
+	for _, column := range columns {
+		res = append(res, t.Col(column))
+	}
+	return res
+}
+
+// Columns возвращает все колонки таблицы в порядке полей структуры
+func (t Table[T]) Columns() []Column {
+	return slices.Clone(t.columns)
+}
+
+// SelectAll возвращает все колонки с префиксом алиаса вместо ddlHelper.SelectAll
+func (t Table[T]) SelectAll() []string {
+	return t.Cols(t.columns...)
+}
+
+// Select начинает запрос SELECT всех колонок из таблицы
+func (t Table[T]) Select() sq.SelectBuilder {
+	return sq.Select(t.SelectAll()...).From(t.From())
+}
+
+// Join возвращает условие для sq.SelectBuilder.Join: other ON other.otherColumn = t.column
+func (t Table[T]) Join(other TableRef, otherColumn, column Column) string {
+	return ddlHelper.BuildJoin(other.From(), other.Col(otherColumn), t.Col(column))
+}
+
+// WriteOptions - какие колонки попадают в Insert и Update
+type WriteOptions struct {
+
+	// Пропускать поля с нулевым значением
+	OmitZero bool
+
+	// Записывать только эти колонки. Если не заданы, записываются все
+	Columns []Column
+
+	// Не записывать эти колонки, например первичный ключ с DEFAULT
+	Exclude []Column
+}
+
+// Insert строит INSERT одной строки. Без алиаса, так как Postgres и ClickHouse не принимают его в INSERT
+func (t Table[T]) Insert(row T, opts WriteOptions) (sq.InsertBuilder, error) {
+	columns, values, err := t.values(row, opts)
+	if err != nil {
+		return sq.InsertBuilder{}, err
+	}
+	return sq.Insert(t.name).Columns(columns...).Values(values...), nil
+}
+
+// InsertRows строит INSERT нескольких строк. OmitZero не применяется, так как у всех строк должны быть одни колонки
+func (t Table[T]) InsertRows(rows []T, opts WriteOptions) (sq.InsertBuilder, error) {
+	opts.OmitZero = false
+
+	q := sq.Insert(t.name)
+	for i, row := range rows {
+		columns, values, err := t.values(row, opts)
+		if err != nil {
+			return sq.InsertBuilder{}, err
+		}
+		if i == 0 {
+			q = q.Columns(columns...)
+		}
+		q = q.Values(values...)
+	}
+
+	return q, nil
+}
+
+// Update строит UPDATE колонок строки. Условие WHERE добавляет вызывающий
+func (t Table[T]) Update(row T, opts WriteOptions) (sq.UpdateBuilder, error) {
+	columns, values, err := t.values(row, opts)
+	if err != nil {
+		return sq.UpdateBuilder{}, err
+	}
+
+	q := sq.Update(t.name)
+	for i, column := range columns {
+		q = q.Set(column, values[i])
+	}
+
+	return q, nil
+}
+
+// Value возвращает значение поля колонки в строке
+func (t Table[T]) Value(row T, column Column) (any, bool) {
+	index, ok := t.fields[column]
+	if !ok {
+		return nil, false
+	}
+	return reflect.ValueOf(row).FieldByIndex(index).Interface(), true
+}
+
+// values возвращает колонки без префикса и значения строки с учетом настроек.
+// Неизвестная колонка в Columns или Exclude - ошибка, иначе опечатка молча меняет набор записываемых колонок
+func (t Table[T]) values(row T, opts WriteOptions) ([]string, []any, error) {
+
+	for _, column := range slices.Concat(opts.Columns, opts.Exclude) {
+		if _, ok := t.fields[column]; !ok {
+			return nil, nil, errors.Default.Wrap(ErrUnknownColumn).WithParams("table", t.name, "column", column)
+		}
+	}
+
+	v := reflect.ValueOf(row)
+
+	columns := t.columns
+	if len(opts.Columns) > 0 {
+		columns = opts.Columns
+	}
+
+	resColumns := make([]string, 0, len(columns))
+	resValues := make([]any, 0, len(columns))
+	for _, column := range columns {
+		if slices.Contains(opts.Exclude, column) {
+			continue
+		}
+		index := t.fields[column]
+
+		field := v.FieldByIndex(index)
+		if opts.OmitZero && field.IsZero() {
+			continue
+		}
+
+		resColumns = append(resColumns, string(column))
+		resValues = append(resValues, field.Interface())
+	}
+
+	return resColumns, resValues, nil
+}
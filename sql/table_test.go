@@ -0,0 +1,69 @@
+package sql
+
+import (
+	"testing"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pkg/errors"
+)
+
+type tableOrder struct {
+	ID     int `db:"id"`
+	UserID int `db:"user_id"`
+}
+
+func TestTable(t *testing.T) {
+
+	users := NewTable[bulkRow]("users").As("u")
+	orders := NewTable[tableOrder]("orders").As("o")
+
+	t.Run("1. Колонки и SelectAll", func(t *testing.T) {
+		assert.Equal(t, []Column{"id", "name", "email", "created_at"}, users.Columns())
+		assert.Equal(t, []string{"u.id", "u.name", "u.email", "u.created_at"}, users.SelectAll())
+	})
+
+	t.Run("2. Select с Join", func(t *testing.T) {
+		query, _, err := users.Select().Join(users.Join(orders, "user_id", "id")).Where(sq.Eq{users.Col("id"): 1}).ToSql()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT u.id, u.name, u.email, u.created_at FROM users u JOIN orders o ON o.user_id = u.id WHERE u.id = ?", query)
+	})
+
+	t.Run("3. Insert без нулевых полей", func(t *testing.T) {
+		q, err := users.Insert(bulkRow{Name: "a"}, WriteOptions{OmitZero: true})
+		require.NoError(t, err)
+		query, args, err := q.ToSql()
+		require.NoError(t, err)
+		assert.Equal(t, "INSERT INTO users (name) VALUES (?)", query)
+		assert.Equal(t, []any{"a"}, args)
+	})
+
+	t.Run("4. Update выбранных колонок", func(t *testing.T) {
+		row := bulkRow{bulkBase: bulkBase{ID: 1}, Name: "a", Email: "a@a"}
+		q, err := users.Update(row, WriteOptions{Columns: []Column{"id", "name", "email"}, Exclude: []Column{"id"}})
+		require.NoError(t, err)
+		query, args, err := q.Where(sq.Eq{"id": row.ID}).ToSql()
+		require.NoError(t, err)
+		assert.Equal(t, "UPDATE users SET name = ?, email = ? WHERE id = ?", query)
+		assert.Equal(t, []any{"a", "a@a", 1}, args)
+	})
+
+	t.Run("5. Значение колонки встроенной структуры", func(t *testing.T) {
+		value, ok := users.Value(bulkRow{bulkBase: bulkBase{ID: 7}}, "id")
+		assert.True(t, ok)
+		assert.Equal(t, 7, value)
+	})
+
+	t.Run("6. Неизвестная колонка в настройках записи", func(t *testing.T) {
+		_, err := users.Insert(bulkRow{Name: "a"}, WriteOptions{Columns: []Column{"name", "nmae"}})
+		assert.True(t, errors.Is(err, ErrUnknownColumn))
+
+		_, err = users.Update(bulkRow{Name: "a"}, WriteOptions{Exclude: []Column{"uid"}})
+		assert.True(t, errors.Is(err, ErrUnknownColumn))
+
+		_, err = users.InsertRows([]bulkRow{{Name: "a"}}, WriteOptions{Columns: []Column{"nmae"}})
+		assert.True(t, errors.Is(err, ErrUnknownColumn))
+	})
+}
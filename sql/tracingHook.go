@@ -0,0 +1,65 @@
+package sql
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"pkg/errors"
+)
+
+var _ Hook = new(TracingHook)
+
+// TracingHook - хук, который оборачивает каждый запрос в спан OpenTelemetry
+type TracingHook struct {
+	tracer   trace.Tracer
+	dbSystem string
+}
+
+// NewTracingHook создает хук. dbSystem - значение атрибута db.system, например "postgresql" или "clickhouse"
+func NewTracingHook(tracer trace.Tracer, dbSystem string) *TracingHook {
+	return &TracingHook{
+		tracer:   tracer,
+		dbSystem: dbSystem,
+	}
+}
+
+// Before реализует интерфейс Hook.
+func (h *TracingHook) Before(ctx context.Context, event *QueryEvent) context.Context {
+
+	spanName := event.Name
+	if spanName == "" {
+		spanName = "sql." + event.Method
+	}
+
+	ctx, _ = h.tracer.Start(ctx, spanName, //nolint:spancheck // Спан завершается в After
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", h.dbSystem),
+			attribute.String("db.operation", event.Method),
+			attribute.String("db.statement", event.Query),
+			attribute.Bool("db.in_tx", event.InTx),
+		),
+	)
+
+	return ctx
+}
+
+// After реализует интерфейс Hook.
+func (h *TracingHook) After(ctx context.Context, event *QueryEvent) {
+
+	span := trace.SpanFromContext(ctx)
+
+	if event.RowsAffected >= 0 {
+		span.SetAttributes(attribute.Int64("db.rows_affected", event.RowsAffected))
+	}
+
+	if event.Err != nil && !errors.Is(event.Err, ErrNoRows) {
+		span.RecordError(event.Err)
+		span.SetStatus(codes.Error, event.Err.Error())
+	}
+
+	span.End()
+}
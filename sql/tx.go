@@ -11,9 +11,27 @@ type TxInterface interface {
 
 type Tx struct {
 	Tx *sqlx.Tx
+
+	// Счетчик точек сохранения для вложенных вызовов InTx
+	savepoints int
+
+	// Кэш подготовленных в транзакции запросов. Создается вместе с транзакцией,
+	// чтобы транзакцию можно было использовать из нескольких горутин
+	stmts *stmtCache
+}
+
+// newTx оборачивает транзакцию sqlx с кэшем запросов заданного размера
+func newTx(tx *sqlx.Tx, stmtCacheSize int) *Tx {
+	return &Tx{Tx: tx, savepoints: 0, stmts: newStmtCache(stmtCacheSize)}
+}
+
+// closeStmts очищает кэш запросов транзакции. Сами запросы database/sql закрывает при завершении транзакции
+func (s *Tx) closeStmts() {
+	s.stmts.purge()
 }
 
 func (s *Tx) Commit() error {
+	defer s.closeStmts()
 	if err := s.Tx.Commit(); err != nil {
 		return wrapSQLError(err)
 	}
@@ -21,6 +39,7 @@ func (s *Tx) Commit() error {
 }
 
 func (s *Tx) Rollback() error {
+	defer s.closeStmts()
 	if err := s.Tx.Rollback(); err != nil {
 		return wrapSQLError(err)
 	}